@@ -0,0 +1,248 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// AuditAction describes the kind of a recorded mutation.
+type AuditAction string
+
+const (
+	// AuditInsert is recorded when a range is inserted without overwriting existing ranges.
+	AuditInsert AuditAction = "insert"
+	// AuditUpdate is recorded when an inserted range overwrites existing ranges.
+	AuditUpdate AuditAction = "update"
+	// AuditRemove is recorded when a range is removed.
+	AuditRemove AuditAction = "remove"
+	// AuditFlush is recorded when all ranges are removed by Flush.
+	AuditFlush AuditAction = "flush"
+	// AuditReset is recorded when all ranges are removed by Reset.
+	AuditReset AuditAction = "reset"
+	// AuditRestoreSnapshot is recorded when the ranges are replaced by a snapshot.
+	AuditRestoreSnapshot AuditAction = "restore-snapshot"
+	// AuditRestore is recorded when all buckets are replaced by a backup archive.
+	AuditRestore AuditAction = "restore"
+)
+
+// allAddresses is the range of the audit entries of operations that replace all ranges.
+const allAddresses = "0.0.0.0 - 255.255.255.255"
+
+// AuditEntry is a single record of the audit log.
+// Before and After contain all ranges that overlapped with the mutated range
+// before and after the mutation was applied.
+// Operations that replace all ranges, e.g. Flush or Restore, record a single entry for the
+// whole address space without Before and After. Source names the restored snapshot or backup.
+type AuditEntry struct {
+	Time    time.Time   `json:"time"`
+	Action  AuditAction `json:"action"`
+	Range   string      `json:"range"`
+	Source  string      `json:"source,omitempty"`
+	Actor   string      `json:"actor,omitempty"`
+	Comment string      `json:"comment,omitempty"`
+	Before  []Range     `json:"before"`
+	After   []Range     `json:"after"`
+}
+
+// AuditFilter restricts the entries that are returned by AuditLog.
+// Zero values match all entries.
+type AuditFilter struct {
+	// Since is the inclusive lower time limit.
+	Since time.Time
+	// Until is the exclusive upper time limit.
+	Until time.Time
+	// Range matches all entries whose mutated range overlaps with it.
+	Range string
+	// Actor matches all entries that were recorded with exactly this actor.
+	Actor string
+}
+
+// AuditLog returns all audit log entries that match the filter in chronological order.
+func (n *NutBreaker) AuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	if !n.audit {
+		return nil, ErrAuditLogDisabled
+	}
+
+	var filterRange *Range
+	if filter.Range != "" {
+		low, high, err := parseRange(filter.Range, nil)
+		if err != nil {
+			return nil, err
+		}
+		filterRange = &Range{Low: low.IP, High: high.IP}
+	}
+
+	// sequence numbers start at 1, which is why the end key excludes Until
+	start := timeKey(filter.Since, 0)
+	end := bytes.Repeat([]byte{math.MaxUint8}, 12)
+	if !filter.Until.IsZero() {
+		end = timeKey(filter.Until, 0)
+	}
+
+	var result []AuditEntry
+	err := n.db.View(func(tx *nutsdb.Tx) error {
+		values, err := tx.RangeScan(n.auditBucket, start, end)
+		if err != nil {
+			if errors.Is(err, nutsdb.ErrRangeScan) {
+				return nil
+			}
+			return err
+		}
+
+		for _, v := range values {
+			var e AuditEntry
+			err = json.Unmarshal(v, &e)
+			if err != nil {
+				return fmt.Errorf("failed to decode audit entry: %w", err)
+			}
+
+			if filter.Actor != "" && e.Actor != filter.Actor {
+				continue
+			}
+			if filterRange != nil {
+				low, high, err := parseRange(e.Range, nil)
+				if err != nil {
+					return fmt.Errorf("invalid audit entry range: %w", err)
+				}
+				if !filterRange.Overlaps(Range{Low: low.IP, High: high.IP}) {
+					continue
+				}
+			}
+			result = append(result, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// audited executes the mutation fn and records the ranges that it affected.
+func (t *Txn) audited(action AuditAction, ipRange string, opts []MutationOption, fn func() (MutationResult, error)) (MutationResult, error) {
+	if !t.n.audit {
+		return fn()
+	}
+
+	low, high, err := parseRange(ipRange, nil)
+	if err != nil {
+		// let the mutation report the error
+		return fn()
+	}
+
+	before, err := t.n.overlapping(t, low, high)
+	if err != nil {
+		return MutationResult{}, err
+	}
+
+	result, err := fn()
+	if err != nil {
+		return MutationResult{}, err
+	}
+
+	after, err := t.n.overlapping(t, low, high)
+	if err != nil {
+		return MutationResult{}, err
+	}
+
+	if action == AuditInsert && len(before) > 0 {
+		action = AuditUpdate
+	}
+
+	mo := newMutationOptions(opts)
+	t.audit = append(t.audit, AuditEntry{
+		Time:    t.n.now(),
+		Action:  action,
+		Range:   ipRange,
+		Actor:   mo.actor,
+		Comment: mo.comment,
+		Before:  before,
+		After:   after,
+	})
+	return result, nil
+}
+
+// bulkAuditEntry returns the audit entry of an operation that replaces all ranges.
+func (n *NutBreaker) bulkAuditEntry(action AuditAction, source string, opts []MutationOption) AuditEntry {
+	mo := newMutationOptions(opts)
+	return AuditEntry{
+		Time:    n.now(),
+		Action:  action,
+		Range:   allAddresses,
+		Source:  source,
+		Actor:   mo.actor,
+		Comment: mo.comment,
+	}
+}
+
+func (n *NutBreaker) writeAudit(tx *nutsdb.Tx, entries []AuditEntry) error {
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit entry: %w", err)
+		}
+
+		err = tx.Put(n.auditBucket, timeKey(e.Time, n.seq.Add(1)), data, 0)
+		if err != nil {
+			return fmt.Errorf("failed to write audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// journalSeqKey is the metadata key of the last sequence number of the audit log and the history.
+var journalSeqKey = []byte("journal:seq")
+
+// loadSeq continues the sequence numbers of the audit log and the history after the persisted one.
+func (n *NutBreaker) loadSeq(tx *nutsdb.Tx) error {
+	if !tx.ExistBucket(nutsdb.DataStructureBTree, n.metadataBucket) {
+		return nil
+	}
+	data, err := tx.Get(n.metadataBucket, journalSeqKey)
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrNotFoundKey) || errors.Is(err, nutsdb.ErrNotFoundBucket) {
+			return nil
+		}
+		return fmt.Errorf("failed to get journal sequence: %w", err)
+	}
+	if len(data) != 4 {
+		return fmt.Errorf("failed to decode journal sequence: invalid length %d", len(data))
+	}
+
+	// write transactions are serialized, the sequence is never decreased
+	if seq := binary.BigEndian.Uint32(data); seq > n.seq.Load() {
+		n.seq.Store(seq)
+	}
+	return nil
+}
+
+// saveSeq persists the sequence number if it was advanced since the given one.
+func (n *NutBreaker) saveSeq(tx *nutsdb.Tx, since uint32) error {
+	seq := n.seq.Load()
+	if seq == since {
+		return nil
+	}
+	err := tx.Put(n.metadataBucket, journalSeqKey, binary.BigEndian.AppendUint32(nil, seq), 0)
+	if err != nil {
+		return fmt.Errorf("failed to write journal sequence: %w", err)
+	}
+	return nil
+}
+
+// timeKey returns a key that sorts chronologically.
+// The sequence number distinguishes entries that were recorded at the same time.
+func timeKey(t time.Time, seq uint32) []byte {
+	key := make([]byte, 12)
+	if !t.IsZero() {
+		binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	}
+	binary.BigEndian.PutUint32(key[8:], seq)
+	return key
+}
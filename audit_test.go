@@ -0,0 +1,195 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func initAuditDB(t *testing.T) (n *NutBreaker, clock *time.Time, cleanup func()) {
+	require := require.New(t)
+
+	dataDir := generateRandomDbDirName()
+	n, err := NewNutBreaker(
+		WithDir(dataDir),
+		WithAuditLog(),
+	)
+	require.NoError(err)
+
+	now := time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time {
+		return now
+	}
+	return n, &now, func() {
+		require.NoError(n.Close())
+		require.NoError(os.RemoveAll(dataDir))
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	ndb, clock, cleanup := initAuditDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	start := *clock
+	_, err := ndb.Insert("10.0.0.0/24", []byte("spam"), WithActor("alice"), WithComment("ticket 1"))
+	require.NoError(err)
+
+	*clock = clock.Add(time.Hour)
+	_, err = ndb.Insert("10.0.0.128/25", []byte("vpn"), WithActor("bob"))
+	require.NoError(err)
+
+	*clock = clock.Add(time.Hour)
+	_, err = ndb.Remove("10.0.0.0 - 10.0.0.9", WithActor("alice"))
+	require.NoError(err)
+
+	*clock = clock.Add(time.Hour)
+	_, err = ndb.Insert("192.168.0.1", []byte("abuse"), WithActor("bob"))
+	require.NoError(err)
+
+	all, err := ndb.AuditLog(AuditFilter{})
+	require.NoError(err)
+	require.Len(all, 4)
+
+	require.Equal(AuditInsert, all[0].Action)
+	require.Equal("alice", all[0].Actor)
+	require.Equal("ticket 1", all[0].Comment)
+	require.True(start.Equal(all[0].Time))
+	require.Empty(all[0].Before)
+	require.Len(all[0].After, 1)
+	require.Equal("10.0.0.0 - 10.0.0.255", all[0].After[0].String())
+
+	require.Equal(AuditUpdate, all[1].Action)
+	require.Len(all[1].Before, 1)
+	require.Equal("10.0.0.0 - 10.0.0.255", all[1].Before[0].String())
+	require.Equal([]byte("spam"), all[1].Before[0].Value)
+	require.Len(all[1].After, 1)
+	require.Equal("10.0.0.128 - 10.0.0.255", all[1].After[0].String())
+	require.Equal([]byte("vpn"), all[1].After[0].Value)
+
+	require.Equal(AuditRemove, all[2].Action)
+	require.Len(all[2].Before, 1)
+	require.Equal("10.0.0.0 - 10.0.0.127", all[2].Before[0].String())
+	require.Empty(all[2].After)
+
+	byActor, err := ndb.AuditLog(AuditFilter{Actor: "bob"})
+	require.NoError(err)
+	require.Len(byActor, 2)
+	require.Equal("10.0.0.128/25", byActor[0].Range)
+	require.Equal("192.168.0.1", byActor[1].Range)
+
+	byRange, err := ndb.AuditLog(AuditFilter{Range: "10.0.0.200"})
+	require.NoError(err)
+	require.Len(byRange, 2)
+
+	byTime, err := ndb.AuditLog(AuditFilter{
+		Since: start.Add(time.Hour),
+		Until: start.Add(3 * time.Hour),
+	})
+	require.NoError(err)
+	require.Len(byTime, 2)
+	require.Equal(AuditUpdate, byTime[0].Action)
+	require.Equal(AuditRemove, byTime[1].Action)
+}
+
+func TestAuditLogRollback(t *testing.T) {
+	ndb, _, cleanup := initAuditDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	err := ndb.Update(func(tx *Txn) error {
+		_, err := tx.Insert("10.0.0.0/24", []byte("spam"))
+		require.NoError(err)
+		return ErrIPNotFound
+	})
+	require.ErrorIs(err, ErrIPNotFound)
+
+	all, err := ndb.AuditLog(AuditFilter{})
+	require.NoError(err)
+	require.Empty(all)
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+
+	_, err := ndb.AuditLog(AuditFilter{})
+	require.ErrorIs(t, err, ErrAuditLogDisabled)
+}
+
+func TestAuditLogBulkOperations(t *testing.T) {
+	ndb, _, cleanup := initAuditDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	requireLast := func(action AuditAction, source string, length int) {
+		all, err := ndb.AuditLog(AuditFilter{})
+		require.NoError(err)
+		require.Len(all, length)
+		last := all[len(all)-1]
+		require.Equal(action, last.Action)
+		require.Equal(source, last.Source)
+		require.Equal("0.0.0.0 - 255.255.255.255", last.Range)
+		require.Empty(last.Before)
+		require.Empty(last.After)
+	}
+
+	_, err := ndb.Insert("10.0.0.0/24", []byte("spam"))
+	require.NoError(err)
+	require.NoError(ndb.Snapshot("before"))
+
+	var archive bytes.Buffer
+	require.NoError(ndb.Backup(&archive))
+
+	require.NoError(ndb.Flush())
+	requireLast(AuditFlush, "", 2)
+
+	require.NoError(ndb.Reset())
+	requireLast(AuditReset, "", 3)
+
+	require.NoError(ndb.RestoreSnapshot("before"))
+	requireLast(AuditRestoreSnapshot, "before", 4)
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 spam")
+
+	// the archive contains only the insertion, the restore continues the current sequence
+	require.NoError(ndb.Restore(&archive, WithMutationOptions(WithActor("alice"))))
+	requireLast(AuditRestore, "", 2)
+	all, err := ndb.AuditLog(AuditFilter{})
+	require.NoError(err)
+	require.Equal("alice", all[1].Actor)
+
+	_, err = ndb.Insert("10.0.1.0/24", []byte("spam"))
+	require.NoError(err)
+	all, err = ndb.AuditLog(AuditFilter{})
+	require.NoError(err)
+	require.Len(all, 3)
+	require.Equal(AuditInsert, all[2].Action)
+}
+
+func TestAuditLogRecoverBackup(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	ndb, err := NewNutBreaker(WithDir(dir), WithAuditLog())
+	require.NoError(err)
+	_, err = ndb.Insert("10.0.0.0/24", []byte("spam"))
+	require.NoError(err)
+
+	path := filepath.Join(t.TempDir(), "recovery.nbk")
+	f, err := os.Create(path)
+	require.NoError(err)
+	require.NoError(ndb.Backup(f))
+	require.NoError(f.Close())
+
+	require.NoError(ndb.recoverBackup(path))
+	all, err := ndb.AuditLog(AuditFilter{})
+	require.NoError(err)
+	require.Len(all, 2)
+	require.Equal(AuditRestore, all[1].Action)
+	require.Equal(path, all[1].Source)
+	require.NoError(ndb.Close())
+}
@@ -0,0 +1,471 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// An archive consists of a fixed size header followed by the payload.
+//
+//	magic    [8]byte  "NUTBRKUP"
+//	version  uint16   backupVersion
+//	reserved uint16
+//	length   uint64   length of the payload
+//	checksum [32]byte SHA-256 of the payload
+//
+// The payload is a sequence of records. Every record starts with the role of its bucket and its kind.
+// Key value records are followed by the length prefixed key and value, sorted set records
+// by the score and the length prefixed member. Lengths are encoded as uvarint.
+const (
+	backupMagic      = "NUTBRKUP"
+	backupVersion    = 1
+	backupHeaderSize = len(backupMagic) + 2 + 2 + 8 + sha256.Size
+	// maximum length of the payload, which is held in memory by Backup and Restore
+	maxBackupPayloadSize = 1 << 30
+)
+
+// bucketRole identifies a bucket independently of its configured name,
+// which allows to restore an archive into an instance with different bucket names.
+type bucketRole byte
+
+const (
+	roleBlacklist bucketRole = iota + 1
+	roleWhitelist
+	roleAudit
+	roleSnapshots
+	roleMetadata
+	roleHistory
+)
+
+type recordKind byte
+
+const (
+	recordKV recordKind = iota + 1
+	recordSortedSet
+)
+
+type backupRecord struct {
+	role  bucketRole
+	kind  recordKind
+	key   []byte
+	value []byte
+	score float64
+}
+
+// backupRecordID identifies the key or sorted set member that is written by a record.
+type backupRecordID struct {
+	role bucketRole
+	kind recordKind
+	key  string
+}
+
+func (r backupRecord) id() backupRecordID {
+	if r.kind == recordSortedSet {
+		return backupRecordID{r.role, r.kind, string(r.value)}
+	}
+	return backupRecordID{r.role, r.kind, string(r.key)}
+}
+
+// bucketName returns the configured name of the bucket with the given role.
+func (n *NutBreaker) bucketName(role bucketRole) string {
+	switch role {
+	case roleBlacklist:
+		return n.blacklistBucket
+	case roleWhitelist:
+		return n.whitelistBucket
+	case roleAudit:
+		return n.auditBucket
+	case roleSnapshots:
+		return n.snapshotBucket
+	case roleMetadata:
+		return n.metadataBucket
+	default:
+		return n.historyBucket
+	}
+}
+
+var bucketRoles = []bucketRole{roleBlacklist, roleWhitelist, roleAudit, roleSnapshots, roleMetadata, roleHistory}
+
+// Backup writes a consistent archive of all buckets, which includes the ranges as well as
+// the snapshots, list metadata, audit log and history. The archive is taken within a single
+// read-only transaction and can be written while the database is in use.
+// The archive is assembled in memory, as its header contains the length and checksum of the payload.
+// Archives are limited to 1 GiB, larger databases are rejected with ErrInvalidBackup.
+func (n *NutBreaker) Backup(w io.Writer) error {
+	var payload bytes.Buffer
+	err := n.db.View(func(tx *nutsdb.Tx) error {
+		for _, role := range bucketRoles {
+			err := n.backupBucket(tx, role, &payload)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	if payload.Len() > maxBackupPayloadSize {
+		return fmt.Errorf("failed to create backup: %w: payload of %d bytes exceeds the limit of %d bytes",
+			ErrInvalidBackup, payload.Len(), maxBackupPayloadSize)
+	}
+
+	header := make([]byte, 0, backupHeaderSize)
+	header = append(header, backupMagic...)
+	header = binary.BigEndian.AppendUint16(header, backupVersion)
+	header = binary.BigEndian.AppendUint16(header, 0)
+	header = binary.BigEndian.AppendUint64(header, uint64(payload.Len()))
+	checksum := sha256.Sum256(payload.Bytes())
+	header = append(header, checksum[:]...)
+
+	_, err = w.Write(header)
+	if err != nil {
+		return fmt.Errorf("failed to write backup header: %w", err)
+	}
+	_, err = payload.WriteTo(w)
+	if err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+func (n *NutBreaker) backupBucket(tx *nutsdb.Tx, role bucketRole, w *bytes.Buffer) error {
+	bucket := n.bucketName(role)
+
+	if tx.ExistBucket(nutsdb.DataStructureBTree, bucket) {
+		keys, values, err := tx.GetAll(bucket)
+		if err != nil {
+			return fmt.Errorf("failed to read %s bucket: %w", bucket, err)
+		}
+		for i := range keys {
+			writeBackupRecord(w, backupRecord{role: role, kind: recordKV, key: keys[i], value: values[i]})
+		}
+	}
+
+	if role != roleBlacklist || !tx.ExistBucket(nutsdb.DataStructureSortedSet, bucket) {
+		return nil
+	}
+	members, err := n.sortedSetMembers(tx)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		writeBackupRecord(w, backupRecord{role: role, kind: recordSortedSet, value: m.Value, score: m.Score})
+	}
+	return nil
+}
+
+// sortedSetMembers returns the members of the blacklist sorted set ordered by their score.
+func (n *NutBreaker) sortedSetMembers(tx *nutsdb.Tx) ([]*nutsdb.SortedSetMember, error) {
+	members, err := tx.ZMembers(n.blacklistBucket, n.blacklistSortedSetKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s sorted set: %w", n.blacklistBucket, err)
+	}
+
+	result := make([]*nutsdb.SortedSetMember, 0, len(members))
+	for m := range members {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score < result[j].Score
+		}
+		return bytes.Compare(result[i].Value, result[j].Value) < 0
+	})
+	return result, nil
+}
+
+func writeBackupRecord(w *bytes.Buffer, r backupRecord) {
+	w.WriteByte(byte(r.role))
+	w.WriteByte(byte(r.kind))
+	if r.kind == recordKV {
+		w.Write(binary.AppendUvarint(nil, uint64(len(r.key))))
+		w.Write(r.key)
+	} else {
+		w.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(r.score)))
+	}
+	w.Write(binary.AppendUvarint(nil, uint64(len(r.value))))
+	w.Write(r.value)
+}
+
+// readBackup validates the header and checksum of an archive and decodes all of its records.
+func readBackup(r io.Reader) ([]backupRecord, error) {
+	header := make([]byte, backupHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %w", ErrInvalidBackup, err)
+	}
+	if string(header[:len(backupMagic)]) != backupMagic {
+		return nil, fmt.Errorf("%w: missing magic bytes", ErrInvalidBackup)
+	}
+	header = header[len(backupMagic):]
+
+	version := binary.BigEndian.Uint16(header)
+	if version == 0 || version > backupVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedBackupVersion, version)
+	}
+	length := binary.BigEndian.Uint64(header[4:])
+	checksum := header[12:]
+	if length > maxBackupPayloadSize {
+		return nil, fmt.Errorf("%w: payload of %d bytes exceeds the limit of %d bytes", ErrInvalidBackup, length, maxBackupPayloadSize)
+	}
+
+	var payload bytes.Buffer
+	copied, err := io.Copy(&payload, io.LimitReader(r, int64(length)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read payload: %w", ErrInvalidBackup, err)
+	}
+	if uint64(copied) != length {
+		return nil, fmt.Errorf("%w: truncated payload: expected %d bytes, got %d", ErrInvalidBackup, length, copied)
+	}
+	sum := sha256.Sum256(payload.Bytes())
+	if !bytes.Equal(sum[:], checksum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidBackup)
+	}
+
+	var (
+		records []backupRecord
+		seen    = make(map[backupRecordID]bool)
+		data    = payload.Bytes()
+	)
+	for len(data) > 0 {
+		var rec backupRecord
+		rec, data, err = readBackupRecord(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %d: %w", ErrInvalidBackup, len(records)+1, err)
+		}
+		if seen[rec.id()] {
+			return nil, fmt.Errorf("%w: record %d: duplicate key", ErrInvalidBackup, len(records)+1)
+		}
+		seen[rec.id()] = true
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+func readBackupRecord(data []byte) (backupRecord, []byte, error) {
+	var rec backupRecord
+	if len(data) < 2 {
+		return rec, nil, io.ErrUnexpectedEOF
+	}
+	rec.role, rec.kind = bucketRole(data[0]), recordKind(data[1])
+	data = data[2:]
+
+	if role := rec.role; role < roleBlacklist || role > roleHistory {
+		return rec, nil, fmt.Errorf("unknown bucket role %d", role)
+	}
+
+	var err error
+	switch {
+	case rec.kind == recordKV:
+		rec.key, data, err = readBackupBytes(data)
+		if err != nil {
+			return rec, nil, err
+		}
+	case rec.kind == recordSortedSet && rec.role == roleBlacklist:
+		if len(data) < 8 {
+			return rec, nil, io.ErrUnexpectedEOF
+		}
+		rec.score = math.Float64frombits(binary.BigEndian.Uint64(data))
+		data = data[8:]
+	default:
+		return rec, nil, fmt.Errorf("unknown record kind %d", rec.kind)
+	}
+
+	rec.value, data, err = readBackupBytes(data)
+	if err != nil {
+		return rec, nil, err
+	}
+	return rec, data, nil
+}
+
+func readBackupBytes(data []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	data = data[n:]
+	return data[:length], data[length:], nil
+}
+
+// Restore replaces the content of all buckets with the content of an archive that was written by Backup.
+// The whole archive is read into memory and validated before the database is modified, corrupted archives
+// and archives that exceed the size limit of Backup are rejected with ErrInvalidBackup.
+// The archive is restored within a single transaction.
+// Audit entries and history of an archive are restored even if the audit log or history is disabled.
+// Signed archives are verified with WithSignature and WithKeyring, WithMutationOptions sets the actor
+// and comment of the audit entry of the restore, other import options are ignored.
+func (n *NutBreaker) Restore(r io.Reader, opts ...ImportOption) error {
+	return n.restoreArchive(r, "", opts)
+}
+
+// restoreArchive restores an archive, source names the archive in the audit log.
+func (n *NutBreaker) restoreArchive(r io.Reader, source string, opts []ImportOption) error {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return err
+	}
+	records, err := readBackup(r)
+	if err != nil {
+		return err
+	}
+
+	// buckets cannot be created and written within the same transaction,
+	// only the second transaction modifies existing data.
+	err = n.createRestoreBuckets(records)
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+
+	err = n.update(func(tx *nutsdb.Tx) error {
+		if n.audit {
+			records, err = n.auditRestore(records, source, opts)
+			if err != nil {
+				return err
+			}
+		}
+		return n.restore(tx, records)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+
+	// the restored journal may continue a sequence that is ahead of the current one
+	err = n.db.View(n.loadSeq)
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
+	return nil
+}
+
+// auditRestore appends the audit entry of the restore to the records.
+// The entry continues the sequence of the archive or of the current journal, whichever is ahead,
+// and the journal sequence of the archive is replaced, as a key cannot be written twice.
+func (n *NutBreaker) auditRestore(records []backupRecord, source string, opts []ImportOption) ([]backupRecord, error) {
+	seqID := backupRecordID{roleMetadata, recordKV, string(journalSeqKey)}
+	seq := n.seq.Load()
+	idx := -1
+	for i, rec := range records {
+		if rec.id() != seqID {
+			continue
+		}
+		idx = i
+		if len(rec.value) == 4 {
+			seq = max(seq, binary.BigEndian.Uint32(rec.value))
+		}
+	}
+	seq++
+
+	entry := n.bulkAuditEntry(AuditRestore, source, newImportOptions(opts).mutationOpts)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	seqRecord := backupRecord{role: roleMetadata, kind: recordKV, key: journalSeqKey, value: binary.BigEndian.AppendUint32(nil, seq)}
+	records = slices.Clone(records)
+	if idx >= 0 {
+		records[idx] = seqRecord
+	} else {
+		records = append(records, seqRecord)
+	}
+	return append(records, backupRecord{role: roleAudit, kind: recordKV, key: timeKey(entry.Time, seq), value: data}), nil
+}
+
+// createRestoreBuckets creates the buckets that are contained in the records but are missing,
+// e.g. because the audit log is disabled.
+func (n *NutBreaker) createRestoreBuckets(records []backupRecord) error {
+	var missing []string
+	for _, rec := range records {
+		bucket := n.bucketName(rec.role)
+		if rec.kind == recordKV && !slices.Contains(missing, bucket) {
+			missing = append(missing, bucket)
+		}
+	}
+	// the audit entry of the restore is written to the configured audit log
+	if n.audit && !slices.Contains(missing, n.auditBucket) {
+		missing = append(missing, n.auditBucket)
+	}
+	return n.update(func(tx *nutsdb.Tx) error {
+		for _, bucket := range missing {
+			if tx.ExistBucket(nutsdb.DataStructureBTree, bucket) {
+				continue
+			}
+			err := tx.NewKVBucket(bucket)
+			if err != nil {
+				return fmt.Errorf("failed to create %s kv bucket: %w", bucket, err)
+			}
+		}
+		return nil
+	})
+}
+
+// restore writes the records and deletes all keys and members that are not part of the archive.
+// Every key is written at most once, as nutsdb does not support multiple writes of a key within
+// the same transaction.
+func (n *NutBreaker) restore(tx *nutsdb.Tx, records []backupRecord) error {
+	restored := make(map[backupRecordID]bool, len(records))
+	for _, rec := range records {
+		restored[rec.id()] = true
+	}
+
+	for _, role := range bucketRoles {
+		bucket := n.bucketName(role)
+		if tx.ExistBucket(nutsdb.DataStructureBTree, bucket) {
+			keys, err := tx.GetKeys(bucket)
+			if err != nil {
+				return fmt.Errorf("failed to read %s bucket: %w", bucket, err)
+			}
+			for _, key := range keys {
+				if restored[backupRecordID{role, recordKV, string(key)}] {
+					continue
+				}
+				err = tx.Delete(bucket, key)
+				if err != nil {
+					return fmt.Errorf("failed to delete %s key: %w", bucket, err)
+				}
+			}
+		}
+
+		if role != roleBlacklist || !tx.ExistBucket(nutsdb.DataStructureSortedSet, bucket) {
+			continue
+		}
+		members, err := n.sortedSetMembers(tx)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			if restored[backupRecordID{role, recordSortedSet, string(m.Value)}] {
+				continue
+			}
+			err = tx.ZRem(bucket, n.blacklistSortedSetKey, m.Value)
+			if err != nil {
+				return fmt.Errorf("failed to delete %s sorted set member: %w", bucket, err)
+			}
+		}
+	}
+
+	for _, rec := range records {
+		bucket := n.bucketName(rec.role)
+
+		var err error
+		if rec.kind == recordKV {
+			err = tx.Put(bucket, rec.key, rec.value, 0)
+		} else {
+			err = tx.ZAdd(bucket, n.blacklistSortedSetKey, rec.score, rec.value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to restore %s bucket: %w", bucket, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ndb, _, cleanup := initAuditDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("10.0.0.0/24", []byte("vpn"), WithActor("alice"))
+	require.NoError(err)
+	require.NoError(ndb.Snapshot("before"))
+	_, err = ndb.Insert("10.0.0.128 - 10.0.1.10", []byte{0xff, 0x00})
+	require.NoError(err)
+	f, err := os.Open("testdata/spamhaus_drop.txt")
+	require.NoError(err)
+	_, err = ndb.ImportSpamhaus(f)
+	f.Close()
+	require.NoError(err)
+
+	var archive bytes.Buffer
+	require.NoError(ndb.Backup(&archive))
+
+	other, otherCleanup := initDB(t)
+	defer otherCleanup()
+	_, err = other.Insert("1.2.3.4", []byte("stale"))
+	require.NoError(err)
+	require.NoError(other.Snapshot("stale"))
+
+	require.NoError(other.Restore(bytes.NewReader(archive.Bytes())))
+	consistent(t, other)
+
+	// restoring is lossless, the restored database results in the same archive
+	var restored bytes.Buffer
+	require.NoError(other.Backup(&restored))
+	require.Equal(archive.Bytes(), restored.Bytes())
+
+	expected, err := ndb.exportRanges(exportOptions{})
+	require.NoError(err)
+	actual, err := other.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.Equal(expected, actual)
+
+	snapshots, err := other.ListSnapshots()
+	require.NoError(err)
+	require.Len(snapshots, 1)
+	require.Equal("before", snapshots[0].Name)
+	require.NoError(other.RestoreSnapshot("before"))
+	value, err := other.Find("10.0.0.200")
+	require.NoError(err)
+	require.Equal("vpn", string(value))
+
+	meta, err := other.AllMetadata()
+	require.NoError(err)
+	require.Len(meta, 1)
+}
+
+func TestRestoreCorrupted(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("10.0.0.0/24", []byte("vpn"))
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	require.NoError(ndb.Backup(&buf))
+	archive := buf.Bytes()
+
+	other, otherCleanup := initDB(t)
+	defer otherCleanup()
+	_, err = other.Insert("1.2.3.4", []byte("untouched"))
+	require.NoError(err)
+
+	corrupt := func(fn func(b []byte) []byte) []byte {
+		return fn(bytes.Clone(archive))
+	}
+	tests := []struct {
+		name    string
+		archive []byte
+		err     error
+	}{
+		{"empty", nil, ErrInvalidBackup},
+		{"magic", corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), ErrInvalidBackup},
+		{"version", corrupt(func(b []byte) []byte { b[9] = 2; return b }), ErrUnsupportedBackupVersion},
+		{"truncated", archive[:len(archive)-1], ErrInvalidBackup},
+		{"payload", corrupt(func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b }), ErrInvalidBackup},
+		{"checksum", corrupt(func(b []byte) []byte { b[backupHeaderSize-1] ^= 0xff; return b }), ErrInvalidBackup},
+		{"length", corrupt(func(b []byte) []byte {
+			binary.BigEndian.PutUint64(b[12:], maxBackupPayloadSize+1)
+			return b
+		}), ErrInvalidBackup},
+	}
+	for _, tt := range tests {
+		err = other.Restore(bytes.NewReader(tt.archive))
+		require.ErrorIs(err, tt.err, tt.name)
+	}
+
+	value, err := other.Find("1.2.3.4")
+	require.NoError(err)
+	require.Equal("untouched", string(value))
+	consistent(t, other)
+
+	_, err = readBackup(strings.NewReader("not a backup at all, but long enough to contain a header"))
+	require.ErrorIs(err, ErrInvalidBackup)
+}
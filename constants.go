@@ -43,8 +43,59 @@ var (
 	ErrIPv6NotSupported = errors.New("IPv6 ranges are not supported")
 
 	// ErrInvalidRange is returned when a passed string is not a valid range
-	ErrInvalidRange = errors.New("invalid range passed, use either of these: <IP>, <IP>/<1-32>, <IP> - <IP>")
+	ErrInvalidRange = errors.New("invalid range passed, use either of these: <IP>, <IP>/<0-32>, <IP>/<netmask>, <IP> - <IP>, <IP>-<octet>, <IP with trailing * octets>, <integer> - <integer>")
 
 	// ErrIPNotFound is returned if the passed IP is not contained in any ranges
 	ErrIPNotFound = errors.New("the given IP was not found in any database ranges")
+
+	// ErrTxnReadOnly is returned if a write operation is executed within a read-only transaction
+	ErrTxnReadOnly = errors.New("transaction is read-only")
+
+	// ErrAuditLogDisabled is returned if the audit log is queried without being enabled with WithAuditLog
+	ErrAuditLogDisabled = errors.New("audit log is disabled")
+
+	// ErrSnapshotNotFound is returned if a snapshot with the given name does not exist
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+
+	// ErrSnapshotExists is returned if a snapshot with the given name already exists
+	ErrSnapshotExists = errors.New("snapshot already exists")
+
+	// ErrInvalidSnapshotName is returned if a snapshot name cannot be used
+	ErrInvalidSnapshotName = errors.New("invalid snapshot name")
+
+	// ErrHistoryDisabled is returned if the history is queried without being enabled with WithHistory
+	ErrHistoryDisabled = errors.New("history is disabled")
+
+	// ErrHistoryUnavailable is returned if the history is queried for a point in time that is not recorded
+	ErrHistoryUnavailable = errors.New("history is not available for the requested point in time")
+
+	// ErrMetadataNotFound is returned if no metadata is stored for a list with the given name
+	ErrMetadataNotFound = errors.New("list metadata not found")
+
+	// ErrInvalidListFormat is returned if an imported file does not match the expected format
+	ErrInvalidListFormat = errors.New("invalid list format")
+
+	// ErrInvalidCommunity is returned if a BGP community of an exported route is neither a standard nor a large community
+	ErrInvalidCommunity = errors.New("invalid BGP community")
+
+	// ErrInvalidBackup is returned if a restored archive is truncated, corrupted or not a backup at all
+	ErrInvalidBackup = errors.New("invalid backup archive")
+
+	// ErrUnsupportedBackupVersion is returned if a restored archive was written by a newer format version
+	ErrUnsupportedBackupVersion = errors.New("unsupported backup format version")
+
+	// ErrUnsigned is returned if signature verification is required but the input is not signed
+	ErrUnsigned = errors.New("input is not signed")
+
+	// ErrUntrustedKey is returned if the input is signed with a key that is not part of the trusted keyring
+	ErrUntrustedKey = errors.New("signature key is not trusted")
+
+	// ErrInvalidSignature is returned if a signature is malformed or does not match the signed input
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrIntegrityCheckFailed is returned by NewNutBreaker if the range index is inconsistent and cannot be recovered
+	ErrIntegrityCheckFailed = errors.New("database integrity check failed")
+
+	// ErrReadOnly is returned by write operations if the database was opened read-only after a failed integrity check
+	ErrReadOnly = errors.New("database is read-only")
 )
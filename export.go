@@ -0,0 +1,74 @@
+package nutbreaker
+
+import "bytes"
+
+// ExportOption configures all exporters.
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	filter func(r Range) bool
+
+	setName   string
+	tableName string
+	chainName string
+
+	mapValue     func(value []byte) string
+	variable     string
+	defaultValue string
+
+	protocolName string
+	communities  func(value []byte) []string
+	routeTag     func(value []byte) uint32
+
+	partLimit int
+	scope     string
+
+	databaseType string
+	description  string
+	valueKey     string
+}
+
+func newExportOptions(opts []ExportOption) exportOptions {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithExportFilter only exports the ranges for which fn returns true.
+func WithExportFilter(fn func(r Range) bool) ExportOption {
+	return func(o *exportOptions) {
+		o.filter = fn
+	}
+}
+
+// WithExportValues only exports the ranges with one of the given values.
+func WithExportValues(values ...string) ExportOption {
+	allowed := make(map[string]bool, len(values))
+	for _, v := range values {
+		allowed[v] = true
+	}
+	return WithExportFilter(func(r Range) bool {
+		return allowed[string(r.Value)]
+	})
+}
+
+// exportRanges returns a consistent copy of all ranges that match the filter.
+func (n *NutBreaker) exportRanges(o exportOptions) ([]Range, error) {
+	var result []Range
+	err := n.View(func(tx *Txn) error {
+		return tx.Iterate(func(r Range) bool {
+			if o.filter != nil && !o.filter(r) {
+				return true
+			}
+			r.Value = bytes.Clone(r.Value)
+			result = append(result, r)
+			return true
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,150 @@
+package nutbreaker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+const defaultFirewallName = "nutbreaker"
+
+// maximum comment length that is accepted by ipset, nftables and iptables
+const maxFirewallCommentLength = 128
+
+// WithSetName sets the name of the exported ipset or nftables set, defaults to "nutbreaker".
+func WithSetName(name string) ExportOption {
+	return func(o *exportOptions) {
+		o.setName = name
+	}
+}
+
+// WithTableName sets the name of the exported nftables table, defaults to "nutbreaker".
+func WithTableName(name string) ExportOption {
+	return func(o *exportOptions) {
+		o.tableName = name
+	}
+}
+
+// WithChainName sets the name of the exported iptables chain, defaults to "NUTBREAKER".
+func WithChainName(name string) ExportOption {
+	return func(o *exportOptions) {
+		o.chainName = name
+	}
+}
+
+// ExportIPSet writes an `ipset restore` script that creates a hash:net set with the CIDR
+// decomposition of all ranges. The value of every range is stored as comment of its entries.
+func (n *NutBreaker) ExportIPSet(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+	name := defaultString(o.setName, defaultFirewallName)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	// hash:net does not accept a /0 network, it is split into two /1 networks
+	prefixes := make([][]netip.Prefix, len(ranges))
+	entries := 0
+	for i, r := range ranges {
+		prefixes[i] = splitPrefixes(r.Prefixes(), 1)
+		entries += len(prefixes[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "create %s hash:net family inet hashsize 1024 maxelem %d comment\n", name, max(65536, entries))
+	for i, r := range ranges {
+		comment := firewallComment(r.Value)
+		for _, p := range prefixes[i] {
+			fmt.Fprintf(bw, "add %s %s comment \"%s\"\n", name, p, comment)
+		}
+	}
+	return bw.Flush()
+}
+
+// ExportNFTables writes an nftables table with an interval set that contains all ranges.
+// The value of every range is stored as comment of its element.
+func (n *NutBreaker) ExportNFTables(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+	table := defaultString(o.tableName, defaultFirewallName)
+	set := defaultString(o.setName, defaultFirewallName)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "table inet %s {\n", table)
+	fmt.Fprintf(bw, "\tset %s {\n", set)
+	fmt.Fprintf(bw, "\t\ttype ipv4_addr\n")
+	fmt.Fprintf(bw, "\t\tflags interval\n")
+	if len(ranges) > 0 {
+		fmt.Fprintf(bw, "\t\telements = {\n")
+		for i, r := range ranges {
+			sep := ","
+			if i == len(ranges)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(bw, "\t\t\t%s comment \"%s\"%s\n", nftElement(r), firewallComment(r.Value), sep)
+		}
+		fmt.Fprintf(bw, "\t\t}\n")
+	}
+	fmt.Fprintf(bw, "\t}\n")
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// ExportIPTables writes an `iptables-restore` script with a chain that drops the CIDR
+// decomposition of all ranges. The value of every range is stored as comment of its rules.
+func (n *NutBreaker) ExportIPTables(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+	chain := defaultString(o.chainName, strings.ToUpper(defaultFirewallName))
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "*filter\n")
+	fmt.Fprintf(bw, ":%s - [0:0]\n", chain)
+	for _, r := range ranges {
+		comment := firewallComment(r.Value)
+		for _, p := range r.Prefixes() {
+			fmt.Fprintf(bw, "-A %s -s %s -m comment --comment \"%s\" -j DROP\n", chain, p, comment)
+		}
+	}
+	fmt.Fprintf(bw, "COMMIT\n")
+	return bw.Flush()
+}
+
+// nftElement returns a single IP, a CIDR or an interval.
+func nftElement(r Range) string {
+	if prefixes := r.Prefixes(); len(prefixes) == 1 {
+		if prefixes[0].IsSingleIP() {
+			return prefixes[0].Addr().String()
+		}
+		return prefixes[0].String()
+	}
+	return fmt.Sprintf("%s-%s", r.Low, r.High)
+}
+
+// firewallComment returns a comment that can be quoted in all firewall formats.
+func firewallComment(value []byte) string {
+	comment := strings.NewReplacer(`"`, "'", `\`, "'").Replace(configValue(string(value)))
+
+	if len(comment) > maxFirewallCommentLength {
+		comment = strings.ToValidUTF8(comment[:maxFirewallCommentLength], "")
+	}
+	return comment
+}
+
+func defaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,77 @@
+package nutbreaker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"unicode/utf8"
+)
+
+// jsonRange is the interchange representation of a range.
+// Values that are valid UTF-8 are stored as string, all other values base64 encoded.
+type jsonRange struct {
+	Low         netip.Addr     `json:"low"`
+	High        netip.Addr     `json:"high"`
+	CIDRs       []netip.Prefix `json:"cidrs,omitempty"`
+	Value       *string        `json:"value,omitempty"`
+	ValueBase64 []byte         `json:"value_base64,omitempty"`
+}
+
+func newJSONRange(r Range) jsonRange {
+	jr := jsonRange{
+		Low:   r.Low,
+		High:  r.High,
+		CIDRs: r.Prefixes(),
+	}
+	if utf8.Valid(r.Value) {
+		value := string(r.Value)
+		jr.Value = &value
+	} else {
+		jr.ValueBase64 = r.Value
+	}
+	return jr
+}
+
+// ExportJSON writes all ranges as JSON array with one object per range, e.g.
+// {"low":"10.0.0.0","high":"10.0.0.255","cidrs":["10.0.0.0/24"],"value":"vpn"}.
+// Values that are not valid UTF-8 are written base64 encoded as "value_base64".
+func (n *NutBreaker) ExportJSON(w io.Writer, opts ...ExportOption) error {
+	return n.exportJSON(w, newExportOptions(opts), "[\n", ",\n", "\n]\n")
+}
+
+// ExportJSONL writes all ranges in the JSON Lines format with one object per line,
+// see ExportJSON for the format of the objects.
+func (n *NutBreaker) ExportJSONL(w io.Writer, opts ...ExportOption) error {
+	return n.exportJSON(w, newExportOptions(opts), "", "\n", "\n")
+}
+
+func (n *NutBreaker) exportJSON(w io.Writer, o exportOptions, prefix, sep, suffix string) error {
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if len(ranges) == 0 {
+		if prefix != "" {
+			fmt.Fprint(bw, "[]\n")
+		}
+		return bw.Flush()
+	}
+
+	fmt.Fprint(bw, prefix)
+	for i, r := range ranges {
+		if i > 0 {
+			fmt.Fprint(bw, sep)
+		}
+		data, err := json.Marshal(newJSONRange(r))
+		if err != nil {
+			return fmt.Errorf("failed to encode range %s: %w", r, err)
+		}
+		bw.Write(data)
+	}
+	fmt.Fprint(bw, suffix)
+	return bw.Flush()
+}
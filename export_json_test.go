@@ -0,0 +1,93 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportJSONValueEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"empty", "", `"value":""`},
+		{"escaped", "\"a\"\n<b>\\", `"value":"\"a\"\n\u003cb\u003e\\"`},
+		{"control characters", "\x00\x7f\t", "\"value\":\"\\u0000\x7f\\t\""},
+		{"multibyte", "ä😀", `"value":"ä😀"`},
+		{"line separator", "\u2028", `"value":"\u2028"`},
+		{"invalid utf-8", "\xff", `"value_base64":"/w=="`},
+		{"truncated utf-8", "a\xc3", `"value_base64":"YcM="`},
+		{"surrogate", "\xed\xa0\x80", `"value_base64":"7aCA"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ndb, cleanup := initRangesDB(t, "10.0.0.1", tt.value)
+			defer cleanup()
+
+			var buf bytes.Buffer
+			require.NoError(t, ndb.ExportJSONL(&buf))
+			require.Equal(t, `{"low":"10.0.0.1","high":"10.0.0.1","cidrs":["10.0.0.1/32"],`+tt.expected+"}\n", buf.String())
+		})
+	}
+}
+
+func TestExportJSONArray(t *testing.T) {
+	ndb, cleanup := initRangesDB(t, "10.0.0.1", "a", "10.0.0.3 - 10.0.0.4", "\xff")
+	defer cleanup()
+	require := require.New(t)
+
+	// one object per line, which keeps the diffs of exported lists small
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportJSON(&buf))
+	require.Equal("[\n"+
+		`{"low":"10.0.0.1","high":"10.0.0.1","cidrs":["10.0.0.1/32"],"value":"a"},`+"\n"+
+		`{"low":"10.0.0.3","high":"10.0.0.4","cidrs":["10.0.0.3/32","10.0.0.4/32"],"value_base64":"/w=="}`+"\n"+
+		"]\n", buf.String())
+}
+
+func TestJSONNonUTF8RoundTrip(t *testing.T) {
+	formats := []struct {
+		name    string
+		export  func(*NutBreaker, io.Writer, ...ExportOption) error
+		imports func(*NutBreaker, io.Reader, ...ImportOption) (ImportResult, error)
+	}{
+		{"json", (*NutBreaker).ExportJSON, (*NutBreaker).ImportJSON},
+		{"jsonl", (*NutBreaker).ExportJSONL, (*NutBreaker).ImportJSONL},
+	}
+
+	ndb, cleanup := initRangesDB(t,
+		"10.0.0.1", "\xff",
+		"10.0.0.2", "\x00\xff",
+		"10.0.0.3 - 10.0.0.9", "valid\xc0",
+		"10.0.1.0/24", "\xed\xa0\x80",
+		"10.0.2.1", "ä",
+	)
+	defer cleanup()
+
+	expected, err := ndb.exportRanges(exportOptions{})
+	require.NoError(t, err)
+
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			require := require.New(t)
+
+			var buf bytes.Buffer
+			require.NoError(f.export(ndb, &buf))
+
+			other, otherCleanup := initDB(t)
+			defer otherCleanup()
+			result, err := f.imports(other, &buf)
+			require.NoError(err)
+			require.Empty(result.Errors)
+
+			actual, err := other.exportRanges(exportOptions{})
+			require.NoError(err)
+			require.Equal(expected, actual)
+			consistent(t, other)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// WithDatabaseType sets the database type of an exported MaxMind DB, defaults to "nutbreaker".
+func WithDatabaseType(databaseType string) ExportOption {
+	return func(o *exportOptions) {
+		o.databaseType = databaseType
+	}
+}
+
+// WithDescription sets the english description of an exported MaxMind DB.
+func WithDescription(description string) ExportOption {
+	return func(o *exportOptions) {
+		o.description = description
+	}
+}
+
+// WithValueKey sets the key of the record field that contains the value of a range
+// in an exported MaxMind DB, defaults to "value".
+func WithValueKey(key string) ExportOption {
+	return func(o *exportOptions) {
+		o.valueKey = key
+	}
+}
+
+// ExportMMDB writes all ranges as IPv4 MaxMind DB whose records are maps with the value of the range,
+// e.g. {"value": "vpn"}, which allows to look up the value with the geoip2 modules of nginx or HAProxy.
+// Values that are not valid UTF-8 are stored as bytes.
+func (n *NutBreaker) ExportMMDB(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+	if o.databaseType == "" {
+		o.databaseType = "nutbreaker"
+	}
+	if o.valueKey == "" {
+		o.valueKey = "value"
+	}
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	mw := newMMDBWriter()
+	for _, r := range ranges {
+		var value any = string(r.Value)
+		if !utf8.Valid(r.Value) {
+			value = r.Value
+		}
+		record := map[string]any{o.valueKey: value}
+
+		for _, prefix := range r.Prefixes() {
+			err = mw.insert(prefix, record)
+			if err != nil {
+				return fmt.Errorf("failed to export %s: %w", r, err)
+			}
+		}
+	}
+
+	meta := map[string]any{
+		"database_type": o.databaseType,
+		"languages":     []string{"en"},
+		"build_epoch":   uint64(n.now().Unix()),
+		"description":   map[string]any{},
+	}
+	if o.description != "" {
+		meta["description"] = map[string]any{"en": o.description}
+	}
+
+	var buf bytes.Buffer
+	err = mw.write(&buf, meta)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
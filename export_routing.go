@@ -0,0 +1,208 @@
+package nutbreaker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// well-known BLACKHOLE community, see RFC 7999
+const blackholeCommunity = "65535:666"
+
+// WithProtocolName sets the name of the exported BIRD static protocol, defaults to "nutbreaker".
+func WithProtocolName(name string) ExportOption {
+	return func(o *exportOptions) {
+		o.protocolName = name
+	}
+}
+
+// WithCommunities derives the BGP communities of the routes of a range from its value.
+// Standard communities are formatted as "<asn>:<value>", large communities as "<asn>:<data1>:<data2>".
+// Routes are annotated with the BLACKHOLE community 65535:666 by default.
+func WithCommunities(fn func(value []byte) []string) ExportOption {
+	return func(o *exportOptions) {
+		o.communities = fn
+	}
+}
+
+// WithRouteTag derives the tag of the FRR routes of a range from its value.
+// Routes with the tag 0 are not tagged, which is the default.
+func WithRouteTag(fn func(value []byte) uint32) ExportOption {
+	return func(o *exportOptions) {
+		o.routeTag = fn
+	}
+}
+
+// ExportBIRD writes a BIRD 2 static protocol with a blackhole route for every network of the CIDR
+// decomposition of all ranges. The routes are annotated with the BGP communities of their values.
+func (n *NutBreaker) ExportBIRD(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "protocol static %s {\n", defaultString(o.protocolName, defaultFirewallName))
+	fmt.Fprintf(bw, "\tipv4;\n")
+	for _, r := range ranges {
+		communities, err := o.routeCommunities(r.Value)
+		if err != nil {
+			return err
+		}
+
+		var attrs strings.Builder
+		for _, c := range communities {
+			attr := "bgp_community"
+			if len(c) == 3 {
+				attr = "bgp_large_community"
+			}
+			fmt.Fprintf(&attrs, " %s.add((%s));", attr, joinUint32(c, ", "))
+		}
+
+		if comment := configValue(string(r.Value)); comment != "" {
+			fmt.Fprintf(bw, "\t# %s\n", comment)
+		}
+		for _, p := range r.Prefixes() {
+			if attrs.Len() == 0 {
+				fmt.Fprintf(bw, "\troute %s blackhole;\n", p)
+			} else {
+				fmt.Fprintf(bw, "\troute %s blackhole {%s };\n", p, attrs.String())
+			}
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// ExportFRR writes FRR static blackhole routes for every network of the CIDR decomposition of all ranges.
+// The routes are tagged with the tag set with WithRouteTag.
+func (n *NutBreaker) ExportFRR(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, r := range ranges {
+		var tag string
+		if o.routeTag != nil {
+			if t := o.routeTag(r.Value); t != 0 {
+				tag = fmt.Sprintf(" tag %d", t)
+			}
+		}
+
+		if comment := configValue(string(r.Value)); comment != "" {
+			fmt.Fprintf(bw, "! %s\n", comment)
+		}
+		for _, p := range r.Prefixes() {
+			fmt.Fprintf(bw, "ip route %s blackhole%s\n", p, tag)
+		}
+	}
+	return bw.Flush()
+}
+
+// ExportFlowSpec writes ExaBGP flow routes that discard the traffic from every network of the CIDR
+// decomposition of all ranges. The routes are annotated with the BGP communities of their values.
+func (n *NutBreaker) ExportFlowSpec(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "flow {\n")
+	for _, r := range ranges {
+		communities, err := o.routeCommunities(r.Value)
+		if err != nil {
+			return err
+		}
+
+		var standard, large []string
+		for _, c := range communities {
+			if len(c) == 3 {
+				large = append(large, joinUint32(c, ":"))
+			} else {
+				standard = append(standard, joinUint32(c, ":"))
+			}
+		}
+
+		if comment := configValue(string(r.Value)); comment != "" {
+			fmt.Fprintf(bw, "\t# %s\n", comment)
+		}
+		for _, p := range r.Prefixes() {
+			fmt.Fprintf(bw, "\troute {\n")
+			fmt.Fprintf(bw, "\t\tmatch {\n")
+			fmt.Fprintf(bw, "\t\t\tsource %s;\n", p)
+			fmt.Fprintf(bw, "\t\t}\n")
+			fmt.Fprintf(bw, "\t\tthen {\n")
+			fmt.Fprintf(bw, "\t\t\tdiscard;\n")
+			if len(standard) > 0 {
+				fmt.Fprintf(bw, "\t\t\tcommunity [ %s ];\n", strings.Join(standard, " "))
+			}
+			if len(large) > 0 {
+				fmt.Fprintf(bw, "\t\t\tlarge-community [ %s ];\n", strings.Join(large, " "))
+			}
+			fmt.Fprintf(bw, "\t\t}\n")
+			fmt.Fprintf(bw, "\t}\n")
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// routeCommunities returns the parsed communities of a value.
+func (o exportOptions) routeCommunities(value []byte) ([][]uint32, error) {
+	communities := []string{blackholeCommunity}
+	if o.communities != nil {
+		communities = o.communities(value)
+	}
+
+	result := make([][]uint32, 0, len(communities))
+	for _, c := range communities {
+		parsed, err := parseCommunity(c)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// parseCommunity parses a standard community with two 16 bit or a large community with three 32 bit parts.
+func parseCommunity(s string) ([]uint32, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCommunity, s)
+	}
+
+	bitSize := 32
+	if len(parts) == 2 {
+		bitSize = 16
+	}
+
+	result := make([]uint32, 0, len(parts))
+	for _, p := range parts {
+		v, err := strconv.ParseUint(p, 10, bitSize)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCommunity, s)
+		}
+		result = append(result, uint32(v))
+	}
+	return result, nil
+}
+
+func joinUint32(values []uint32, sep string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, strconv.FormatUint(uint64(v), 10))
+	}
+	return strings.Join(parts, sep)
+}
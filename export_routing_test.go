@@ -0,0 +1,197 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingExport(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+
+	communities := WithCommunities(func(value []byte) []string {
+		if string(value) == "tor" {
+			return []string{"65535:666", "64496:1:2"}
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name     string
+		export   func(*bytes.Buffer) error
+		expected string
+	}{
+		{
+			name: "bird",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportBIRD(b, WithExportValues("vpn", "tor"), WithProtocolName("blackhole"), communities)
+			},
+			expected: "protocol static blackhole {\n" +
+				"\tipv4;\n" +
+				"\t# vpn\n" +
+				"\troute 10.0.0.3/32 blackhole;\n" +
+				"\troute 10.0.0.4/30 blackhole;\n" +
+				"\troute 10.0.0.8/31 blackhole;\n" +
+				"\troute 10.0.0.10/32 blackhole;\n" +
+				"\t# tor\n" +
+				"\troute 10.0.2.0/24 blackhole { bgp_community.add((65535, 666)); bgp_large_community.add((64496, 1, 2)); };\n" +
+				"}\n",
+		},
+		{
+			name: "frr",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportFRR(b, WithExportValues("tor", `say "hi"`), WithRouteTag(func(value []byte) uint32 {
+					if string(value) == "tor" {
+						return 666
+					}
+					return 0
+				}))
+			},
+			expected: "! tor\n" +
+				"ip route 10.0.2.0/24 blackhole tag 666\n" +
+				"! say \"hi\"\n" +
+				"ip route 192.168.1.1/32 blackhole\n",
+		},
+		{
+			name: "flowspec",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportFlowSpec(b, WithExportValues("tor"))
+			},
+			expected: "flow {\n" +
+				"\t# tor\n" +
+				"\troute {\n" +
+				"\t\tmatch {\n" +
+				"\t\t\tsource 10.0.2.0/24;\n" +
+				"\t\t}\n" +
+				"\t\tthen {\n" +
+				"\t\t\tdiscard;\n" +
+				"\t\t\tcommunity [ 65535:666 ];\n" +
+				"\t\t}\n" +
+				"\t}\n" +
+				"}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, tt.export(&buf))
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+
+	var buf bytes.Buffer
+	err := ndb.ExportBIRD(&buf, WithCommunities(func([]byte) []string { return []string{"65536:1"} }))
+	require.ErrorIs(t, err, ErrInvalidCommunity)
+}
+
+func TestExportBIRDCommunities(t *testing.T) {
+	ndb, cleanup := initRangesDB(t, "10.0.0.0/31", "tor", "10.0.1.1", "vpn", "10.0.2.1", "")
+	defer cleanup()
+	require := require.New(t)
+
+	// routes are annotated with the BLACKHOLE community by default
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportBIRD(&buf))
+	require.Equal("protocol static nutbreaker {\n"+
+		"\tipv4;\n"+
+		"\t# tor\n"+
+		"\troute 10.0.0.0/31 blackhole { bgp_community.add((65535, 666)); };\n"+
+		"\t# vpn\n"+
+		"\troute 10.0.1.1/32 blackhole { bgp_community.add((65535, 666)); };\n"+
+		"\troute 10.0.2.1/32 blackhole { bgp_community.add((65535, 666)); };\n"+
+		"}\n", buf.String())
+
+	// standard and large communities are derived from the value, routes without communities have no attributes
+	buf.Reset()
+	require.NoError(ndb.ExportBIRD(&buf, WithProtocolName("rtbh"), WithCommunities(func(value []byte) []string {
+		switch string(value) {
+		case "tor":
+			return []string{"64496:0", "4294967295:1:2"}
+		case "vpn":
+			return []string{"64496:65535"}
+		}
+		return nil
+	})))
+	require.Equal("protocol static rtbh {\n"+
+		"\tipv4;\n"+
+		"\t# tor\n"+
+		"\troute 10.0.0.0/31 blackhole { bgp_community.add((64496, 0)); bgp_large_community.add((4294967295, 1, 2)); };\n"+
+		"\t# vpn\n"+
+		"\troute 10.0.1.1/32 blackhole { bgp_community.add((64496, 65535)); };\n"+
+		"\troute 10.0.2.1/32 blackhole;\n"+
+		"}\n", buf.String())
+
+	for _, community := range []string{"65536:1", "1:2:4294967296", "a:b"} {
+		err := ndb.ExportBIRD(io.Discard, WithCommunities(func([]byte) []string { return []string{community} }))
+		require.ErrorIs(err, ErrInvalidCommunity, community)
+	}
+}
+
+func TestExportFRRRouteTags(t *testing.T) {
+	ndb, cleanup := initRangesDB(t, "10.0.0.0 - 10.0.0.2", "tor", "10.0.1.1", "vpn")
+	defer cleanup()
+	require := require.New(t)
+
+	// routes are not tagged by default
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportFRR(&buf))
+	require.Equal("! tor\n"+
+		"ip route 10.0.0.0/31 blackhole\n"+
+		"ip route 10.0.0.2/32 blackhole\n"+
+		"! vpn\n"+
+		"ip route 10.0.1.1/32 blackhole\n", buf.String())
+
+	// every route of a range carries the tag of its value, the tag 0 is omitted
+	buf.Reset()
+	require.NoError(ndb.ExportFRR(&buf, WithRouteTag(func(value []byte) uint32 {
+		if string(value) == "tor" {
+			return 4294967295
+		}
+		return 0
+	})))
+	require.Equal("! tor\n"+
+		"ip route 10.0.0.0/31 blackhole tag 4294967295\n"+
+		"ip route 10.0.0.2/32 blackhole tag 4294967295\n"+
+		"! vpn\n"+
+		"ip route 10.0.1.1/32 blackhole\n", buf.String())
+}
+
+func TestExportFlowSpecMatch(t *testing.T) {
+	ndb, cleanup := initRangesDB(t, "10.0.0.0 - 10.0.0.2", "tor")
+	defer cleanup()
+	require := require.New(t)
+
+	route := func(source string, then ...string) string {
+		return "\troute {\n\t\tmatch {\n\t\t\tsource " + source + ";\n\t\t}\n\t\tthen {\n\t\t\tdiscard;\n" +
+			strings.Join(then, "") + "\t\t}\n\t}\n"
+	}
+
+	// every network of the decomposition is matched by its own route
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportFlowSpec(&buf))
+	blackhole := "\t\t\tcommunity [ 65535:666 ];\n"
+	require.Equal("flow {\n\t# tor\n"+route("10.0.0.0/31", blackhole)+route("10.0.0.2/32", blackhole)+"}\n", buf.String())
+
+	// standard and large communities are separate attributes
+	buf.Reset()
+	require.NoError(ndb.ExportFlowSpec(&buf, WithCommunities(func([]byte) []string {
+		return []string{"65535:666", "64496:1:2", "64496:0"}
+	})))
+	communities := []string{"\t\t\tcommunity [ 65535:666 64496:0 ];\n", "\t\t\tlarge-community [ 64496:1:2 ];\n"}
+	require.Equal("flow {\n\t# tor\n"+route("10.0.0.0/31", communities...)+route("10.0.0.2/32", communities...)+"}\n", buf.String())
+
+	// traffic is discarded without communities
+	buf.Reset()
+	require.NoError(ndb.ExportFlowSpec(&buf, WithCommunities(func([]byte) []string { return nil })))
+	require.Equal("flow {\n\t# tor\n"+route("10.0.0.0/31")+route("10.0.0.2/32")+"}\n", buf.String())
+
+	for _, community := range []string{"", "1", "1:2:3:4", "-1:2", "1:4294967296:0"} {
+		err := ndb.ExportFlowSpec(io.Discard, WithCommunities(func([]byte) []string { return []string{community} }))
+		require.ErrorIs(err, ErrInvalidCommunity, community)
+	}
+}
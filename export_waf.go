@@ -0,0 +1,204 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+)
+
+const (
+	// maximum number of addresses of an AWS WAF IP set
+	awsWAFIPSetLimit = 10000
+	// maximum number of items of a Cloudflare IP list
+	cloudflareListLimit = 10000
+	// shortest IPv4 prefix that is accepted by Cloudflare IP lists
+	cloudflareMinPrefixBits = 8
+)
+
+// PartWriter returns the writer of the part with the given zero based index of an export
+// that is split into multiple files. The writer is closed after the part was written.
+type PartWriter func(part int) (io.WriteCloser, error)
+
+// FilePartWriter returns a PartWriter that creates the files that are named by the pattern
+// with the one based part number, e.g. "waf/ipset-%d.json".
+func FilePartWriter(pattern string) PartWriter {
+	return func(part int) (io.WriteCloser, error) {
+		return os.Create(fmt.Sprintf(pattern, part+1))
+	}
+}
+
+// WithPartLimit sets the maximum number of entries of a single part of a split export.
+// Defaults to the limit of the target, e.g. 10000 addresses per AWS WAF IP set.
+func WithPartLimit(limit int) ExportOption {
+	return func(o *exportOptions) {
+		o.partLimit = limit
+	}
+}
+
+// WithScope sets the scope of an exported AWS WAF IP set, either "REGIONAL" or "CLOUDFRONT". Defaults to "REGIONAL".
+func WithScope(scope string) ExportOption {
+	return func(o *exportOptions) {
+		o.scope = scope
+	}
+}
+
+type awsWAFIPSet struct {
+	Name             string   `json:"Name"`
+	Scope            string   `json:"Scope"`
+	Description      string   `json:"Description,omitempty"`
+	IPAddressVersion string   `json:"IPAddressVersion"`
+	Addresses        []string `json:"Addresses"`
+}
+
+type cloudflareListItem struct {
+	IP      string `json:"ip"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// ExportAWSWAF writes the CIDR decomposition of all ranges as AWS WAF IP sets in the input format of
+// `aws wafv2 create-ip-set --cli-input-json`. The sets are named by WithSetName and split into multiple
+// parts with the suffix "-<part>" if they exceed the part limit. AWS WAF does not support comments of
+// single addresses, use WithExportValues in order to export a set per value.
+// Returns the number of written parts.
+func (n *NutBreaker) ExportAWSWAF(parts PartWriter, opts ...ExportOption) (int, error) {
+	o := newExportOptions(opts)
+	name := defaultString(o.setName, defaultFirewallName)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return 0, err
+	}
+
+	var addresses []string
+	for _, r := range ranges {
+		for _, p := range splitPrefixes(r.Prefixes(), 1) {
+			addresses = append(addresses, p.String())
+		}
+	}
+
+	chunks := splitParts(addresses, o.partLimitOr(awsWAFIPSetLimit))
+	for i, chunk := range chunks {
+		set := awsWAFIPSet{
+			Name:             partName(name, i, len(chunks)),
+			Scope:            defaultString(o.scope, "REGIONAL"),
+			Description:      o.description,
+			IPAddressVersion: "IPV4",
+			Addresses:        chunk,
+		}
+		err = writePart(parts, i, set)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(chunks), nil
+}
+
+// ExportCloudflare writes the CIDR decomposition of all ranges as Cloudflare IP list items in the format
+// of the bulk upload API. The value of every range is stored as comment of its items.
+// The items are split into multiple parts if they exceed the part limit.
+// Returns the number of written parts.
+func (n *NutBreaker) ExportCloudflare(parts PartWriter, opts ...ExportOption) (int, error) {
+	o := newExportOptions(opts)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return 0, err
+	}
+
+	var items []cloudflareListItem
+	for _, r := range ranges {
+		comment := configValue(o.mappedValue(r.Value))
+		for _, p := range splitPrefixes(r.Prefixes(), cloudflareMinPrefixBits) {
+			ip := p.String()
+			if p.IsSingleIP() {
+				ip = p.Addr().String()
+			}
+			items = append(items, cloudflareListItem{IP: ip, Comment: comment})
+		}
+	}
+
+	chunks := splitParts(items, o.partLimitOr(cloudflareListLimit))
+	for i, chunk := range chunks {
+		err = writePart(parts, i, chunk)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(chunks), nil
+}
+
+func (o exportOptions) partLimitOr(limit int) int {
+	if o.partLimit > 0 {
+		return o.partLimit
+	}
+	return limit
+}
+
+// splitPrefixes splits all prefixes that are shorter than minBits into prefixes with minBits bits.
+func splitPrefixes(prefixes []netip.Prefix, minBits int) []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p.Bits() >= minBits {
+			result = append(result, p)
+			continue
+		}
+
+		lo := addrToUint32(p.Addr())
+		for i := uint64(0); i < 1<<(minBits-p.Bits()); i++ {
+			addr := uint32ToAddr(lo + uint32(i<<(32-minBits)))
+			result = append(result, netip.PrefixFrom(addr, minBits))
+		}
+	}
+	return result
+}
+
+// splitParts splits entries into parts with at most limit entries. An empty list results in a single empty part.
+func splitParts[T any](entries []T, limit int) [][]T {
+	if len(entries) == 0 {
+		return [][]T{{}}
+	}
+
+	var result [][]T
+	for len(entries) > limit {
+		result = append(result, entries[:limit])
+		entries = entries[limit:]
+	}
+	return append(result, entries)
+}
+
+// partName returns name for a single part, otherwise name with the one based part number as suffix.
+func partName(name string, part, parts int) string {
+	if parts == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s-%d", name, part+1)
+}
+
+func writePart(parts PartWriter, part int, v any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode part %d: %w", part+1, err)
+	}
+
+	w, err := parts(part)
+	if err != nil {
+		return fmt.Errorf("failed to create part %d: %w", part+1, err)
+	}
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write part %d: %w", part+1, err)
+	}
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close part %d: %w", part+1, err)
+	}
+	return nil
+}
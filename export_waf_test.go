@@ -0,0 +1,79 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// requireGolden compares the written parts against the golden files named by the pattern.
+func requireGolden(t *testing.T, pattern string, export func(PartWriter) (int, error)) {
+	var parts []*bytes.Buffer
+	n, err := export(func(part int) (io.WriteCloser, error) {
+		require.Equal(t, len(parts), part)
+		parts = append(parts, &bytes.Buffer{})
+		return nopWriteCloser{parts[part]}, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, parts, n)
+
+	for i, part := range parts {
+		golden := filepath.Join("testdata", "golden", fmt.Sprintf(pattern, i+1))
+		if *updateGolden {
+			require.NoError(t, os.WriteFile(golden, part.Bytes(), 0o644))
+		}
+		expected, err := os.ReadFile(golden)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), part.String(), golden)
+	}
+}
+
+func TestWAFExport(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+
+	_, err := ndb.Insert("4.0.0.0/7", []byte("<wide>"))
+	require.NoError(t, err)
+
+	requireGolden(t, "aws_waf-%d.json", func(parts PartWriter) (int, error) {
+		return ndb.ExportAWSWAF(parts, WithSetName("blocklist"), WithDescription("blocked ranges"), WithPartLimit(4))
+	})
+	requireGolden(t, "aws_waf_cloudfront-%d.json", func(parts PartWriter) (int, error) {
+		return ndb.ExportAWSWAF(parts, WithScope("CLOUDFRONT"), WithExportValues("tor"))
+	})
+	requireGolden(t, "cloudflare-%d.json", func(parts PartWriter) (int, error) {
+		return ndb.ExportCloudflare(parts, WithPartLimit(5))
+	})
+	requireGolden(t, "cloudflare_empty-%d.json", func(parts PartWriter) (int, error) {
+		return ndb.ExportCloudflare(parts, WithExportValues("none"))
+	})
+}
+
+func TestFilePartWriter(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	dir := t.TempDir()
+	n, err := ndb.ExportCloudflare(FilePartWriter(filepath.Join(dir, "list-%d.json")), WithPartLimit(2))
+	require.NoError(err)
+	require.Equal(3, n)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(err)
+	require.Len(files, 3)
+}
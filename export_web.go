@@ -0,0 +1,144 @@
+package nutbreaker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WithValueMapper maps the stored value of every range to the value that is written to an nginx geo block
+// or a HAProxy map, e.g. to map "tor" and "vpn" to "1". The stored value is written if no mapper is set.
+// The value is also used as comment of the ranges of deny lists.
+func WithValueMapper(fn func(value []byte) string) ExportOption {
+	return func(o *exportOptions) {
+		o.mapValue = fn
+	}
+}
+
+// WithVariableName sets the name of the variable of an exported nginx geo block, defaults to "$nutbreaker".
+func WithVariableName(name string) ExportOption {
+	return func(o *exportOptions) {
+		o.variable = name
+	}
+}
+
+// WithDefaultValue sets the value of addresses that are not contained in any range of an exported nginx geo block,
+// defaults to "0".
+func WithDefaultValue(value string) ExportOption {
+	return func(o *exportOptions) {
+		o.defaultValue = value
+	}
+}
+
+// ExportNginxGeo writes an nginx geo block in ranges mode that maps every range to its value.
+func (n *NutBreaker) ExportNginxGeo(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+	variable := "$" + strings.TrimPrefix(defaultString(o.variable, defaultFirewallName), "$")
+	defaultValue := defaultString(o.defaultValue, "0")
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "geo %s {\n", variable)
+	fmt.Fprintf(bw, "\tdefault %s;\n", nginxQuote(defaultValue))
+	fmt.Fprintf(bw, "\tranges;\n")
+	for _, r := range ranges {
+		fmt.Fprintf(bw, "\t%s-%s %s;\n", r.Low, r.High, nginxQuote(o.mappedValue(r.Value)))
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// ExportNginxDeny writes an nginx include file that denies the CIDR decomposition of all ranges.
+func (n *NutBreaker) ExportNginxDeny(w io.Writer, opts ...ExportOption) error {
+	return n.exportDenyList(w, newExportOptions(opts), "", "deny %s;\n")
+}
+
+// ExportHAProxyACL writes a HAProxy ACL file with the CIDR decomposition of all ranges,
+// which can be used with `acl blocked src -f <file>`.
+func (n *NutBreaker) ExportHAProxyACL(w io.Writer, opts ...ExportOption) error {
+	return n.exportDenyList(w, newExportOptions(opts), "", "%s\n")
+}
+
+// ExportApache writes an Apache 2.4 RequireAll block that denies the CIDR decomposition of all ranges.
+func (n *NutBreaker) ExportApache(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<RequireAll>\n")
+	fmt.Fprintf(bw, "\tRequire all granted\n")
+	err := n.exportDenyList(bw, o, "\t", "\tRequire not ip %s\n")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(bw, "</RequireAll>\n")
+	return bw.Flush()
+}
+
+// ExportHAProxyMap writes a HAProxy map file that maps the CIDR decomposition of all ranges to their values,
+// which can be used with `map_ip(<file>)`.
+func (n *NutBreaker) ExportHAProxyMap(w io.Writer, opts ...ExportOption) error {
+	o := newExportOptions(opts)
+
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, r := range ranges {
+		value := configValue(o.mappedValue(r.Value))
+		for _, p := range r.Prefixes() {
+			fmt.Fprintf(bw, "%s %s\n", p, value)
+		}
+	}
+	return bw.Flush()
+}
+
+// exportDenyList writes a comment with the value of every range followed by one formatted
+// line per network of its CIDR decomposition.
+func (n *NutBreaker) exportDenyList(w io.Writer, o exportOptions, indent, format string) error {
+	ranges, err := n.exportRanges(o)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, r := range ranges {
+		if comment := configValue(o.mappedValue(r.Value)); comment != "" {
+			fmt.Fprintf(bw, "%s# %s\n", indent, comment)
+		}
+		for _, p := range r.Prefixes() {
+			fmt.Fprintf(bw, format, p)
+		}
+	}
+	return bw.Flush()
+}
+
+func (o exportOptions) mappedValue(value []byte) string {
+	if o.mapValue != nil {
+		return o.mapValue(value)
+	}
+	return string(value)
+}
+
+// configValue returns the value without invalid UTF-8 and control characters,
+// which keeps every entry of a configuration file on a single line.
+func configValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(value, ""))
+}
+
+// nginxQuote returns a double quoted nginx string.
+func nginxQuote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(configValue(value))
+	return `"` + value + `"`
+}
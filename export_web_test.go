@@ -0,0 +1,190 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebServerExport(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		export   func(*bytes.Buffer) error
+		expected string
+	}{
+		{
+			name: "nginx geo",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportNginxGeo(b, WithVariableName("blocked"), WithDefaultValue("none"))
+			},
+			expected: "geo $blocked {\n" +
+				"\tdefault \"none\";\n" +
+				"\tranges;\n" +
+				"\t10.0.0.3-10.0.0.10 \"vpn\";\n" +
+				"\t10.0.2.0-10.0.2.255 \"tor\";\n" +
+				"\t192.168.1.1-192.168.1.1 \"say \\\"hi\\\"\";\n" +
+				"}\n",
+		},
+		{
+			name: "nginx deny",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportNginxDeny(b, WithExportValues("vpn"))
+			},
+			expected: "# vpn\n" +
+				"deny 10.0.0.3/32;\n" +
+				"deny 10.0.0.4/30;\n" +
+				"deny 10.0.0.8/31;\n" +
+				"deny 10.0.0.10/32;\n",
+		},
+		{
+			name: "apache",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportApache(b, WithExportValues("tor", `say "hi"`))
+			},
+			expected: "<RequireAll>\n" +
+				"\tRequire all granted\n" +
+				"\t# tor\n" +
+				"\tRequire not ip 10.0.2.0/24\n" +
+				"\t# say \"hi\"\n" +
+				"\tRequire not ip 192.168.1.1/32\n" +
+				"</RequireAll>\n",
+		},
+		{
+			name: "haproxy map",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportHAProxyMap(b, WithValueMapper(func(value []byte) string {
+					if string(value) == "tor" {
+						return "anonymizer"
+					}
+					return "other\nline"
+				}))
+			},
+			expected: "10.0.0.3/32 otherline\n" +
+				"10.0.0.4/30 otherline\n" +
+				"10.0.0.8/31 otherline\n" +
+				"10.0.0.10/32 otherline\n" +
+				"10.0.2.0/24 anonymizer\n" +
+				"192.168.1.1/32 otherline\n",
+		},
+		{
+			name: "haproxy acl",
+			export: func(b *bytes.Buffer) error {
+				return ndb.ExportHAProxyACL(b, WithExportValues("tor"), WithValueMapper(func([]byte) string { return "" }))
+			},
+			expected: "10.0.2.0/24\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, tt.export(&buf))
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestExportNginxGeoMapping(t *testing.T) {
+	ndb, cleanup := initRangesDB(t, "10.0.0.1", "tor", "10.0.1.0 - 10.0.1.2", "C:\\dir \"x\";\n}")
+	defer cleanup()
+	require := require.New(t)
+
+	// ranges are written as they are stored, values and the default value are quoted
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportNginxGeo(&buf, WithDefaultValue(`"`)))
+	require.Equal("geo $nutbreaker {\n"+
+		"\tdefault \"\\\"\";\n"+
+		"\tranges;\n"+
+		"\t10.0.0.1-10.0.0.1 \"tor\";\n"+
+		"\t10.0.1.0-10.0.1.2 \"C:\\\\dir \\\"x\\\";}\";\n"+
+		"}\n", buf.String())
+
+	// the variable is prefixed with a single '$', values are mapped
+	buf.Reset()
+	require.NoError(ndb.ExportNginxGeo(&buf, WithVariableName("$blocked"), WithValueMapper(func(value []byte) string {
+		if string(value) == "tor" {
+			return "1"
+		}
+		return "2"
+	})))
+	require.Equal("geo $blocked {\n"+
+		"\tdefault \"0\";\n"+
+		"\tranges;\n"+
+		"\t10.0.0.1-10.0.0.1 \"1\";\n"+
+		"\t10.0.1.0-10.0.1.2 \"2\";\n"+
+		"}\n", buf.String())
+}
+
+func TestExportDenyDirectives(t *testing.T) {
+	ndb, cleanup := initRangesDB(t, "10.0.0.1 - 10.0.0.2", "tor", "10.0.1.1", "", "10.0.2.1", "x\ndeny all;")
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		export   func(io.Writer, ...ExportOption) error
+		expected string
+	}{
+		{
+			name:   "nginx deny",
+			export: ndb.ExportNginxDeny,
+			expected: "# tor\ndeny 10.0.0.1/32;\ndeny 10.0.0.2/32;\n" +
+				"deny 10.0.1.1/32;\n" +
+				"# xdeny all;\ndeny 10.0.2.1/32;\n",
+		},
+		{
+			name:   "apache",
+			export: ndb.ExportApache,
+			expected: "<RequireAll>\n\tRequire all granted\n" +
+				"\t# tor\n\tRequire not ip 10.0.0.1/32\n\tRequire not ip 10.0.0.2/32\n" +
+				"\tRequire not ip 10.0.1.1/32\n" +
+				"\t# xdeny all;\n\tRequire not ip 10.0.2.1/32\n" +
+				"</RequireAll>\n",
+		},
+		{
+			name:   "haproxy acl",
+			export: ndb.ExportHAProxyACL,
+			expected: "# tor\n10.0.0.1/32\n10.0.0.2/32\n" +
+				"10.0.1.1/32\n" +
+				"# xdeny all;\n10.0.2.1/32\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, tt.export(&buf))
+			require.Equal(t, tt.expected, buf.String())
+		})
+	}
+
+	// the mapped value is used as comment, an empty mapped value omits the comment
+	var buf bytes.Buffer
+	require.NoError(t, ndb.ExportApache(&buf, WithExportValues("tor"), WithValueMapper(func([]byte) string { return "" })))
+	require.Equal(t, "<RequireAll>\n\tRequire all granted\n\tRequire not ip 10.0.0.1/32\n\tRequire not ip 10.0.0.2/32\n</RequireAll>\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, ndb.ExportNginxDeny(&buf, WithExportValues("tor"), WithValueMapper(func([]byte) string { return "anonymizer" })))
+	require.Equal(t, "# anonymizer\ndeny 10.0.0.1/32;\ndeny 10.0.0.2/32;\n", buf.String())
+}
+
+func TestExportHAProxyMapValues(t *testing.T) {
+	ndb, cleanup := initRangesDB(t, "10.0.0.1 - 10.0.0.2", "two words", "10.0.1.1", "x\n10.0.0.3 injected")
+	defer cleanup()
+	require := require.New(t)
+
+	// every network of the decomposition is mapped to the value of its range on a single line
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportHAProxyMap(&buf))
+	require.Equal("10.0.0.1/32 two words\n10.0.0.2/32 two words\n10.0.1.1/32 x10.0.0.3 injected\n", buf.String())
+
+	buf.Reset()
+	require.NoError(ndb.ExportHAProxyMap(&buf, WithValueMapper(func(value []byte) string {
+		return fmt.Sprintf("%d", len(value))
+	})))
+	require.Equal("10.0.0.1/32 9\n10.0.0.2/32 9\n10.0.1.1/32 19\n", buf.String())
+}
@@ -0,0 +1,405 @@
+package nutbreaker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+const (
+	defaultFeedInterval   = time.Hour
+	defaultFeedBackoff    = time.Minute
+	defaultFeedMaxBackoff = time.Hour
+	// maximum size of a downloaded feed
+	maxFeedSize = 256 << 20
+	// maximum size of a downloaded signature
+	maxSignatureSize = 4 << 10
+)
+
+// FeedOption configures a FeedManager.
+type FeedOption func(*feedOptions)
+
+type feedOptions struct {
+	client     *http.Client
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// WithHTTPClient sets the client that fetches the feeds, defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) FeedOption {
+	return func(o *feedOptions) {
+		o.client = client
+	}
+}
+
+// WithBackoff sets the delay after a failed fetch, which is doubled with every consecutive failure
+// up to max. Defaults to one minute up to one hour.
+func WithBackoff(initial, max time.Duration) FeedOption {
+	return func(o *feedOptions) {
+		o.backoff = initial
+		o.maxBackoff = max
+	}
+}
+
+// Feed is a list that is downloaded periodically.
+type Feed struct {
+	// Name identifies the list. The metadata of the list is stored with this name.
+	Name string
+	URL  string
+	// Import parses the response, defaults to (*NutBreaker).Import.
+	Import ImportFunc
+	// Options are passed to Import, e.g. WithValue.
+	Options []ImportOption
+	// Interval between two successful fetches, defaults to one hour.
+	Interval time.Duration
+	// SignatureURL is the URL of the detached signature of the feed, see Sign and WithSignature.
+	// The signature is downloaded whenever the feed changed.
+	SignatureURL string
+}
+
+// FeedStatus describes the current state of a feed.
+type FeedStatus struct {
+	Name        string
+	URL         string
+	LastAttempt time.Time
+	LastSuccess time.Time
+	// Entries is the number of entries of the last good list.
+	Entries int
+	// LastError is the error of the last fetch, nil if it succeeded.
+	LastError error
+	// Failures is the number of consecutive failed fetches.
+	Failures  int
+	NextFetch time.Time
+}
+
+// FeedManager periodically downloads feeds and replaces the ranges of a feed whenever it changed.
+// Responses are cached with ETag and If-Modified-Since, failed fetches are retried with an
+// exponential backoff. Feeds should not overlap with ranges of other lists or ranges that are
+// inserted otherwise, as an entry that is removed from a feed is removed completely.
+type FeedManager struct {
+	n    *NutBreaker
+	opts feedOptions
+
+	mu    sync.Mutex
+	feeds map[string]*feed
+}
+
+type feed struct {
+	Feed
+	// serializes the fetches of the feed
+	fetching sync.Mutex
+	// guarded by the mutex of the manager
+	status FeedStatus
+}
+
+// NewFeedManager returns a manager without feeds.
+func (n *NutBreaker) NewFeedManager(opts ...FeedOption) *FeedManager {
+	o := feedOptions{
+		client:     http.DefaultClient,
+		backoff:    defaultFeedBackoff,
+		maxBackoff: defaultFeedMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &FeedManager{
+		n:     n,
+		opts:  o,
+		feeds: make(map[string]*feed),
+	}
+}
+
+// Add registers a feed, which is due to be fetched immediately.
+func (m *FeedManager) Add(f Feed) error {
+	if f.Name == "" || f.URL == "" {
+		return errors.New("feed without name or url")
+	}
+	if f.Import == nil {
+		f.Import = (*NutBreaker).Import
+	}
+	if f.Interval <= 0 {
+		f.Interval = defaultFeedInterval
+	}
+
+	var state sourceState
+	err := m.n.db.View(func(tx *nutsdb.Tx) (err error) {
+		state, err = m.n.sourceState(tx, sourceKindFeed, f.Name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.feeds[f.Name]; ok {
+		return fmt.Errorf("feed %s already exists", f.Name)
+	}
+	m.feeds[f.Name] = &feed{
+		Feed: f,
+		status: FeedStatus{
+			Name:    f.Name,
+			URL:     f.URL,
+			Entries: state.Entries,
+		},
+	}
+	return nil
+}
+
+// Remove stops fetching the feed with the given name. The ranges of the feed are kept.
+func (m *FeedManager) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.feeds, name)
+}
+
+// Status returns the status of the feed with the given name.
+func (m *FeedManager) Status(name string) (FeedStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.feeds[name]
+	if !ok {
+		return FeedStatus{}, false
+	}
+	return f.status, true
+}
+
+// Metadata returns the metadata of the list of the feed with the given name.
+func (m *FeedManager) Metadata(name string) (ListMetadata, error) {
+	return m.n.metadata(sourceKindFeed, name)
+}
+
+// Statuses returns the status of all feeds sorted by their name.
+func (m *FeedManager) Statuses() []FeedStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]FeedStatus, 0, len(m.feeds))
+	for _, f := range m.feeds {
+		result = append(result, f.status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Fetch fetches the feed with the given name immediately.
+func (m *FeedManager) Fetch(ctx context.Context, name string) (SourceReport, error) {
+	m.mu.Lock()
+	f, ok := m.feeds[name]
+	m.mu.Unlock()
+	if !ok {
+		return SourceReport{}, fmt.Errorf("feed %s does not exist", name)
+	}
+	return m.fetch(ctx, f), nil
+}
+
+// FetchDue fetches all feeds whose next fetch is due and returns a report for every fetch,
+// sorted by the name of the feed.
+func (m *FeedManager) FetchDue(ctx context.Context) []SourceReport {
+	now := m.n.now()
+
+	m.mu.Lock()
+	var due []*feed
+	for _, f := range m.feeds {
+		if !f.status.NextFetch.After(now) {
+			due = append(due, f)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].Name < due[j].Name
+	})
+
+	reports := make([]SourceReport, 0, len(due))
+	for _, f := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		reports = append(reports, m.fetch(ctx, f))
+	}
+	return reports
+}
+
+// Run fetches all due feeds every tick and passes every report to fn until ctx is done.
+func (m *FeedManager) Run(ctx context.Context, tick time.Duration, fn func(SourceReport)) error {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		for _, report := range m.FetchDue(ctx) {
+			fn(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// fetch downloads a feed and replaces its ranges if it changed.
+func (m *FeedManager) fetch(ctx context.Context, f *feed) SourceReport {
+	f.fetching.Lock()
+	defer f.fetching.Unlock()
+
+	report := SourceReport{
+		Name: f.Name,
+		Path: f.URL,
+		Time: m.n.now(),
+	}
+
+	entries, err := m.download(ctx, f, &report)
+	if err != nil && report.Err == nil {
+		report.Err = fmt.Errorf("failed to fetch feed %s: %w", f.Name, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := &f.status
+	status.LastAttempt = report.Time
+	if report.Err != nil {
+		status.LastError = report.Err
+		status.Failures++
+		status.NextFetch = report.Time.Add(m.backoff(status.Failures))
+		return report
+	}
+
+	status.LastSuccess = report.Time
+	status.LastError = nil
+	status.Failures = 0
+	status.Entries = entries
+	status.NextFetch = report.Time.Add(f.Interval)
+	return report
+}
+
+// download sends a conditional request and loads the response if it changed.
+// Returns the number of entries of the current list.
+func (m *FeedManager) download(ctx context.Context, f *feed, report *SourceReport) (int, error) {
+	var state sourceState
+	err := m.n.db.View(func(tx *nutsdb.Tx) (err error) {
+		state, err = m.n.sourceState(tx, sourceKindFeed, f.Name)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if state.Hash != "" {
+		if state.ETag != "" {
+			req.Header.Set("If-None-Match", state.ETag)
+		}
+		if state.LastModified != "" {
+			req.Header.Set("If-Modified-Since", state.LastModified)
+		}
+	}
+
+	resp, err := m.opts.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && state.Hash != "" {
+		report.Hash = state.Hash
+		report.NotModified = true
+		return state.Entries, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > maxFeedSize {
+		return 0, fmt.Errorf("response exceeds %d bytes", maxFeedSize)
+	}
+
+	sum := sha256.Sum256(data)
+	report.Hash = hex.EncodeToString(sum[:])
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if report.Hash == state.Hash {
+		// the content did not change, only the cache validators are updated
+		report.NotModified = true
+		state.ETag, state.LastModified = etag, lastModified
+		err = m.n.update(func(tx *nutsdb.Tx) error {
+			return m.n.putSourceState(tx, sourceKindFeed, f.Name, state)
+		})
+		return state.Entries, err
+	}
+
+	opts := f.Options
+	if f.SignatureURL != "" {
+		sig, err := m.get(ctx, f.SignatureURL, maxSignatureSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch signature: %w", err)
+		}
+		opts = append(append([]ImportOption{}, opts...), WithSignature(sig))
+	}
+
+	next := sourceState{
+		Hash:         report.Hash,
+		ETag:         etag,
+		LastModified: lastModified,
+	}
+	if !m.n.loadSource(report, sourceKindFeed, data, f.Import, opts, next) {
+		return 0, report.Err
+	}
+	return report.Result.Metadata.Entries, nil
+}
+
+// get downloads a small resource of at most limit bytes.
+func (m *FeedManager) get(ctx context.Context, url string, limit int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.opts.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
+	}
+	return data, nil
+}
+
+// backoff returns the delay after the given number of consecutive failures.
+func (m *FeedManager) backoff(failures int) time.Duration {
+	d := m.opts.backoff
+	for i := 1; i < failures && d < m.opts.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, m.opts.maxBackoff)
+}
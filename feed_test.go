@@ -0,0 +1,290 @@
+package nutbreaker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// feedServer serves a list with an ETag and a Last-Modified header and answers conditional requests.
+type feedServer struct {
+	mu           sync.Mutex
+	body         string
+	etag         string
+	lastModified time.Time
+	status       int
+	requests     int
+	conditional  int
+}
+
+func (s *feedServer) set(body, etag string, lastModified time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag, s.lastModified = body, etag, lastModified
+}
+
+func (s *feedServer) fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		s.conditional++
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	if !s.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", s.lastModified.UTC().Format(http.TimeFormat))
+	}
+	http.ServeContent(w, r, "list.txt", s.lastModified, strings.NewReader(s.body))
+}
+
+func TestFeedManager(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	now := time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)
+	ndb.now = func() time.Time {
+		return now
+	}
+
+	_, err := ndb.Insert("192.168.0.1", []byte("manual"))
+	require.NoError(err)
+
+	server := &feedServer{}
+	server.set("10.0.0.0/24\n11.0.0.1\n", `"v1"`, time.Time{})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	m := ndb.NewFeedManager(WithHTTPClient(ts.Client()), WithBackoff(time.Minute, 5*time.Minute))
+	require.NoError(m.Add(Feed{
+		Name:     "tor",
+		URL:      ts.URL,
+		Options:  []ImportOption{WithValue([]byte("tor"))},
+		Interval: time.Hour,
+	}))
+	require.Error(m.Add(Feed{Name: "tor", URL: ts.URL}))
+
+	ctx := context.Background()
+	reports := m.FetchDue(ctx)
+	require.Len(reports, 1)
+	require.NoError(reports[0].Err)
+	require.Equal(2, reports[0].Added)
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 tor", "11.0.0.1 tor", "192.168.0.1 manual")
+
+	status, ok := m.Status("tor")
+	require.True(ok)
+	require.Equal(2, status.Entries)
+	require.Equal(now, status.LastSuccess)
+	require.Equal(now.Add(time.Hour), status.NextFetch)
+
+	// not due yet
+	require.Empty(m.FetchDue(ctx))
+
+	// unchanged feed is answered with 304 Not Modified
+	now = now.Add(time.Hour)
+	reports = m.FetchDue(ctx)
+	require.Len(reports, 1)
+	require.NoError(reports[0].Err)
+	require.True(reports[0].NotModified)
+	require.Equal(1, server.conditional)
+
+	// changed feed replaces only the ranges owned by the feed
+	server.set("10.0.0.0/24\n12.0.0.1\n", `"v2"`, time.Time{})
+	report, err := m.Fetch(ctx, "tor")
+	require.NoError(err)
+	require.NoError(report.Err)
+	require.Equal(1, report.Added)
+	require.Equal(1, report.Removed)
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 tor", "12.0.0.1 tor", "192.168.0.1 manual")
+
+	// failures back off exponentially and keep the last good state
+	server.fail(http.StatusInternalServerError)
+	for i, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute} {
+		now = now.Add(time.Hour)
+		reports = m.FetchDue(ctx)
+		require.Len(reports, 1)
+		require.ErrorContains(reports[0].Err, "500")
+
+		status, _ = m.Status("tor")
+		require.Equal(i+1, status.Failures)
+		require.Equal(now.Add(backoff), status.NextFetch)
+		require.Equal(2, status.Entries)
+		require.Error(status.LastError)
+	}
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 tor", "12.0.0.1 tor", "192.168.0.1 manual")
+
+	// an invalid list is a failure as well
+	server.fail(0)
+	server.set("10.0.0.0/24\nnot an ip\n", `"v3"`, time.Time{})
+	now = now.Add(time.Hour)
+	reports = m.FetchDue(ctx)
+	require.Len(reports, 1)
+	require.ErrorIs(reports[0].Err, ErrInvalidRange)
+
+	server.set("13.0.0.1\n", `"v4"`, time.Time{})
+	now = now.Add(time.Hour)
+	reports = m.FetchDue(ctx)
+	require.Len(reports, 1)
+	require.NoError(reports[0].Err)
+	requireRanges(t, ndb, "13.0.0.1 tor", "192.168.0.1 manual")
+
+	status, _ = m.Status("tor")
+	require.Zero(status.Failures)
+	require.NoError(status.LastError)
+	require.Equal(1, status.Entries)
+
+	meta, err := m.Metadata("tor")
+	require.NoError(err)
+	require.Equal("feed", meta.Kind)
+	require.Equal("feed", meta.Format)
+	require.Equal(ts.URL, meta.Source)
+}
+
+func TestFeedManagerLastModified(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	modified := time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)
+	server := &feedServer{}
+	server.set("10.0.0.1\n", "", modified)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	m := ndb.NewFeedManager(WithHTTPClient(ts.Client()))
+	require.NoError(m.Add(Feed{Name: "list", URL: ts.URL}))
+
+	for i := 0; i < 2; i++ {
+		report, err := m.Fetch(context.Background(), "list")
+		require.NoError(err)
+		require.NoError(report.Err)
+		require.Equal(i == 1, report.NotModified)
+	}
+	require.Equal(2, server.requests)
+	require.Equal(1, server.conditional)
+
+	// a new manager, e.g. after a restart, continues with the stored cache validators
+	other := ndb.NewFeedManager(WithHTTPClient(ts.Client()))
+	require.NoError(other.Add(Feed{Name: "list", URL: ts.URL}))
+	status, _ := other.Status("list")
+	require.Equal(1, status.Entries)
+
+	reports := other.FetchDue(context.Background())
+	require.Len(reports, 1)
+	require.True(reports[0].NotModified)
+	require.Equal(2, server.conditional)
+}
+
+func TestFeedManagerRun(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+
+	server := &feedServer{}
+	server.set("10.0.0.1\n", `"v1"`, time.Time{})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	m := ndb.NewFeedManager(WithHTTPClient(ts.Client()))
+	require.NoError(t, m.Add(Feed{Name: "list", URL: ts.URL}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reports := make(chan SourceReport, 1)
+	done := make(chan error)
+	go func() {
+		done <- m.Run(ctx, time.Hour, func(r SourceReport) {
+			reports <- r
+		})
+	}()
+
+	r := <-reports
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.NoError(t, r.Err)
+	require.Equal(t, 1, r.Added)
+
+	_, err := m.Fetch(context.Background(), "unknown")
+	require.Error(t, err)
+}
+
+func TestFeedManagerFileSourceSameName(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	var mtime time.Time
+	path := filepath.Join(t.TempDir(), "list.txt")
+	writeSource(t, path, "10.0.0.1\n", &mtime)
+
+	w := ndb.NewFileWatcher()
+	report, err := w.Add(FileSource{Name: "list", Path: path, Options: []ImportOption{WithValue([]byte("file"))}})
+	require.NoError(err)
+	require.NoError(report.Err)
+
+	server := &feedServer{}
+	server.set("11.0.0.1\n", `"v1"`, time.Time{})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// the feed does not see the records of the file source with the same name
+	m := ndb.NewFeedManager(WithHTTPClient(ts.Client()))
+	require.NoError(m.Add(Feed{Name: "list", URL: ts.URL, Options: []ImportOption{WithValue([]byte("feed"))}}))
+	fetched, err := m.Fetch(context.Background(), "list")
+	require.NoError(err)
+	require.NoError(fetched.Err)
+	require.Equal(1, fetched.Added)
+	require.Equal(0, fetched.Removed)
+	requireRanges(t, ndb, "10.0.0.1 file", "11.0.0.1 feed")
+
+	server.set("12.0.0.1\n", `"v2"`, time.Time{})
+	fetched, err = m.Fetch(context.Background(), "list")
+	require.NoError(err)
+	require.NoError(fetched.Err)
+	require.Equal(1, fetched.Removed)
+	requireRanges(t, ndb, "10.0.0.1 file", "12.0.0.1 feed")
+
+	// both sources keep their own metadata
+	fileMeta, err := w.Metadata("list")
+	require.NoError(err)
+	require.Equal(path, fileMeta.Source)
+	require.Equal(1, fileMeta.Entries)
+	feedMeta, err := m.Metadata("list")
+	require.NoError(err)
+	require.Equal(ts.URL, feedMeta.Source)
+	require.Equal(1, feedMeta.Entries)
+
+	all, err := ndb.AllMetadata()
+	require.NoError(err)
+	require.Len(all, 2)
+	require.Equal("feed", all[0].Kind)
+	require.Equal("file", all[1].Kind)
+
+	_, err = ndb.Metadata("list")
+	require.ErrorIs(err, ErrMetadataNotFound)
+
+	// the unchanged file is not reloaded by a new watcher
+	report, err = ndb.NewFileWatcher().Add(FileSource{Name: "list", Path: path})
+	require.NoError(err)
+	require.Nil(report)
+}
@@ -0,0 +1,274 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func initFirewallDB(t *testing.T) (*NutBreaker, func()) {
+	ndb, cleanup := initDB(t)
+
+	for _, r := range []struct {
+		ipRange string
+		value   string
+	}{
+		{"10.0.0.3 - 10.0.0.10", "vpn"},
+		{"10.0.2.0/24", "tor"},
+		{"192.168.1.1", `say "hi"`},
+	} {
+		_, err := ndb.Insert(r.ipRange, []byte(r.value))
+		require.NoError(t, err)
+	}
+	return ndb, cleanup
+}
+
+func TestFirewallExportImport(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		export   func(*bytes.Buffer) error
+		imports  func(*NutBreaker, *bytes.Buffer) (ImportResult, error)
+		expected []string
+	}{
+		{
+			name:   "ipset",
+			export: func(b *bytes.Buffer) error { return ndb.ExportIPSet(b) },
+			imports: func(n *NutBreaker, b *bytes.Buffer) (ImportResult, error) {
+				return n.ImportIPSet(b)
+			},
+			expected: []string{
+				"create nutbreaker hash:net family inet hashsize 1024 maxelem 65536 comment",
+				`add nutbreaker 10.0.0.3/32 comment "vpn"`,
+				`add nutbreaker 10.0.0.4/30 comment "vpn"`,
+				`add nutbreaker 10.0.2.0/24 comment "tor"`,
+				`add nutbreaker 192.168.1.1/32 comment "say 'hi'"`,
+			},
+		},
+		{
+			name:   "nftables",
+			export: func(b *bytes.Buffer) error { return ndb.ExportNFTables(b) },
+			imports: func(n *NutBreaker, b *bytes.Buffer) (ImportResult, error) {
+				return n.ImportNFTables(b)
+			},
+			expected: []string{
+				"table inet nutbreaker {",
+				"\t\tflags interval",
+				"\t\t\t10.0.0.3-10.0.0.10 comment \"vpn\",",
+				"\t\t\t10.0.2.0/24 comment \"tor\",",
+				"\t\t\t192.168.1.1 comment \"say 'hi'\"",
+			},
+		},
+		{
+			name:   "iptables",
+			export: func(b *bytes.Buffer) error { return ndb.ExportIPTables(b) },
+			imports: func(n *NutBreaker, b *bytes.Buffer) (ImportResult, error) {
+				return n.ImportIPTables(b)
+			},
+			expected: []string{
+				"*filter",
+				":NUTBREAKER - [0:0]",
+				`-A NUTBREAKER -s 10.0.0.8/31 -m comment --comment "vpn" -j DROP`,
+				`-A NUTBREAKER -s 10.0.2.0/24 -m comment --comment "tor" -j DROP`,
+				"COMMIT",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			var buf bytes.Buffer
+			require.NoError(tt.export(&buf))
+			lines := strings.Split(buf.String(), "\n")
+			for _, line := range tt.expected {
+				require.Contains(lines, line)
+			}
+
+			other, otherCleanup := initDB(t)
+			defer otherCleanup()
+
+			result, err := tt.imports(other, &buf)
+			require.NoError(err)
+			require.Empty(result.Errors)
+
+			expected, err := ndb.exportRanges(exportOptions{})
+			require.NoError(err)
+			for i := range expected {
+				// quotes cannot be part of a comment
+				expected[i].Value = []byte(firewallComment(expected[i].Value))
+			}
+			actual, err := other.exportRanges(exportOptions{})
+			require.NoError(err)
+			require.Equal(expected, actual)
+			consistent(t, other)
+		})
+	}
+}
+
+func TestFirewallExportValues(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportIPTables(&buf, WithExportValues("tor"), WithChainName("TOR")))
+	require.Equal("*filter\n"+
+		":TOR - [0:0]\n"+
+		"-A TOR -s 10.0.2.0/24 -m comment --comment \"tor\" -j DROP\n"+
+		"COMMIT\n", buf.String())
+
+	buf.Reset()
+	require.NoError(ndb.ExportNFTables(&buf, WithExportValues("none"), WithTableName("filter"), WithSetName("blocklist")))
+	require.Equal("table inet filter {\n"+
+		"\tset blocklist {\n"+
+		"\t\ttype ipv4_addr\n"+
+		"\t\tflags interval\n"+
+		"\t}\n"+
+		"}\n", buf.String())
+}
+
+func TestExportIPSetDefaultRoute(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("0.0.0.0 - 255.255.255.255", []byte("all"))
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportIPSet(&buf))
+	require.Equal("create nutbreaker hash:net family inet hashsize 1024 maxelem 65536 comment\n"+
+		"add nutbreaker 0.0.0.0/1 comment \"all\"\n"+
+		"add nutbreaker 128.0.0.0/1 comment \"all\"\n", buf.String())
+
+	other, otherCleanup := initDB(t)
+	defer otherCleanup()
+	result, err := other.ImportIPSet(&buf)
+	require.NoError(err)
+	require.Empty(result.Errors)
+
+	ranges, err := other.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.Len(ranges, 1)
+	require.Equal("0.0.0.0 - 255.255.255.255", ranges[0].String())
+	consistent(t, other)
+}
+
+func TestImportIPSetSaveFile(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	save := `create blocklist hash:net family inet hashsize 1024 maxelem 65536 comment
+add blocklist 1.2.3.0/24 comment "scanner"
+add blocklist 1.2.4.0/24 comment "scanner"
+add blocklist 5.6.7.8 timeout 300 comment "brute force"
+add blocklist 9.9.9.9
+add blocklist 9.9.9.0/24 nomatch
+add blocklist 2001:db8::/32
+create allowlist hash:ip family inet hashsize 1024 maxelem 65536
+add allowlist 10.0.0.1
+`
+	result, err := ndb.ImportIPSet(strings.NewReader(save), WithSetFilter("blocklist"), WithValue([]byte("ipset")))
+	require.NoError(err)
+	require.Equal(9, result.Lines)
+	require.Equal(2, result.Skipped)
+	require.Equal(1, result.Failed)
+	require.Equal(7, result.Errors[0].Line)
+	require.ErrorIs(result.Errors[0], ErrIPv6NotSupported)
+
+	ranges, err := ndb.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.Len(ranges, 3)
+	require.Equal("1.2.3.0 - 1.2.4.255", ranges[0].String())
+	require.Equal("scanner", string(ranges[0].Value))
+	require.Equal("brute force", string(ranges[1].Value))
+	require.Equal("ipset", string(ranges[2].Value))
+	consistent(t, ndb)
+}
+
+func TestImportNFTablesRuleset(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	ruleset := `#!/usr/sbin/nft -f
+table inet filter {
+	set blocklist {
+		type ipv4_addr
+		flags interval
+		elements = { 1.2.3.0/24 comment "a, b", 5.6.7.8,
+			     9.9.9.0-9.9.9.10 timeout 1h comment "c" }
+	}
+	set other {
+		type ipv4_addr
+		elements = { 10.0.0.1 }
+	}
+	chain input {
+		type filter hook input priority 0; policy accept;
+		ip saddr @blocklist drop
+	}
+}
+add element inet filter blocklist { 11.0.0.1 comment "d" }
+delete element inet filter blocklist { 5.6.7.8 }
+`
+	result, err := ndb.ImportNFTables(strings.NewReader(ruleset), WithSetFilter("blocklist"))
+	require.NoError(err)
+	require.Equal(1, result.Skipped)
+	require.Equal(1, result.Failed)
+	require.Equal(19, result.Errors[0].Line)
+	require.ErrorIs(result.Errors[0], ErrInvalidListFormat)
+
+	ranges, err := ndb.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.Len(ranges, 4)
+	require.Equal("a, b", string(ranges[0].Value))
+	require.Equal("5.6.7.8", ranges[1].String())
+	require.Equal("9.9.9.0 - 9.9.9.10", ranges[2].String())
+	require.Equal("c", string(ranges[2].Value))
+	require.Equal("d", string(ranges[3].Value))
+
+	_, err = ndb.ImportNFTables(strings.NewReader("table inet t { set s { elements = { 1.2.3.4"))
+	require.ErrorIs(err, ErrInvalidListFormat)
+}
+
+func TestImportIPTablesRules(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	rules := `# Generated by iptables-save
+*filter
+:INPUT ACCEPT [0:0]
+-A INPUT -s 1.2.3.4/32,1.2.3.5 -j DROP
+-A INPUT ! -s 10.0.0.0/8 -j ACCEPT
+-A INPUT -m iprange --src-range 5.6.7.8-5.6.7.20 -m comment --comment "range rule" -j DROP
+-A INPUT -s 6.0.0.0/8 -j ACCEPT
+-A INPUT -s 7.0.0.0/8 -j RETURN
+-A INPUT -s 7.1.0.0/16 -j LOG
+-A INPUT -s 7.2.0.0/16 --jump REJECT
+-A OUTPUT -d 8.8.8.8/32 -j DROP
+iptables -A INPUT -s 9.9.9.9 -j DROP
+COMMIT
+`
+	result, err := ndb.ImportIPTables(strings.NewReader(rules), WithSetFilter("INPUT"), WithValue([]byte("drop")))
+	require.NoError(err)
+	require.Empty(result.Errors)
+	require.Equal(4, result.Skipped)
+
+	ranges, err := ndb.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.Len(ranges, 4)
+	require.Equal("1.2.3.4 - 1.2.3.5", ranges[0].String())
+	require.Equal("5.6.7.8 - 5.6.7.20", ranges[1].String())
+	require.Equal("range rule", string(ranges[1].Value))
+	require.Equal("7.2.0.0 - 7.2.255.255", ranges[2].String())
+	require.Equal("9.9.9.9", ranges[3].String())
+	require.Equal("drop", string(ranges[3].Value))
+}
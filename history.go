@@ -0,0 +1,295 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+var (
+	// sorts before all time keys and contains the time since when the history is recorded.
+	historySinceKey = []byte{0}
+	// sorts before all time keys and contains the time of the first change that was not
+	// recorded, because the database was opened without history.
+	historyStaleKey = []byte{1}
+)
+
+// historyEntry contains the boundary changes of a single commit.
+// Large commits are split into multiple entries.
+type historyEntry struct {
+	Time    time.Time       `json:"time"`
+	Seq     uint32          `json:"seq"`
+	Changes []historyChange `json:"changes"`
+}
+
+// historyChange is a single boundary change.
+// Before is nil for inserted boundaries, After is nil for removed boundaries.
+type historyChange struct {
+	IP     uint32   `json:"ip"`
+	Before *dbValue `json:"before,omitempty"`
+	After  *dbValue `json:"after,omitempty"`
+}
+
+func (c historyChange) noop() bool {
+	if c.Before == nil || c.After == nil {
+		return c.Before == c.After
+	}
+	return c.Before.Low == c.After.Low &&
+		c.Before.High == c.After.High &&
+		bytes.Equal(c.Before.Value, c.After.Value)
+}
+
+// FindAt returns the value of the range that contained ip at the given point in time.
+// ErrIPNotFound is returned if no range contained ip at that time.
+func (n *NutBreaker) FindAt(ip string, at time.Time) ([]byte, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	if !addr.Is4() {
+		return nil, ErrIPv6NotSupported
+	}
+
+	ranges, err := n.RangesAt(at)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := sort.Search(len(ranges), func(i int) bool {
+		return addr.Compare(ranges[i].High) <= 0
+	})
+	if idx == len(ranges) || !ranges[idx].Contains(addr) {
+		return nil, ErrIPNotFound
+	}
+	return ranges[idx].Value, nil
+}
+
+// RangesAt returns all ranges that were stored at the given point in time.
+func (n *NutBreaker) RangesAt(at time.Time) ([]Range, error) {
+	if !n.history {
+		return nil, ErrHistoryDisabled
+	}
+
+	var result []Range
+	err := n.View(func(tx *Txn) error {
+		state, err := n.stateAt(tx, at)
+		if err != nil {
+			return err
+		}
+
+		bs, err := state.boundaries()
+		if err != nil {
+			return err
+		}
+		result = rangesFromBoundaries(bs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// stateAt reconstructs the boundary state at the given point in time
+// by undoing all changes that happened after it.
+func (n *NutBreaker) stateAt(tx *Txn, at time.Time) (boundaryState, error) {
+	since, err := n.historySince(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if at.Before(since) {
+		return nil, fmt.Errorf("%w: history starts at %s", ErrHistoryUnavailable, since.Format(time.RFC3339))
+	}
+
+	all, err := n.all(tx)
+	if err != nil {
+		return nil, err
+	}
+	state := newBoundaryState(all)
+
+	values, err := tx.tx.RangeScan(
+		n.historyBucket,
+		timeKey(at.Add(1), 0),
+		bytes.Repeat([]byte{math.MaxUint8}, 12),
+	)
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrRangeScan) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	for i := len(values) - 1; i >= 0; i-- {
+		var e historyEntry
+		err = json.Unmarshal(values[i], &e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode history entry: %w", err)
+		}
+
+		for j := len(e.Changes) - 1; j >= 0; j-- {
+			c := e.Changes[j]
+			if c.Before == nil {
+				delete(state, c.IP)
+			} else {
+				state[c.IP] = *c.Before
+			}
+		}
+	}
+	return state, nil
+}
+
+// initHistory starts recording the history. A history that went stale while the database was
+// opened without history is discarded, as it cannot reconstruct the changes in the meantime.
+func (n *NutBreaker) initHistory(tx *nutsdb.Tx) error {
+	_, err := tx.Get(n.historyBucket, historyStaleKey)
+	if err == nil {
+		return n.discardHistory(tx)
+	}
+	if !errors.Is(err, nutsdb.ErrKeyNotFound) && !errors.Is(err, nutsdb.ErrNotFoundKey) && !errors.Is(err, nutsdb.ErrNotFoundBucket) {
+		return err
+	}
+
+	_, err = tx.Get(n.historyBucket, historySinceKey)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nutsdb.ErrKeyNotFound) && !errors.Is(err, nutsdb.ErrNotFoundKey) && !errors.Is(err, nutsdb.ErrNotFoundBucket) {
+		return err
+	}
+	return n.setHistorySince(tx, n.now())
+}
+
+// discardHistory removes all entries and restarts the history at the current time.
+func (n *NutBreaker) discardHistory(tx *nutsdb.Tx) error {
+	keys, err := tx.GetKeys(n.historyBucket)
+	if err != nil {
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+	for _, key := range keys {
+		if bytes.Equal(key, historySinceKey) {
+			continue
+		}
+		err = tx.Delete(n.historyBucket, key)
+		if err != nil {
+			return fmt.Errorf("failed to delete history entry: %w", err)
+		}
+	}
+	return n.setHistorySince(tx, n.now())
+}
+
+func (n *NutBreaker) historySince(tx *nutsdb.Tx) (time.Time, error) {
+	data, err := tx.Get(n.historyBucket, historySinceKey)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get history start: %w", err)
+	}
+
+	var since time.Time
+	err = since.UnmarshalText(data)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode history start: %w", err)
+	}
+	return since, nil
+}
+
+func (n *NutBreaker) setHistorySince(tx *nutsdb.Tx, since time.Time) error {
+	data, err := since.MarshalText()
+	if err != nil {
+		return err
+	}
+	return tx.Put(n.historyBucket, historySinceKey, data, 0)
+}
+
+// recordHistory records the changes of a commit. If the database is opened without history,
+// but the history was recorded before, it is marked as stale instead.
+func (n *NutBreaker) recordHistory(tx *nutsdb.Tx, changes []historyChange) error {
+	if n.history {
+		return n.writeHistory(tx, changes)
+	}
+	if len(changes) == 0 || !tx.ExistBucket(nutsdb.DataStructureBTree, n.historyBucket) {
+		return nil
+	}
+
+	_, err := tx.Get(n.historyBucket, historyStaleKey)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nutsdb.ErrKeyNotFound) && !errors.Is(err, nutsdb.ErrNotFoundKey) {
+		return err
+	}
+	data, err := n.now().MarshalText()
+	if err != nil {
+		return err
+	}
+	return tx.Put(n.historyBucket, historyStaleKey, data, 0)
+}
+
+// writeHistory records the changes of a commit and removes all entries that exceed the retention period.
+func (n *NutBreaker) writeHistory(tx *nutsdb.Tx, changes []historyChange) error {
+	if !n.history {
+		return nil
+	}
+
+	now := n.now()
+	for len(changes) > 0 {
+		num := min(len(changes), snapshotChunkSize)
+		e := historyEntry{
+			Time:    now,
+			Seq:     n.seq.Add(1),
+			Changes: changes[:num],
+		}
+		changes = changes[num:]
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode history entry: %w", err)
+		}
+		err = tx.Put(n.historyBucket, timeKey(e.Time, e.Seq), data, 0)
+		if err != nil {
+			return fmt.Errorf("failed to write history entry: %w", err)
+		}
+	}
+
+	if n.historyRetention == 0 {
+		return nil
+	}
+	return n.pruneHistory(tx, now.Add(-n.historyRetention))
+}
+
+// pruneHistory removes all entries before the given time.
+func (n *NutBreaker) pruneHistory(tx *nutsdb.Tx, before time.Time) error {
+	since, err := n.historySince(tx)
+	if err != nil {
+		return err
+	}
+	if !since.Before(before) {
+		return nil
+	}
+
+	values, err := tx.RangeScan(n.historyBucket, timeKey(since, 0), timeKey(before, 0))
+	if err != nil && !errors.Is(err, nutsdb.ErrRangeScan) {
+		return err
+	}
+
+	for _, v := range values {
+		var e historyEntry
+		err = json.Unmarshal(v, &e)
+		if err != nil {
+			return fmt.Errorf("failed to decode history entry: %w", err)
+		}
+
+		err = tx.Delete(n.historyBucket, timeKey(e.Time, e.Seq))
+		if err != nil {
+			return fmt.Errorf("failed to delete history entry: %w", err)
+		}
+	}
+	return n.setHistorySince(tx, before)
+}
@@ -0,0 +1,230 @@
+package nutbreaker
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/require"
+)
+
+func initHistoryDB(t *testing.T, retention time.Duration) (n *NutBreaker, clock *time.Time, cleanup func()) {
+	require := require.New(t)
+
+	now := time.Now()
+	dataDir := generateRandomDbDirName()
+	n, err := NewNutBreaker(
+		WithDir(dataDir),
+		WithHistory(retention),
+	)
+	require.NoError(err)
+
+	n.now = func() time.Time {
+		return now
+	}
+	return n, &now, func() {
+		require.NoError(n.Close())
+		require.NoError(os.RemoveAll(dataDir))
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ndb, clock, cleanup := initHistoryDB(t, 0)
+	defer cleanup()
+	require := require.New(t)
+
+	t0 := clock.Add(time.Minute)
+	t1 := t0.Add(time.Hour)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+
+	*clock = t1
+	_, err := ndb.Insert("1.2.3.0/24", []byte("spam"))
+	require.NoError(err)
+	*clock = t2
+	_, err = ndb.Insert("1.2.3.4", []byte("vpn"))
+	require.NoError(err)
+	*clock = t3
+	_, err = ndb.Remove("1.2.3.0/24")
+	require.NoError(err)
+
+	_, err = ndb.FindAt("1.2.3.4", t0)
+	require.ErrorIs(err, ErrIPNotFound)
+
+	v, err := ndb.FindAt("1.2.3.4", t1)
+	require.NoError(err)
+	require.Equal([]byte("spam"), v)
+
+	v, err = ndb.FindAt("1.2.3.4", t2.Add(time.Minute))
+	require.NoError(err)
+	require.Equal([]byte("vpn"), v)
+
+	v, err = ndb.FindAt("1.2.3.5", t2.Add(time.Minute))
+	require.NoError(err)
+	require.Equal([]byte("spam"), v)
+
+	_, err = ndb.FindAt("1.2.3.4", t3)
+	require.ErrorIs(err, ErrIPNotFound)
+
+	ranges, err := ndb.RangesAt(t2)
+	require.NoError(err)
+	require.Len(ranges, 3)
+	require.Equal("1.2.3.0 - 1.2.3.3", ranges[0].String())
+	require.Equal("1.2.3.4", ranges[1].String())
+	require.Equal("1.2.3.5 - 1.2.3.255", ranges[2].String())
+
+	ranges, err = ndb.RangesAt(t3)
+	require.NoError(err)
+	require.Empty(ranges)
+
+	_, err = ndb.RangesAt(t0.Add(-time.Hour))
+	require.ErrorIs(err, ErrHistoryUnavailable)
+}
+
+func TestHistoryRetention(t *testing.T) {
+	ndb, clock, cleanup := initHistoryDB(t, 24*time.Hour)
+	defer cleanup()
+	require := require.New(t)
+
+	t1 := clock.Add(time.Hour)
+	*clock = t1
+	_, err := ndb.Insert("1.2.3.0/24", []byte("spam"))
+	require.NoError(err)
+
+	t2 := t1.Add(48 * time.Hour)
+	*clock = t2
+	_, err = ndb.Insert("1.2.3.4", []byte("vpn"))
+	require.NoError(err)
+
+	_, err = ndb.FindAt("1.2.3.4", t1)
+	require.ErrorIs(err, ErrHistoryUnavailable)
+
+	v, err := ndb.FindAt("1.2.3.4", t2.Add(-time.Hour))
+	require.NoError(err)
+	require.Equal([]byte("spam"), v)
+
+	var entries [][]byte
+	err = ndb.db.View(func(tx *nutsdb.Tx) (err error) {
+		entries, err = tx.RangeScan(ndb.historyBucket, timeKey(t1, 0), timeKey(t2, 0))
+		return err
+	})
+	require.ErrorIs(err, nutsdb.ErrRangeScan)
+	require.Empty(entries)
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+
+	_, err := ndb.FindAt("1.2.3.4", time.Now())
+	require.ErrorIs(t, err, ErrHistoryDisabled)
+}
+
+func TestHistoryFlushReset(t *testing.T) {
+	ndb, clock, cleanup := initHistoryDB(t, 0)
+	defer cleanup()
+	require := require.New(t)
+
+	t1 := clock.Add(time.Hour)
+	t2 := t1.Add(time.Hour)
+	t3 := t2.Add(time.Hour)
+	t4 := t3.Add(time.Hour)
+
+	*clock = t1
+	_, err := ndb.Insert("1.2.3.0/24", []byte("spam"))
+	require.NoError(err)
+	*clock = t2
+	require.NoError(ndb.Flush())
+	*clock = t3
+	_, err = ndb.Insert("1.2.4.0/24", []byte("vpn"))
+	require.NoError(err)
+	*clock = t4
+	require.NoError(ndb.Reset())
+	consistent(t, ndb)
+
+	v, err := ndb.FindAt("1.2.3.4", t1)
+	require.NoError(err)
+	require.Equal([]byte("spam"), v)
+
+	ranges, err := ndb.RangesAt(t2)
+	require.NoError(err)
+	require.Empty(ranges)
+
+	ranges, err = ndb.RangesAt(t3)
+	require.NoError(err)
+	require.Len(ranges, 1)
+	require.Equal("1.2.4.0 - 1.2.4.255", ranges[0].String())
+
+	ranges, err = ndb.RangesAt(t4)
+	require.NoError(err)
+	require.Empty(ranges)
+}
+
+func TestHistorySequence(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+
+	ndb, err := NewNutBreaker(WithDir(dir), WithHistory(0), WithAuditLog())
+	require.NoError(err)
+	_, err = ndb.Insert("1.2.3.0/24", []byte("spam"))
+	require.NoError(err)
+	seq := ndb.seq.Load()
+	require.NotZero(seq)
+	require.NoError(ndb.Close())
+
+	// the sequence continues after reopening the database
+	ndb, err = NewNutBreaker(WithDir(dir), WithHistory(0), WithAuditLog())
+	require.NoError(err)
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+	require.Equal(seq, ndb.seq.Load())
+
+	_, err = ndb.Insert("1.2.4.0/24", []byte("vpn"))
+	require.NoError(err)
+	require.Greater(ndb.seq.Load(), seq)
+}
+
+func TestHistoryStale(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+
+	open := func(opts ...Option) *NutBreaker {
+		ndb, err := NewNutBreaker(append(opts, WithDir(dir))...)
+		require.NoError(err)
+		return ndb
+	}
+
+	ndb := open(WithHistory(0))
+	_, err := ndb.Insert("1.2.3.0/24", []byte("spam"))
+	require.NoError(err)
+	t1 := time.Now()
+	require.NoError(ndb.Close())
+
+	// opening the database without history and without changes keeps the history
+	ndb = open()
+	require.NoError(ndb.Close())
+	ndb = open(WithHistory(0))
+	v, err := ndb.FindAt("1.2.3.4", t1)
+	require.NoError(err)
+	require.Equal([]byte("spam"), v)
+	require.NoError(ndb.Close())
+
+	// changes without history cannot be reconstructed, the history is discarded
+	ndb = open()
+	_, err = ndb.Remove("1.2.3.0/24")
+	require.NoError(err)
+	require.NoError(ndb.Close())
+
+	ndb = open(WithHistory(0))
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+	_, err = ndb.FindAt("1.2.3.4", t1)
+	require.ErrorIs(err, ErrHistoryUnavailable)
+
+	ranges, err := ndb.RangesAt(time.Now())
+	require.NoError(err)
+	require.Empty(ranges)
+}
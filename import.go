@@ -0,0 +1,507 @@
+package nutbreaker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ImportOption configures Import and all other importers.
+type ImportOption func(*importOptions)
+
+type importOptions struct {
+	value        []byte
+	commentValue bool
+	batchSize    int
+	progress     func(ImportProgress)
+	mutationOpts []MutationOption
+	refresh      bool
+	strict       bool
+
+	proxyTypes   []string
+	valueColumns []string
+	ipv6Numbers  bool
+	set          string
+
+	// records collects the parsed ranges instead of writing them
+	records *[]importRecord
+
+	signature []byte
+	keyring   *Keyring
+}
+
+const defaultImportBatchSize = 1000
+
+func newImportOptions(opts []ImportOption) importOptions {
+	o := importOptions{
+		batchSize: defaultImportBatchSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.batchSize <= 0 {
+		o.batchSize = defaultImportBatchSize
+	}
+	return o
+}
+
+// collectRecords parses a list without writing it, all valid ranges are appended to dst.
+func collectRecords(dst *[]importRecord) ImportOption {
+	return func(o *importOptions) {
+		o.records = dst
+	}
+}
+
+// WithValue sets the value that is associated with every imported range.
+func WithValue(value []byte) ImportOption {
+	return func(o *importOptions) {
+		o.value = value
+	}
+}
+
+// WithCommentValue associates every imported range with the comment or annotation of its line.
+// Lines without a comment fall back to the value set with WithValue.
+func WithCommentValue() ImportOption {
+	return func(o *importOptions) {
+		o.commentValue = true
+	}
+}
+
+// WithBatchSize sets the number of ranges that are written within a single transaction.
+func WithBatchSize(size int) ImportOption {
+	return func(o *importOptions) {
+		o.batchSize = size
+	}
+}
+
+// WithProgress sets a function that is called after every written batch.
+func WithProgress(fn func(ImportProgress)) ImportOption {
+	return func(o *importOptions) {
+		o.progress = fn
+	}
+}
+
+// WithRefresh replaces all ranges that were previously imported from the same source within a
+// single transaction instead of writing batches on top of them.
+// Only importers that can tell which ranges they own support this option.
+func WithRefresh() ImportOption {
+	return func(o *importOptions) {
+		o.refresh = true
+	}
+}
+
+// WithStrictParsing rejects ranges that ParseRangeStrict rejects, e.g. CIDRs with host bits set.
+// The error of a rejected line is a *ParseError, whose position refers to the range of the line.
+func WithStrictParsing() ImportOption {
+	return func(o *importOptions) {
+		o.strict = true
+	}
+}
+
+// WithMutationOptions sets the options that are passed to every insertion, e.g. WithActor.
+func WithMutationOptions(opts ...MutationOption) ImportOption {
+	return func(o *importOptions) {
+		o.mutationOpts = opts
+	}
+}
+
+// ImportProgress is the state of a running import.
+type ImportProgress struct {
+	// Lines is the number of lines that were read.
+	Lines int `json:"lines"`
+	// Imported is the number of ranges that were written.
+	Imported int `json:"imported"`
+	// Failed is the number of lines that could not be imported.
+	Failed int `json:"failed"`
+	// Skipped is the number of valid ranges that were filtered out.
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// ImportResult is the summary of a finished import.
+type ImportResult struct {
+	ImportProgress
+	// Errors contains all lines that could not be imported.
+	Errors []LineError `json:"errors,omitempty"`
+	// Metadata is extracted from the headers of formats that provide them.
+	Metadata *ListMetadata `json:"metadata,omitempty"`
+}
+
+// LineError is the error of a single line that could not be imported.
+type LineError struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+	Err  error  `json:"-"`
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %q: %v", e.Line, e.Text, e.Err)
+}
+
+func (e LineError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON encodes the message of the error as "error", as errors are not encodable.
+func (e LineError) MarshalJSON() ([]byte, error) {
+	msg := ""
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	return json.Marshal(struct {
+		Line    int    `json:"line"`
+		Text    string `json:"text"`
+		Message string `json:"error"`
+	}{e.Line, e.Text, msg})
+}
+
+// Import reads a plain-text list with one IP, CIDR or "<IP> - <IP>" range per line.
+// Empty lines and everything after a '#' or ';' are ignored, text after the range
+// is treated as annotation. Invalid lines do not abort the import but are
+// collected in the result. An error is only returned if reading or writing fails.
+func (n *NutBreaker) Import(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newImporter(opts)
+	err = scanLines(r, func(line int, text string) error {
+		im.line()
+
+		ipRange, comment := splitListLine(text)
+		if ipRange == "" {
+			return nil
+		}
+
+		value := im.opts.value
+		if im.opts.commentValue && comment != "" {
+			value = []byte(comment)
+		}
+		return im.add(line, text, ipRange, value)
+	})
+	if err != nil {
+		return im.result, err
+	}
+	return im.finish()
+}
+
+// scanLines calls fn for every line of r with its line number starting at 1.
+func scanLines(r io.Reader, fn func(line int, text string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+
+		err := fn(line, text)
+		if err != nil {
+			return err
+		}
+	}
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read line %d: %w", line+1, err)
+	}
+	return nil
+}
+
+// splitListLine splits a line of a plain-text list into its range and its comment or annotation.
+func splitListLine(line string) (ipRange, comment string) {
+	content := line
+	if idx := strings.IndexAny(line, "#;"); idx >= 0 {
+		content = line[:idx]
+		comment = strings.TrimSpace(strings.TrimLeft(line[idx:], "#;"))
+	}
+
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return "", comment
+	}
+
+	num := 1
+	switch {
+	case len(fields) >= 3 && fields[1] == "-":
+		// a - b
+		num = 3
+	case len(fields) >= 2 && strings.HasSuffix(fields[0], "-"):
+		// a- b
+		num = 2
+	case len(fields) >= 2 && strings.HasPrefix(fields[1], "-") && len(fields[1]) > 1:
+		// a -b
+		num = 2
+	}
+
+	ipRange = strings.Join(fields[:num], " ")
+	if annotation := strings.Join(fields[num:], " "); annotation != "" && comment == "" {
+		comment = annotation
+	}
+	return ipRange, comment
+}
+
+// importer validates ranges and writes them in batches.
+type importer struct {
+	n      *NutBreaker
+	opts   importOptions
+	batch  []importRecord
+	result ImportResult
+
+	// owned is set in refresh mode and reports whether a stored value was imported from
+	// the same source. All ranges are written in a single batch after the owned ones were removed.
+	owned func(value []byte) bool
+}
+
+type importRecord struct {
+	ipRange string
+	value   []byte
+}
+
+func (n *NutBreaker) newImporter(opts []ImportOption) *importer {
+	o := newImportOptions(opts)
+	return &importer{
+		n:     n,
+		opts:  o,
+		batch: make([]importRecord, 0, o.batchSize),
+	}
+}
+
+// line counts a read line.
+func (im *importer) line() {
+	im.result.Lines++
+}
+
+// skip counts a range that is filtered out.
+func (im *importer) skip() {
+	im.result.Skipped++
+}
+
+// fail records a line that cannot be imported.
+func (im *importer) fail(line int, text string, err error) {
+	im.result.Failed++
+	im.result.Errors = append(im.result.Errors, LineError{
+		Line: line,
+		Text: text,
+		Err:  err,
+	})
+}
+
+// add validates ipRange and writes the current batch if it is full.
+func (im *importer) add(line int, text, ipRange string, value []byte) error {
+	_, err := im.parse(ipRange)
+	if err != nil {
+		im.fail(line, text, err)
+		return nil
+	}
+
+	im.batch = append(im.batch, importRecord{ipRange: ipRange, value: value})
+	if im.owned != nil || len(im.batch) < im.opts.batchSize {
+		return nil
+	}
+	return im.flush()
+}
+
+// parse parses ipRange with the parser that is selected by WithStrictParsing.
+func (im *importer) parse(ipRange string) (Range, error) {
+	if im.opts.strict {
+		return ParseRangeStrict(ipRange)
+	}
+	return ParseRange(ipRange)
+}
+
+// coalescer merges consecutive adjacent ranges with the same value before they are
+// added to the importer, e.g. the networks of a CIDR decomposition.
+type coalescer struct {
+	im      *importer
+	pending *Range
+	line    int
+}
+
+// add validates ipRange and merges it into the pending range if possible.
+func (c *coalescer) add(line int, text, ipRange string, value []byte) error {
+	r, err := c.im.parse(ipRange)
+	if err != nil {
+		c.im.fail(line, text, err)
+		return nil
+	}
+
+	if c.pending != nil && c.pending.High.Next() == r.Low && bytes.Equal(c.pending.Value, value) {
+		c.pending.High = r.High
+		return nil
+	}
+
+	err = c.flush()
+	if err != nil {
+		return err
+	}
+	c.pending = &Range{Low: r.Low, High: r.High, Value: value}
+	c.line = line
+	return nil
+}
+
+// flush adds the pending range to the importer.
+func (c *coalescer) flush() error {
+	if c.pending == nil {
+		return nil
+	}
+	r := *c.pending
+	c.pending = nil
+	return c.im.add(c.line, r.String(), r.String(), r.Value)
+}
+
+// flush writes the current batch within a single transaction.
+func (im *importer) flush() error {
+	if len(im.batch) == 0 && im.owned == nil {
+		return nil
+	}
+
+	if im.opts.records != nil {
+		*im.opts.records = append(*im.opts.records, im.batch...)
+		im.result.Imported += len(im.batch)
+		im.batch = im.batch[:0]
+		return nil
+	}
+
+	err := im.n.Update(func(tx *Txn) error {
+		if im.owned != nil {
+			err := im.removeOwned(tx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, rec := range im.batch {
+			_, err := tx.Insert(rec.ipRange, rec.value, im.opts.mutationOpts...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import batch: %w", err)
+	}
+
+	im.result.Imported += len(im.batch)
+	im.batch = im.batch[:0]
+	if im.opts.progress != nil {
+		im.opts.progress(im.result.ImportProgress)
+	}
+	return nil
+}
+
+// removeOwned removes all ranges that were imported from the same source.
+func (im *importer) removeOwned(tx *Txn) error {
+	var owned []Range
+	err := tx.Iterate(func(r Range) bool {
+		if im.owned(r.Value) {
+			owned = append(owned, r)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range owned {
+		_, err = tx.Remove(r.String(), im.opts.mutationOpts...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish writes the remaining batch and returns the result.
+func (im *importer) finish() (ImportResult, error) {
+	err := im.flush()
+	if err != nil {
+		return im.result, err
+	}
+	return im.result, nil
+}
+
+// finishList writes the remaining batch and stores the metadata of the imported list.
+func (im *importer) finishList(meta ListMetadata) (ImportResult, error) {
+	result, err := im.finish()
+	if err != nil {
+		return result, err
+	}
+
+	meta.Imported = im.n.now()
+	meta.Entries = result.Imported
+	if im.opts.records == nil {
+		err = im.n.setMetadata(meta)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Metadata = &meta
+	im.result = result
+	return result, nil
+}
+
+// valueTemplate composes a value from literal text and named placeholders like "{asn}:{name}".
+type valueTemplate []templatePart
+
+type templatePart struct {
+	text        string
+	placeholder bool
+}
+
+func parseValueTemplate(tmpl string) (valueTemplate, error) {
+	var result valueTemplate
+	for tmpl != "" {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			result = append(result, templatePart{text: tmpl})
+			break
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in value template: %q", tmpl)
+		}
+		end += start
+
+		if start > 0 {
+			result = append(result, templatePart{text: tmpl[:start]})
+		}
+		result = append(result, templatePart{text: tmpl[start+1 : end], placeholder: true})
+		tmpl = tmpl[end+1:]
+	}
+	return result, nil
+}
+
+// placeholders returns the names of all placeholders.
+func (t valueTemplate) placeholders() []string {
+	var result []string
+	for _, p := range t {
+		if p.placeholder {
+			result = append(result, p.text)
+		}
+	}
+	return result
+}
+
+// execute replaces all placeholders with the values returned by lookup.
+func (t valueTemplate) execute(lookup func(name string) (string, error)) (string, error) {
+	var sb strings.Builder
+	for _, p := range t {
+		if !p.placeholder {
+			sb.WriteString(p.text)
+			continue
+		}
+		v, err := lookup(p.text)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(v)
+	}
+	return sb.String(), nil
+}
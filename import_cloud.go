@@ -0,0 +1,312 @@
+package nutbreaker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CloudProvider is a datacenter or cloud provider that publishes its IP ranges.
+type CloudProvider string
+
+const (
+	// CloudAWS reads ip-ranges.json
+	CloudAWS CloudProvider = "aws"
+	// CloudGCP reads cloud.json
+	CloudGCP CloudProvider = "gcp"
+	// CloudAzure reads the ServiceTags_Public_*.json download
+	CloudAzure CloudProvider = "azure"
+	// CloudOracle reads public_ip_ranges.json
+	CloudOracle CloudProvider = "oracle"
+	// CloudDigitalOcean reads the geo feed google.csv
+	CloudDigitalOcean CloudProvider = "digitalocean"
+)
+
+// cloudPrefix is a single published prefix with its value.
+type cloudPrefix struct {
+	prefix string
+	value  string
+}
+
+// ImportCloudRanges imports the published IP ranges of a cloud provider.
+// Every prefix is stored with a value like "aws:us-east-1:EC2" that starts with the provider name.
+// In combination with WithRefresh, all ranges that were previously imported for the same provider
+// are replaced within a single transaction, ranges of other providers and lists are kept.
+// IPv6 prefixes are skipped.
+func (n *NutBreaker) ImportCloudRanges(provider CloudProvider, r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	var (
+		prefixes []cloudPrefix
+		meta     ListMetadata
+	)
+	switch provider {
+	case CloudAWS:
+		prefixes, meta, err = parseAWSRanges(r)
+	case CloudGCP:
+		prefixes, meta, err = parseGCPRanges(r)
+	case CloudAzure:
+		prefixes, meta, err = parseAzureRanges(r)
+	case CloudOracle:
+		prefixes, meta, err = parseOracleRanges(r)
+	case CloudDigitalOcean:
+		prefixes, meta, err = parseDigitalOceanRanges(r)
+	default:
+		return ImportResult{}, fmt.Errorf("unknown cloud provider: %s", provider)
+	}
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("%w: %s: %w", ErrInvalidListFormat, provider, err)
+	}
+	meta.Name = string(provider)
+	meta.Format = string(provider)
+
+	im := n.newImporter(opts)
+	if im.opts.refresh {
+		owner := string(provider) + ":"
+		im.owned = func(value []byte) bool {
+			return strings.HasPrefix(string(value), owner)
+		}
+	}
+
+	for idx, p := range prefixes {
+		im.line()
+		if isIPv6Prefix(p.prefix) {
+			im.skip()
+			continue
+		}
+
+		err = im.add(idx+1, p.prefix, p.prefix, []byte(string(provider)+":"+p.value))
+		if err != nil {
+			return im.result, err
+		}
+	}
+	return im.finishList(meta)
+}
+
+func isIPv6Prefix(prefix string) bool {
+	p, err := netip.ParsePrefix(prefix)
+	return err == nil && p.Addr().Is6()
+}
+
+func parseAWSRanges(r io.Reader) ([]cloudPrefix, ListMetadata, error) {
+	var doc struct {
+		SyncToken  string `json:"syncToken"`
+		CreateDate string `json:"createDate"`
+		Prefixes   []struct {
+			IPPrefix string `json:"ip_prefix"`
+			Region   string `json:"region"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+	}
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, ListMetadata{}, err
+	}
+
+	meta := ListMetadata{
+		Version: doc.SyncToken,
+		Source:  "https://ip-ranges.amazonaws.com/ip-ranges.json",
+	}
+	if t, err := time.Parse("2006-01-02-15-04-05", doc.CreateDate); err == nil {
+		meta.Generated = t
+	}
+
+	// every prefix is listed for the AMAZON service and additionally for its specific service
+	specific := make(map[string]bool, len(doc.Prefixes))
+	for _, p := range doc.Prefixes {
+		if p.Service != "AMAZON" {
+			specific[p.IPPrefix] = true
+		}
+	}
+
+	result := make([]cloudPrefix, 0, len(doc.Prefixes))
+	for _, p := range doc.Prefixes {
+		if p.Service == "AMAZON" && specific[p.IPPrefix] {
+			continue
+		}
+		result = append(result, cloudPrefix{
+			prefix: p.IPPrefix,
+			value:  p.Region + ":" + p.Service,
+		})
+	}
+	return result, meta, nil
+}
+
+func parseGCPRanges(r io.Reader) ([]cloudPrefix, ListMetadata, error) {
+	var doc struct {
+		SyncToken    string `json:"syncToken"`
+		CreationTime string `json:"creationTime"`
+		Prefixes     []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, ListMetadata{}, err
+	}
+
+	meta := ListMetadata{
+		Version: doc.SyncToken,
+		Source:  "https://www.gstatic.com/ipranges/cloud.json",
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05.999999999", doc.CreationTime); err == nil {
+		meta.Generated = t
+	}
+
+	result := make([]cloudPrefix, 0, len(doc.Prefixes))
+	for _, p := range doc.Prefixes {
+		prefix := p.IPv4Prefix
+		if prefix == "" {
+			prefix = p.IPv6Prefix
+		}
+		result = append(result, cloudPrefix{
+			prefix: prefix,
+			value:  p.Scope + ":" + p.Service,
+		})
+	}
+	return result, meta, nil
+}
+
+func parseAzureRanges(r io.Reader) ([]cloudPrefix, ListMetadata, error) {
+	var doc struct {
+		ChangeNumber int    `json:"changeNumber"`
+		Cloud        string `json:"cloud"`
+		Values       []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, ListMetadata{}, err
+	}
+
+	meta := ListMetadata{
+		Version:  strconv.Itoa(doc.ChangeNumber),
+		Category: doc.Cloud,
+	}
+
+	// service tags overlap, e.g. AzureCloud contains all ranges, AzureCloud.westeurope
+	// the ranges of a region and Storage.westeurope a service within that region.
+	// Less specific tags are imported first in order to be overwritten by more specific ones.
+	specificity := func(region, service string) int {
+		rank := 0
+		if region != "" {
+			rank++
+		}
+		if service != "" {
+			rank += 2
+		}
+		return rank
+	}
+	values := doc.Values
+	sort.SliceStable(values, func(i, j int) bool {
+		pi, pj := values[i].Properties, values[j].Properties
+		return specificity(pi.Region, pi.SystemService) < specificity(pj.Region, pj.SystemService)
+	})
+
+	var result []cloudPrefix
+	for _, v := range values {
+		region := v.Properties.Region
+		if region == "" {
+			region = "global"
+		}
+		service := v.Properties.SystemService
+		if service == "" {
+			// AzureCloud.westeurope
+			service, _, _ = strings.Cut(v.Name, ".")
+		}
+		for _, p := range v.Properties.AddressPrefixes {
+			result = append(result, cloudPrefix{
+				prefix: p,
+				value:  region + ":" + service,
+			})
+		}
+	}
+	return result, meta, nil
+}
+
+func parseOracleRanges(r io.Reader) ([]cloudPrefix, ListMetadata, error) {
+	var doc struct {
+		LastUpdated string `json:"last_updated_timestamp"`
+		Regions     []struct {
+			Region string `json:"region"`
+			CIDRs  []struct {
+				CIDR string   `json:"cidr"`
+				Tags []string `json:"tags"`
+			} `json:"cidrs"`
+		} `json:"regions"`
+	}
+	err := json.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, ListMetadata{}, err
+	}
+
+	meta := ListMetadata{
+		Version: doc.LastUpdated,
+		Source:  "https://docs.oracle.com/en-us/iaas/tools/public_ip_ranges.json",
+	}
+	if t, err := time.Parse("2006-01-02T15:04:05.999999999", doc.LastUpdated); err == nil {
+		meta.Generated = t
+	}
+
+	var result []cloudPrefix
+	for _, region := range doc.Regions {
+		for _, c := range region.CIDRs {
+			result = append(result, cloudPrefix{
+				prefix: c.CIDR,
+				value:  region.Region + ":" + strings.Join(c.Tags, ","),
+			})
+		}
+	}
+	return result, meta, nil
+}
+
+// parseDigitalOceanRanges reads the RFC 8805 geo feed with the columns prefix, country, region, city and postal code.
+func parseDigitalOceanRanges(r io.Reader) ([]cloudPrefix, ListMetadata, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+
+	meta := ListMetadata{
+		Source: "https://digitalocean.com/geo/google.csv",
+	}
+
+	var result []cloudPrefix
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ListMetadata{}, err
+		}
+		if len(record) < 4 {
+			line, _ := cr.FieldPos(0)
+			return nil, ListMetadata{}, fmt.Errorf("line %d: expected at least 4 columns, got %d", line, len(record))
+		}
+
+		result = append(result, cloudPrefix{
+			prefix: record[0],
+			value:  record[2] + ":" + record[3],
+		})
+	}
+	return result, meta, nil
+}
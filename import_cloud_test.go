@@ -0,0 +1,98 @@
+package nutbreaker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func importCloudFile(t *testing.T, ndb *NutBreaker, provider CloudProvider, name string, opts ...ImportOption) ImportResult {
+	f, err := os.Open(filepath.Join("testdata", "cloud", name))
+	require.NoError(t, err)
+	defer f.Close()
+
+	result, err := ndb.ImportCloudRanges(provider, f, opts...)
+	require.NoError(t, err, name)
+	require.Empty(t, result.Errors, name)
+	return result
+}
+
+func TestImportCloudRanges(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	result := importCloudFile(t, ndb, CloudAWS, "aws-ip-ranges.json")
+	require.Equal(3, result.Imported)
+	require.Equal("1728130990", result.Metadata.Version)
+
+	result = importCloudFile(t, ndb, CloudGCP, "gcp-cloud.json")
+	require.Equal(2, result.Imported)
+	require.Equal(1, result.Skipped)
+
+	result = importCloudFile(t, ndb, CloudAzure, "azure-servicetags.json")
+	require.Equal(4, result.Imported)
+	require.Equal(1, result.Skipped)
+
+	importCloudFile(t, ndb, CloudOracle, "oracle-public-ip-ranges.json")
+	importCloudFile(t, ndb, CloudDigitalOcean, "digitalocean-google.csv")
+
+	for ip, expected := range map[string]string{
+		"3.2.34.1":     "aws:af-south-1:AMAZON",
+		"3.5.140.1":    "aws:ap-northeast-2:S3",
+		"52.94.79.1":   "aws:us-east-1:EC2",
+		"34.1.208.1":   "gcp:africa-south1:Google Cloud",
+		"20.38.108.1":  "azure:westeurope:AzureStorage",
+		"20.38.96.1":   "azure:westeurope:AzureCloud",
+		"40.74.0.1":    "azure:global:AzureCloud",
+		"134.70.8.1":   "oracle:us-phoenix-1:OSN,OBJECT_STORAGE",
+		"45.55.32.1":   "digitalocean:US-NY:New York",
+		"5.101.96.255": "digitalocean:NL-NH:Amsterdam",
+	} {
+		v, err := ndb.Find(ip)
+		require.NoError(err, ip)
+		require.Equal(expected, string(v), ip)
+	}
+
+	all, err := ndb.AllMetadata()
+	require.NoError(err)
+	require.Len(all, 5)
+	consistent(t, ndb)
+}
+
+func TestImportCloudRangesRefresh(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	importCloudFile(t, ndb, CloudAWS, "aws-ip-ranges.json")
+	importCloudFile(t, ndb, CloudGCP, "gcp-cloud.json")
+	_, err := ndb.Insert("52.94.78.0/24", []byte("vpn"))
+	require.NoError(err)
+
+	result := importCloudFile(t, ndb, CloudAWS, "aws-ip-ranges-refresh.json", WithRefresh())
+	require.Equal(1, result.Imported)
+
+	for _, ip := range []string{"3.2.34.1", "3.5.140.1", "52.94.79.1"} {
+		_, err = ndb.Find(ip)
+		require.ErrorIs(err, ErrIPNotFound, ip)
+	}
+
+	for ip, expected := range map[string]string{
+		"52.94.76.1": "aws:us-east-1:EC2",
+		"52.94.78.1": "vpn",
+		"34.35.0.1":  "gcp:us-east1:Google Cloud",
+	} {
+		v, err := ndb.Find(ip)
+		require.NoError(err, ip)
+		require.Equal(expected, string(v), ip)
+	}
+
+	meta, err := ndb.Metadata(string(CloudAWS))
+	require.NoError(err)
+	require.Equal("1728217390", meta.Version)
+	require.Equal(1, meta.Entries)
+	consistent(t, ndb)
+}
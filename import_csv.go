@@ -0,0 +1,282 @@
+package nutbreaker
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// AddrEncoding is the representation of the IPs in a CSV column.
+type AddrEncoding string
+
+const (
+	// AddrDotted is the default textual representation, e.g. 1.2.3.4
+	AddrDotted AddrEncoding = "dotted"
+	// AddrDecimal is the unsigned 32 bit integer representation, e.g. 16909060
+	AddrDecimal AddrEncoding = "decimal"
+	// AddrHex is the 32 bit hexadecimal representation with an optional 0x prefix, e.g. 0x01020304
+	AddrHex AddrEncoding = "hex"
+	// AddrDecimal6 is the unsigned 128 bit integer representation of IPv6 addresses,
+	// IPv4-mapped addresses are imported as IPv4 addresses, e.g. 281470698652420
+	AddrDecimal6 AddrEncoding = "decimal6"
+	// AddrHex6 is the 128 bit hexadecimal representation of IPv6 addresses with an optional 0x prefix,
+	// IPv4-mapped addresses are imported as IPv4 addresses, e.g. 0xffff01020304
+	AddrHex6 AddrEncoding = "hex6"
+)
+
+// CSVMapping describes how the columns of a CSV file are mapped to ranges and values.
+// Columns are referenced by their name from the header row or by their index starting at 0.
+type CSVMapping struct {
+	// Header reports whether the first row contains the column names.
+	Header bool
+	// Comma is the field delimiter, defaults to ','.
+	Comma rune
+
+	// Range is the column that contains an IP, a CIDR or a "<IP> - <IP>" range.
+	Range string
+	// Low and High are the columns that contain the first and the last IP of a range.
+	// High may be omitted for single IPs. They are ignored if Range is set.
+	Low  string
+	High string
+	// Encoding is the representation of the Low and High columns, defaults to AddrDotted.
+	Encoding AddrEncoding
+
+	// Value is a template that composes the value from columns, e.g. "{asn}:{name}" or "{2}".
+	// Rows are stored with the value set with WithValue if Value is empty.
+	Value string
+}
+
+// ImportCSV imports an arbitrary CSV file with the given column mapping.
+// Malformed rows do not abort the import but are collected in the result.
+func (n *NutBreaker) ImportCSV(r io.Reader, mapping CSVMapping, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	if mapping.Range == "" && mapping.Low == "" {
+		return ImportResult{}, errors.New("csv mapping requires either a range or a low column")
+	}
+
+	encoding := mapping.Encoding
+	if encoding == "" {
+		encoding = AddrDotted
+	}
+	parseAddr, err := addrParser(encoding)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	var (
+		im    = n.newImporter(opts)
+		cols  csvColumns
+		value valueTemplate
+	)
+	err = readCSV(r, mapping.Comma, func(line int, record []string, perr error) error {
+		im.line()
+		if perr != nil {
+			im.fail(line, "", fmt.Errorf("%w: %w", ErrInvalidListFormat, perr))
+			return nil
+		}
+
+		if cols == nil {
+			cols, value, err = newCSVLayout(mapping, record)
+			if err != nil {
+				return err
+			}
+			if mapping.Header {
+				return nil
+			}
+		}
+
+		text := strings.Join(record, string(csvComma(mapping.Comma)))
+		ipRange, err := csvRange(mapping, cols, record, parseAddr)
+		if err != nil {
+			im.fail(line, text, err)
+			return nil
+		}
+
+		v := im.opts.value
+		if mapping.Value != "" {
+			s, err := value.execute(func(column string) (string, error) {
+				return cols.get(record, column)
+			})
+			if err != nil {
+				im.fail(line, text, err)
+				return nil
+			}
+			v = []byte(s)
+		}
+		return im.add(line, text, ipRange, v)
+	})
+	if err != nil {
+		return im.result, err
+	}
+	return im.finish()
+}
+
+// newCSVLayout resolves all columns of the mapping with the first row of a file.
+func newCSVLayout(mapping CSVMapping, first []string) (csvColumns, valueTemplate, error) {
+	cols := newCSVColumns(len(first))
+	if mapping.Header {
+		cols = newCSVHeader(first)
+	}
+
+	value, err := parseValueTemplate(mapping.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := append([]string{mapping.Range, mapping.Low, mapping.High}, value.placeholders()...)
+	for _, c := range columns {
+		if c == "" {
+			continue
+		}
+		_, err := cols.index(c)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return cols, value, nil
+}
+
+// csvRange returns the range of a row.
+func csvRange(mapping CSVMapping, cols csvColumns, record []string, parseAddr func(string) (netip.Addr, error)) (string, error) {
+	if mapping.Range != "" {
+		return cols.get(record, mapping.Range)
+	}
+
+	low, err := cols.get(record, mapping.Low)
+	if err != nil {
+		return "", err
+	}
+	lowAddr, err := parseAddr(low)
+	if err != nil {
+		return "", err
+	}
+	if mapping.High == "" {
+		return lowAddr.String(), nil
+	}
+
+	high, err := cols.get(record, mapping.High)
+	if err != nil {
+		return "", err
+	}
+	highAddr, err := parseAddr(high)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s - %s", lowAddr, highAddr), nil
+}
+
+func addrParser(encoding AddrEncoding) (func(string) (netip.Addr, error), error) {
+	switch encoding {
+	case AddrDotted:
+		return func(s string) (netip.Addr, error) {
+			addr, err := netip.ParseAddr(strings.TrimSpace(s))
+			if err != nil {
+				return netip.Addr{}, fmt.Errorf("%w: %w", ErrInvalidRange, err)
+			}
+			return addr, nil
+		}, nil
+	case AddrDecimal, AddrDecimal6:
+		return func(s string) (netip.Addr, error) {
+			return parseIPNumber(s, 10, encoding == AddrDecimal6)
+		}, nil
+	case AddrHex, AddrHex6:
+		return func(s string) (netip.Addr, error) {
+			h := strings.TrimSpace(s)
+			h = strings.TrimPrefix(strings.TrimPrefix(h, "0x"), "0X")
+			return parseIPNumber(h, 16, encoding == AddrHex6)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown address encoding: %s", encoding)
+	}
+}
+
+// readCSV calls fn for every row of r with the line number at which the row starts.
+// Malformed rows are passed as nil record with their *csv.ParseError.
+func readCSV(r io.Reader, comma rune, fn func(line int, record []string, perr error) error) error {
+	cr := csv.NewReader(r)
+	cr.Comma = csvComma(comma)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			err = fn(perr.StartLine, nil, perr)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read row %d: %w", row, err)
+		}
+
+		line, _ := cr.FieldPos(0)
+		err = fn(line, record, nil)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func csvComma(comma rune) rune {
+	if comma == 0 {
+		return ','
+	}
+	return comma
+}
+
+// csvColumns maps column names to their indices.
+type csvColumns map[string]int
+
+func newCSVColumns(num int) csvColumns {
+	cols := make(csvColumns, num)
+	for i := 0; i < num; i++ {
+		cols[strconv.Itoa(i)] = i
+	}
+	return cols
+}
+
+func newCSVHeader(header []string) csvColumns {
+	cols := newCSVColumns(len(header))
+	for i, name := range header {
+		cols[strings.TrimSpace(name)] = i
+	}
+	return cols
+}
+
+func (c csvColumns) index(column string) (int, error) {
+	idx, ok := c[column]
+	if !ok {
+		if i, err := strconv.Atoi(column); err == nil && i >= 0 {
+			// rows may have more columns than the first one
+			return i, nil
+		}
+		return 0, fmt.Errorf("unknown csv column: %s", column)
+	}
+	return idx, nil
+}
+
+func (c csvColumns) get(record []string, column string) (string, error) {
+	idx, err := c.index(column)
+	if err != nil {
+		return "", err
+	}
+	if idx >= len(record) {
+		return "", fmt.Errorf("%w: missing column %s", ErrInvalidListFormat, column)
+	}
+	return strings.TrimSpace(record[idx]), nil
+}
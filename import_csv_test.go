@@ -0,0 +1,157 @@
+package nutbreaker
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		csv      string
+		mapping  CSVMapping
+		imported int
+		failed   []int
+		expected map[string]string
+	}{
+		{
+			name: "start end reason",
+			csv: strings.Join([]string{
+				"start,end,reason",
+				"10.0.0.0,10.0.0.255,abuse",
+				"10.0.1.0,invalid,abuse",
+				"10.0.2.1,,single",
+			}, "\n"),
+			mapping: CSVMapping{Header: true, Low: "start", High: "end", Value: "{reason}"},
+			// an empty end column is invalid
+			imported: 1,
+			failed:   []int{3, 4},
+			expected: map[string]string{"10.0.0.128": "abuse"},
+		},
+		{
+			name: "cidr asn name",
+			csv: strings.Join([]string{
+				"cidr;asn;name",
+				"11.0.0.0/24;AS64500;\"Example; Inc\"",
+				"11.0.1.0/33;AS64501;Broken",
+				"11.0.2.0/24;AS64502",
+			}, "\n"),
+			mapping:  CSVMapping{Header: true, Comma: ';', Range: "cidr", Value: "{asn}:{name}"},
+			imported: 1,
+			failed:   []int{3, 4},
+			expected: map[string]string{"11.0.0.1": "AS64500:Example; Inc"},
+		},
+		{
+			name: "decimal without header",
+			csv: strings.Join([]string{
+				"201326592,201326847,vpn,de",
+				"201327104,201327104,tor,nl",
+				"-1,201327104,tor,nl",
+			}, "\n"),
+			mapping:  CSVMapping{Low: "0", High: "1", Encoding: AddrDecimal, Value: "{2}-{3}"},
+			imported: 2,
+			failed:   []int{3},
+			expected: map[string]string{
+				"12.0.0.255": "vpn-de",
+				"12.0.2.0":   "tor-nl",
+			},
+		},
+		{
+			name: "hex single ip",
+			csv: strings.Join([]string{
+				"0x0D000001,\"proxy\"",
+				"0D000002,proxy",
+				"\"unterminated,proxy",
+			}, "\n"),
+			mapping:  CSVMapping{Low: "0", Encoding: AddrHex, Value: "hex {1}"},
+			imported: 2,
+			failed:   []int{3},
+			expected: map[string]string{
+				"13.0.0.1": "hex proxy",
+				"13.0.0.2": "hex proxy",
+			},
+		},
+		{
+			name: "ipv6 numbers",
+			csv: strings.Join([]string{
+				"281470916624384,281470916624639,mapped",
+				"0xffff0e000100,0xffff0e000100,mapped hex",
+				"234881024,234881279,compatible",
+			}, "\n"),
+			mapping: CSVMapping{Low: "0", High: "1", Encoding: AddrDecimal6, Value: "{2}"},
+			// the hex number is not decimal, small numbers are IPv6 addresses within ::/96
+			imported: 1,
+			failed:   []int{2, 3},
+			expected: map[string]string{
+				"14.0.0.255": "mapped",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ndb, cleanup := initDB(t)
+			defer cleanup()
+			require := require.New(t)
+
+			result, err := ndb.ImportCSV(strings.NewReader(tt.csv), tt.mapping)
+			require.NoError(err)
+			require.Equal(tt.imported, result.Imported)
+
+			failed := make([]int, 0, len(result.Errors))
+			for _, e := range result.Errors {
+				failed = append(failed, e.Line)
+			}
+			require.Equal(tt.failed, failed)
+
+			for ip, expected := range tt.expected {
+				v, err := ndb.Find(ip)
+				require.NoError(err, ip)
+				require.Equal(expected, string(v), ip)
+			}
+			consistent(t, ndb)
+		})
+	}
+}
+
+func TestImportCSVParseError(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	result, err := ndb.ImportCSV(strings.NewReader("10.0.0.1,a\n10.0.0.2,b\"c\n"), CSVMapping{Range: "0", Value: "{1}"})
+	require.NoError(err)
+	require.Equal(1, result.Imported)
+	require.Len(result.Errors, 1)
+
+	var perr *csv.ParseError
+	require.ErrorIs(result.Errors[0], ErrInvalidListFormat)
+	require.ErrorAs(result.Errors[0], &perr)
+	require.ErrorIs(perr, csv.ErrBareQuote)
+	require.Equal(2, perr.Line)
+	require.Equal(11, perr.Column)
+}
+
+func TestImportCSVMapping(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.ImportCSV(strings.NewReader("a,b\n"), CSVMapping{})
+	require.Error(err)
+
+	_, err = ndb.ImportCSV(strings.NewReader("a,b\n"), CSVMapping{Header: true, Range: "c"})
+	require.Error(err)
+
+	_, err = ndb.ImportCSV(strings.NewReader("a,b\n"), CSVMapping{Header: true, Range: "a", Value: "{c}"})
+	require.Error(err)
+
+	_, err = ndb.ImportCSV(strings.NewReader("a,b\n"), CSVMapping{Header: true, Range: "a", Value: "{a"})
+	require.Error(err)
+
+	_, err = ndb.ImportCSV(strings.NewReader("a,b\n"), CSVMapping{Low: "0", Encoding: "octal"})
+	require.Error(err)
+}
@@ -0,0 +1,99 @@
+package nutbreaker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ImportFireHOL imports a FireHOL .netset or .ipset file.
+// Every range is associated with the category of the list or with the value set with WithValue
+// in case that the list does not announce a category. The list name, version and generation
+// date are taken from the header and stored as metadata of the list.
+func (n *NutBreaker) ImportFireHOL(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newImporter(opts)
+	meta := ListMetadata{Format: "firehol"}
+
+	var value []byte
+	header := true
+	err = scanLines(r, func(line int, text string) error {
+		im.line()
+
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "#") {
+			if header {
+				parseFireHOLHeader(&meta, strings.TrimSpace(strings.TrimPrefix(trimmed, "#")))
+			}
+			return nil
+		}
+		if trimmed == "" {
+			return nil
+		}
+
+		if header {
+			header = false
+			if meta.Name == "" {
+				return fmt.Errorf("%w: missing FireHOL header", ErrInvalidListFormat)
+			}
+			value = im.opts.value
+			if meta.Category != "" {
+				value = []byte(meta.Category)
+			}
+		}
+		return im.add(line, text, trimmed, value)
+	})
+	if err != nil {
+		return im.result, err
+	}
+	if header && meta.Name == "" {
+		return im.result, fmt.Errorf("%w: missing FireHOL header", ErrInvalidListFormat)
+	}
+	return im.finishList(meta)
+}
+
+// parseFireHOLHeader extracts the metadata from a single header line without its leading '#'.
+func parseFireHOLHeader(meta *ListMetadata, line string) {
+	if line == "" {
+		return
+	}
+
+	key, value, found := strings.Cut(line, ":")
+	if !found {
+		// the name is the first line of the header
+		if meta.Name == "" {
+			meta.Name = line
+		}
+		return
+	}
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "Category":
+		meta.Category = value
+	case "Version":
+		meta.Version = value
+	case "List source URL":
+		if value != "" {
+			meta.Source = value
+		}
+	case "Maintainer URL":
+		if meta.Source == "" {
+			meta.Source = value
+		}
+	case "This File Date":
+		if t, err := time.Parse(time.UnixDate, value); err == nil {
+			meta.Generated = t
+		}
+	case "Source File Date":
+		if t, err := time.Parse(time.UnixDate, value); err == nil && meta.Generated.IsZero() {
+			meta.Generated = t
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package nutbreaker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WithSetFilter only imports the entries of the ipset or nftables set or of the iptables chain with the given name.
+func WithSetFilter(name string) ImportOption {
+	return func(o *importOptions) {
+		o.set = name
+	}
+}
+
+// ImportIPSet imports the hash:ip and hash:net entries of an `ipset save` file.
+// The comment of an entry is used as its value, entries without comment are stored with
+// the value set with WithValue. Entries with the nomatch option are exceptions of the set
+// and are skipped.
+func (n *NutBreaker) ImportIPSet(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newImporter(opts)
+	c := coalescer{im: im}
+	err = scanLines(r, func(line int, text string) error {
+		im.line()
+
+		tokens, err := tokenize(text, "", false)
+		if err != nil {
+			im.fail(line, text, err)
+			return nil
+		}
+		if len(tokens) == 0 || (tokens[0].text != "add" && tokens[0].text != "-A") {
+			return nil
+		}
+		if len(tokens) < 3 {
+			im.fail(line, text, fmt.Errorf("%w: missing set entry", ErrInvalidListFormat))
+			return nil
+		}
+		if im.opts.set != "" && tokens[1].text != im.opts.set || hasOption(tokens[3:], "nomatch") {
+			im.skip()
+			return nil
+		}
+
+		value := im.opts.value
+		if comment, ok := optionValue(tokens[3:], "comment"); ok {
+			value = []byte(comment)
+		}
+		return c.add(line, text, tokens[2].text, value)
+	})
+	if err == nil {
+		err = c.flush()
+	}
+	if err != nil {
+		return im.result, err
+	}
+	return im.finish()
+}
+
+// ImportIPTables imports the source addresses of the rules of an `iptables-save` file
+// or of a script with iptables commands. The comment of a rule is used as its value, rules
+// without comment are stored with the value set with WithValue. Negated sources are ignored.
+// Only rules that drop or reject their packets are imported, rules with sources and another
+// target, e.g. ACCEPT, RETURN or a jump to a chain, are skipped.
+func (n *NutBreaker) ImportIPTables(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newImporter(opts)
+	c := coalescer{im: im}
+	err = scanLines(r, func(line int, text string) error {
+		im.line()
+
+		tokens, err := tokenize(text, "", false)
+		if err != nil {
+			im.fail(line, text, err)
+			return nil
+		}
+		if len(tokens) > 0 && (tokens[0].text == "iptables" || tokens[0].text == "iptables-legacy" || tokens[0].text == "iptables-nft") {
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 || (tokens[0].text != "-A" && tokens[0].text != "-I" && tokens[0].text != "--append") {
+			return nil
+		}
+		if im.opts.set != "" && tokens[1].text != im.opts.set {
+			im.skip()
+			return nil
+		}
+
+		var sources []string
+		for i := 2; i < len(tokens)-1; i++ {
+			switch tokens[i].text {
+			case "-s", "--source", "--src-range":
+				if tokens[i-1].text == "!" {
+					continue
+				}
+				sources = append(sources, strings.Split(tokens[i+1].text, ",")...)
+			}
+		}
+		if len(sources) == 0 {
+			return nil
+		}
+		target, _ := optionValue(tokens[2:], "-j")
+		if target == "" {
+			target, _ = optionValue(tokens[2:], "--jump")
+		}
+		if target != "DROP" && target != "REJECT" {
+			im.skip()
+			return nil
+		}
+
+		value := im.opts.value
+		if comment, ok := optionValue(tokens[2:], "--comment"); ok {
+			value = []byte(comment)
+		}
+		for _, s := range sources {
+			err = c.add(line, text, s, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = c.flush()
+	}
+	if err != nil {
+		return im.result, err
+	}
+	return im.finish()
+}
+
+// ImportNFTables imports the elements of all IPv4 sets of an nftables ruleset as printed by
+// `nft list ruleset` or of `add element` commands. The comment of an element is used as its value,
+// elements without comment are stored with the value set with WithValue.
+// Other element commands like `delete element` are reported as line errors.
+func (n *NutBreaker) ImportNFTables(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newImporter(opts)
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return im.result, fmt.Errorf("failed to read nftables ruleset: %w", err)
+	}
+	im.result.Lines = strings.Count(string(data), "\n")
+
+	tokens, err := tokenize(string(data), "{},=;", true)
+	if err != nil {
+		return im.result, fmt.Errorf("%w: %w", ErrInvalidListFormat, err)
+	}
+
+	var (
+		set   string // name of the current set
+		depth int    // nesting depth of braces
+		sets  []int  // depth of every enclosing set block
+	)
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.text == "{" && !t.quoted:
+			depth++
+		case t.text == "}" && !t.quoted:
+			if len(sets) > 0 && sets[len(sets)-1] == depth {
+				sets = sets[:len(sets)-1]
+				set = ""
+			}
+			depth--
+		case t.text == "set" && !t.quoted && i+2 < len(tokens) && tokens[i+2].text == "{":
+			// set <name> {
+			set = tokens[i+1].text
+			sets = append(sets, depth+1)
+		case t.text == "elements" && !t.quoted && set != "" &&
+			i+2 < len(tokens) && tokens[i+1].text == "=" && tokens[i+2].text == "{":
+			i, err = n.importNFTElements(im, set, tokens, i+3)
+			if err != nil {
+				return im.result, err
+			}
+		case t.text == "element" && !t.quoted:
+			// add element [family] <table> <set> { ... }
+			j := i + 1
+			for j < len(tokens) && tokens[j].text != "{" {
+				j++
+			}
+			if j >= len(tokens) || j == i+1 {
+				return im.result, fmt.Errorf("%w: line %d: missing set of element", ErrInvalidListFormat, t.line)
+			}
+			if i == 0 || (tokens[i-1].text != "add" && tokens[i-1].text != "create") {
+				// only added elements are imported, e.g. delete element commands are refused
+				end := j
+				for end < len(tokens) && (tokens[end].text != "}" || tokens[end].quoted) {
+					end++
+				}
+				start := max(i-1, 0)
+				parts := make([]string, 0, j-start)
+				for _, tok := range tokens[start:j] {
+					parts = append(parts, tok.text)
+				}
+				im.fail(t.line, strings.Join(parts, " "), fmt.Errorf("%w: unsupported command: %s", ErrInvalidListFormat, parts[0]))
+				i = end
+				continue
+			}
+			i, err = n.importNFTElements(im, tokens[j-1].text, tokens, j+1)
+			if err != nil {
+				return im.result, err
+			}
+		}
+	}
+	return im.finish()
+}
+
+// importNFTElements imports the elements starting at tokens[start] up to the closing brace
+// and returns the index of the closing brace.
+func (n *NutBreaker) importNFTElements(im *importer, set string, tokens []token, start int) (int, error) {
+	var element []token
+	add := func() error {
+		if len(element) == 0 {
+			return nil
+		}
+		defer func() {
+			element = element[:0]
+		}()
+
+		if im.opts.set != "" && set != im.opts.set {
+			im.skip()
+			return nil
+		}
+
+		parts := make([]string, 0, len(element))
+		for _, t := range element {
+			parts = append(parts, t.text)
+		}
+		text := strings.Join(parts, " ")
+
+		// the element ends with its first keyword
+		end := len(element)
+		for i, t := range element {
+			if i > 0 && !t.quoted && isNFTKeyword(t.text) {
+				end = i
+				break
+			}
+		}
+		ipRange := strings.Join(parts[:end], " ")
+
+		value := im.opts.value
+		if comment, ok := optionValue(element[end:], "comment"); ok {
+			value = []byte(comment)
+		}
+		return im.add(element[0].line, text, ipRange, value)
+	}
+
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.text == "}" && !t.quoted:
+			return i, add()
+		case t.text == "," && !t.quoted:
+			err := add()
+			if err != nil {
+				return 0, err
+			}
+		default:
+			element = append(element, t)
+		}
+	}
+	return 0, fmt.Errorf("%w: unterminated elements of set %s", ErrInvalidListFormat, set)
+}
+
+func isNFTKeyword(s string) bool {
+	switch s {
+	case "comment", "timeout", "expires", "counter", "packets", "bytes":
+		return true
+	}
+	return false
+}
+
+// optionValue returns the token that follows the given option name.
+func optionValue(tokens []token, name string) (string, bool) {
+	for i := 0; i < len(tokens)-1; i++ {
+		if tokens[i].text == name && !tokens[i].quoted {
+			return tokens[i+1].text, true
+		}
+	}
+	return "", false
+}
+
+// hasOption reports whether tokens contain the unquoted flag name.
+func hasOption(tokens []token, name string) bool {
+	for _, t := range tokens {
+		if t.text == name && !t.quoted {
+			return true
+		}
+	}
+	return false
+}
+
+// token is a single word of a firewall configuration.
+type token struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// tokenize splits s into words separated by whitespace. Every character in specials is a word of its own.
+// Double quoted words may contain backslash escapes, single quoted words are taken literally.
+// If hashComments is set, everything from an unquoted '#' to the end of the line is ignored.
+func tokenize(s, specials string, hashComments bool) ([]token, error) {
+	var (
+		result []token
+		word   strings.Builder
+		inWord bool
+		quoted bool
+		line   = 1
+	)
+	flush := func() {
+		if inWord {
+			result = append(result, token{text: word.String(), line: line, quoted: quoted})
+		}
+		word.Reset()
+		inWord = false
+		quoted = false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\n':
+			flush()
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		case hashComments && c == '#' && !inWord:
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			i--
+		case strings.IndexByte(specials, c) >= 0:
+			flush()
+			result = append(result, token{text: string(c), line: line})
+		case c == '"' || c == '\'':
+			end := i + 1
+			for ; end < len(s) && s[end] != c; end++ {
+				if c == '"' && s[end] == '\\' && end+1 < len(s) {
+					end++
+					word.WriteByte(s[end])
+					continue
+				}
+				if s[end] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated quote", line)
+				}
+				word.WriteByte(s[end])
+			}
+			if end == len(s) {
+				return nil, fmt.Errorf("line %d: unterminated quote", line)
+			}
+			inWord = true
+			quoted = true
+			i = end
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	return result, nil
+}
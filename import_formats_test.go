@@ -0,0 +1,175 @@
+package nutbreaker
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportFireHOL(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	f, err := os.Open("testdata/firehol_level1.netset")
+	require.NoError(err)
+	defer f.Close()
+
+	result, err := ndb.ImportFireHOL(f)
+	require.NoError(err)
+	require.Equal(5, result.Imported)
+	require.Empty(result.Errors)
+
+	require.NotNil(result.Metadata)
+	meta := *result.Metadata
+	require.Equal("firehol_level1", meta.Name)
+	require.Equal("firehol", meta.Format)
+	require.Equal("attacks", meta.Category)
+	require.Equal("29837", meta.Version)
+	require.Equal("http://iplists.firehol.org/", meta.Source)
+	require.True(time.Date(2024, time.October, 5, 9, 48, 33, 0, time.UTC).Equal(meta.Generated))
+	require.Equal(5, meta.Entries)
+
+	stored, err := ndb.Metadata("firehol_level1")
+	require.NoError(err)
+	require.Equal(meta.Version, stored.Version)
+	require.True(meta.Generated.Equal(stored.Generated))
+
+	v, err := ndb.Find("1.10.20.1")
+	require.NoError(err)
+	require.Equal([]byte("attacks"), v)
+	consistent(t, ndb)
+
+	_, err = ndb.ImportFireHOL(strings.NewReader("1.2.3.4\n"))
+	require.ErrorIs(err, ErrInvalidListFormat)
+}
+
+func TestImportSpamhaus(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	for _, name := range []string{"testdata/spamhaus_drop.txt", "testdata/spamhaus_edrop.txt"} {
+		f, err := os.Open(name)
+		require.NoError(err)
+		_, err = ndb.ImportSpamhaus(f)
+		f.Close()
+		require.NoError(err, name)
+	}
+
+	drop, err := ndb.Metadata("Spamhaus DROP List")
+	require.NoError(err)
+	require.Equal("spamhaus", drop.Format)
+	require.Equal("2024/10/05", drop.Version)
+	require.Equal("https://www.spamhaus.org/drop/drop.txt", drop.Source)
+	require.True(time.Date(2024, time.October, 5, 8, 18, 17, 0, time.UTC).Equal(drop.Generated))
+	require.Equal(4, drop.Entries)
+
+	all, err := ndb.AllMetadata()
+	require.NoError(err)
+	require.Len(all, 2)
+	require.Equal("Spamhaus DROP List", all[0].Name)
+	require.Equal("Spamhaus EDROP List", all[1].Name)
+	require.Equal(2, all[1].Entries)
+
+	v, err := ndb.Find("1.19.1.1")
+	require.NoError(err)
+	require.Equal([]byte("SBL434604"), v)
+
+	v, err = ndb.Find("27.126.160.1")
+	require.NoError(err)
+	require.Equal([]byte("SBL260185"), v)
+	consistent(t, ndb)
+
+	f, err := os.Open("testdata/spamhaus_edrop.txt")
+	require.NoError(err)
+	defer f.Close()
+	result, err := ndb.ImportSpamhaus(f)
+	require.NoError(err)
+	require.Len(result.Errors, 1)
+	require.Equal(7, result.Errors[0].Line)
+	require.ErrorIs(result.Errors[0], ErrInvalidRange)
+
+	_, err = ndb.Metadata("unknown")
+	require.ErrorIs(err, ErrMetadataNotFound)
+}
+
+func TestImportIP2Proxy(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	f, err := os.Open("testdata/ip2proxy_lite_px4.csv")
+	require.NoError(err)
+	defer f.Close()
+
+	result, err := ndb.ImportIP2Proxy(f,
+		WithProxyTypes("vpn"),
+		WithValueColumns("proxy_type", "country_code", "isp"),
+	)
+	require.NoError(err)
+	require.Equal(6, result.Lines)
+	require.Equal(2, result.Imported)
+	require.Equal(2, result.Skipped)
+	require.Equal(2, result.Failed)
+	require.Equal(5, result.Errors[0].Line)
+	require.ErrorIs(result.Errors[0], ErrInvalidRange)
+	// IPv6 numbers are only accepted with WithIPv6Numbers
+	require.Equal(6, result.Errors[1].Line)
+	require.ErrorIs(result.Errors[1], ErrInvalidRange)
+
+	for ip, expected := range map[string]string{
+		"1.0.8.128": "VPN:CN:China Telecom",
+		"1.0.16.0":  "VPN:JP:Sony Network Communications",
+	} {
+		v, err := ndb.Find(ip)
+		require.NoError(err, ip)
+		require.Equal(expected, string(v), ip)
+	}
+
+	// filtered proxy types
+	for _, ip := range []string{"1.0.4.1", "1.0.12.1"} {
+		_, err = ndb.Find(ip)
+		require.ErrorIs(err, ErrIPNotFound, ip)
+	}
+	consistent(t, ndb)
+
+	_, err = ndb.ImportIP2Proxy(strings.NewReader(""), WithValueColumns("unknown"))
+	require.Error(err)
+}
+
+func TestImportIP2ProxyIPv6(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	f, err := os.Open("testdata/ip2proxy_lite_px4_ipv6.csv")
+	require.NoError(err)
+	defer f.Close()
+
+	result, err := ndb.ImportIP2Proxy(f, WithIPv6Numbers(), WithValueColumns("proxy_type", "country_code"))
+	require.NoError(err)
+	require.Equal(5, result.Lines)
+	require.Equal(2, result.Imported)
+	require.Equal(3, result.Failed)
+	// small numbers are IPv6 addresses within ::/96 and not IPv4 addresses
+	for i, line := range []int{1, 2, 5} {
+		require.Equal(line, result.Errors[i].Line)
+		require.ErrorIs(result.Errors[i], ErrIPv6NotSupported)
+	}
+
+	for ip, expected := range map[string]string{
+		"1.0.8.128": "VPN:CN",
+		"1.2.0.255": "VPN:TH",
+	} {
+		v, err := ndb.Find(ip)
+		require.NoError(err, ip)
+		require.Equal(expected, string(v), ip)
+	}
+	_, err = ndb.Find("0.0.0.1")
+	require.ErrorIs(err, ErrIPNotFound)
+	consistent(t, ndb)
+}
@@ -0,0 +1,157 @@
+package nutbreaker
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ip2ProxyColumns are the columns of the IP2Proxy LITE databases in the order of the PX12 database.
+// Smaller databases only contain a prefix of these columns.
+var ip2ProxyColumns = []string{
+	"ip_from",
+	"ip_to",
+	"proxy_type",
+	"country_code",
+	"country_name",
+	"region_name",
+	"city_name",
+	"isp",
+	"domain",
+	"usage_type",
+	"asn",
+	"as",
+	"last_seen",
+	"threat",
+	"provider",
+}
+
+// WithProxyTypes only imports ranges of the given proxy types, e.g. "VPN" or "TOR".
+func WithProxyTypes(types ...string) ImportOption {
+	return func(o *importOptions) {
+		o.proxyTypes = types
+	}
+}
+
+// WithIPv6Numbers declares that the IP numbers of an IP2Proxy database are 128 bit IPv6
+// numbers as in the IPv6 databases, e.g. IP2PROXY-LITE-PX4.IPV6.CSV.
+func WithIPv6Numbers() ImportOption {
+	return func(o *importOptions) {
+		o.ipv6Numbers = true
+	}
+}
+
+// WithValueColumns builds the value of every imported range from the given columns separated by ':'.
+func WithValueColumns(columns ...string) ImportOption {
+	return func(o *importOptions) {
+		o.valueColumns = columns
+	}
+}
+
+// ImportIP2Proxy imports an IP2Proxy LITE CSV database with decimal IP ranges like
+// "ip_from","ip_to","proxy_type","country_code",...
+// The value of every range is its proxy type unless other columns are selected with WithValueColumns.
+// IPv6 databases require WithIPv6Numbers, their IPv4-mapped ranges are imported as IPv4 ranges.
+func (n *NutBreaker) ImportIP2Proxy(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newImporter(opts)
+
+	valueColumns := im.opts.valueColumns
+	if len(valueColumns) == 0 {
+		valueColumns = []string{"proxy_type"}
+	}
+	valueIndices := make([]int, 0, len(valueColumns))
+	for _, c := range valueColumns {
+		idx := slices.Index(ip2ProxyColumns, c)
+		if idx < 0 {
+			return im.result, fmt.Errorf("unknown IP2Proxy column: %s", c)
+		}
+		valueIndices = append(valueIndices, idx)
+	}
+
+	proxyTypes := make(map[string]bool, len(im.opts.proxyTypes))
+	for _, t := range im.opts.proxyTypes {
+		proxyTypes[strings.ToUpper(t)] = true
+	}
+
+	err = readCSV(r, ',', func(line int, record []string, perr error) error {
+		im.line()
+		if perr != nil {
+			im.fail(line, "", fmt.Errorf("%w: %w", ErrInvalidListFormat, perr))
+			return nil
+		}
+
+		text := strings.Join(record, ",")
+		if len(record) < 3 {
+			im.fail(line, text, fmt.Errorf("%w: expected at least 3 columns, got %d", ErrInvalidListFormat, len(record)))
+			return nil
+		}
+
+		if len(proxyTypes) > 0 && !proxyTypes[strings.ToUpper(record[2])] {
+			im.skip()
+			return nil
+		}
+
+		ipRange, err := decimalRange(record[0], record[1], im.opts.ipv6Numbers)
+		if err != nil {
+			im.fail(line, text, err)
+			return nil
+		}
+
+		parts := make([]string, 0, len(valueIndices))
+		for _, idx := range valueIndices {
+			if idx >= len(record) {
+				im.fail(line, text, fmt.Errorf("%w: missing column %s", ErrInvalidListFormat, ip2ProxyColumns[idx]))
+				return nil
+			}
+			parts = append(parts, record[idx])
+		}
+		return im.add(line, text, ipRange, []byte(strings.Join(parts, ":")))
+	})
+	if err != nil {
+		return im.result, err
+	}
+	return im.finish()
+}
+
+// decimalRange converts two decimal IP numbers into a range.
+func decimalRange(from, to string, ipv6 bool) (string, error) {
+	low, err := parseIPNumber(from, 10, ipv6)
+	if err != nil {
+		return "", err
+	}
+	high, err := parseIPNumber(to, 10, ipv6)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s - %s", low, high), nil
+}
+
+// parseIPNumber parses an IP in its integer representation of the given base.
+// IPv6 numbers are 128 bit wide, IPv4-mapped IPv6 addresses are returned as IPv4 addresses.
+func parseIPNumber(s string, base int, ipv6 bool) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if !ipv6 {
+		i, err := strconv.ParseUint(s, base, 32)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%w: invalid IPv4 number: %q", ErrInvalidRange, s)
+		}
+		return uint32ToAddr(uint32(i)), nil
+	}
+
+	i, ok := new(big.Int).SetString(s, base)
+	if !ok || i.Sign() < 0 || i.BitLen() > 128 {
+		return netip.Addr{}, fmt.Errorf("%w: invalid IPv6 number: %q", ErrInvalidRange, s)
+	}
+	var b [16]byte
+	i.FillBytes(b[:])
+	return netip.AddrFrom16(b).Unmap(), nil
+}
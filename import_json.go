@@ -0,0 +1,107 @@
+package nutbreaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ImportJSON imports a JSON array of ranges as written by ExportJSON. The CIDRs of the objects are ignored,
+// objects without value are stored with the value set with WithValue. With WithRefresh all stored ranges are
+// replaced by the imported ones, which restores the exported database exactly.
+func (n *NutBreaker) ImportJSON(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newJSONImporter(opts)
+
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return im.finish()
+	}
+	if err != nil {
+		return im.result, fmt.Errorf("%w: %w", ErrInvalidListFormat, err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return im.result, fmt.Errorf("%w: expected JSON array", ErrInvalidListFormat)
+	}
+
+	for idx := 1; dec.More(); idx++ {
+		var raw json.RawMessage
+		err = dec.Decode(&raw)
+		if err != nil {
+			return im.result, fmt.Errorf("%w: range %d: %w", ErrInvalidListFormat, idx, err)
+		}
+
+		im.line()
+		err = im.addJSON(idx, string(raw))
+		if err != nil {
+			return im.result, err
+		}
+	}
+
+	_, err = dec.Token()
+	if err != nil {
+		return im.result, fmt.Errorf("%w: %w", ErrInvalidListFormat, err)
+	}
+	return im.finish()
+}
+
+// ImportJSONL imports ranges in the JSON Lines format as written by ExportJSONL, see ImportJSON.
+// Empty lines are ignored.
+func (n *NutBreaker) ImportJSONL(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newJSONImporter(opts)
+	err = scanLines(r, func(line int, text string) error {
+		im.line()
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		return im.addJSON(line, text)
+	})
+	if err != nil {
+		return im.result, err
+	}
+	return im.finish()
+}
+
+func (n *NutBreaker) newJSONImporter(opts []ImportOption) *importer {
+	im := n.newImporter(opts)
+	if im.opts.refresh {
+		im.owned = func([]byte) bool {
+			return true
+		}
+	}
+	return im
+}
+
+// addJSON decodes a single range object.
+func (im *importer) addJSON(line int, text string) error {
+	var jr jsonRange
+	err := json.Unmarshal([]byte(text), &jr)
+	if err != nil {
+		im.fail(line, text, fmt.Errorf("%w: %w", ErrInvalidListFormat, err))
+		return nil
+	}
+	if !jr.Low.IsValid() || !jr.High.IsValid() {
+		im.fail(line, text, fmt.Errorf("%w: missing low or high IP", ErrInvalidRange))
+		return nil
+	}
+
+	value := im.opts.value
+	switch {
+	case jr.Value != nil:
+		value = []byte(*jr.Value)
+	case jr.ValueBase64 != nil:
+		value = jr.ValueBase64
+	}
+	return im.add(line, text, Range{Low: jr.Low, High: jr.High}.String(), value)
+}
@@ -0,0 +1,154 @@
+package nutbreaker
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MMDBRecord is a network of a MaxMind DB with its data record.
+type MMDBRecord struct {
+	Network netip.Prefix
+	// Data is the decoded record, usually a map[string]any.
+	// Unsigned integers are decoded as uint64, 128 bit integers as *big.Int.
+	Data any
+}
+
+// Field returns the value at the dot separated path, e.g. "country.iso_code" or "subdivisions.0.names.en".
+func (r MMDBRecord) Field(path string) (any, bool) {
+	v := r.Data
+	for _, key := range strings.Split(path, ".") {
+		switch c := v.(type) {
+		case map[string]any:
+			var ok bool
+			v, ok = c[key]
+			if !ok {
+				return nil, false
+			}
+		case []any:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return nil, false
+			}
+			v = c[idx]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// MMDBMapping selects the networks of a MaxMind DB and builds their values.
+type MMDBMapping struct {
+	// Filter reports whether a network is imported. All networks are imported if Filter is nil.
+	Filter func(r MMDBRecord) bool
+	// Value is a template that composes the value from record fields,
+	// e.g. "AS{autonomous_system_number}:{autonomous_system_organization}".
+	// Missing fields are replaced by an empty string.
+	// Networks are stored with the value set with WithValue if Value is empty.
+	Value string
+}
+
+// ImportMMDB imports the IPv4 networks of a MaxMind DB file, e.g. GeoLite2-ASN or GeoIP2-Anonymous-IP.
+// The database type, description and build time are stored as metadata of the list.
+func (n *NutBreaker) ImportMMDB(r io.Reader, mapping MMDBMapping, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	value, err := parseValueTemplate(mapping.Value)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("failed to read mmdb: %w", err)
+	}
+	db, err := newMMDBReader(buf)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	meta := ListMetadata{Format: "mmdb"}
+	meta.Name, _ = db.metadata["database_type"].(string)
+	if desc, ok := db.metadata["description"].(map[string]any); ok {
+		meta.Category, _ = desc["en"].(string)
+	}
+	if epoch, ok := db.metadata["build_epoch"].(uint64); ok {
+		meta.Generated = time.Unix(int64(epoch), 0).UTC()
+		meta.Version = strconv.FormatUint(epoch, 10)
+	}
+
+	im := n.newImporter(opts)
+	records := make(map[uint]any)
+
+	// networks are walked in ascending order, adjacent networks with the same value
+	// are coalesced into a single range.
+	c := coalescer{im: im}
+
+	idx := 0
+	err = db.networks(func(prefix netip.Prefix, offset uint) error {
+		idx++
+		im.line()
+
+		data, ok := records[offset]
+		if !ok {
+			var err error
+			data, _, err = db.data.decode(offset, 0)
+			if err != nil {
+				return err
+			}
+			records[offset] = data
+		}
+
+		record := MMDBRecord{Network: prefix, Data: data}
+		if mapping.Filter != nil && !mapping.Filter(record) {
+			im.skip()
+			return nil
+		}
+
+		v := im.opts.value
+		if mapping.Value != "" {
+			s, _ := value.execute(func(path string) (string, error) {
+				field, ok := record.Field(path)
+				if !ok {
+					return "", nil
+				}
+				return formatMMDBValue(field), nil
+			})
+			v = []byte(s)
+		}
+
+		return c.add(idx, prefix.String(), prefix.String(), v)
+	})
+	if err == nil {
+		err = c.flush()
+	}
+	if err != nil {
+		return im.result, err
+	}
+
+	if meta.Name == "" {
+		return im.finish()
+	}
+	return im.finishList(meta)
+}
+
+func formatMMDBValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case *big.Int:
+		return t.String()
+	default:
+		return fmt.Sprint(t)
+	}
+}
@@ -0,0 +1,82 @@
+package nutbreaker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ImportSpamhaus imports a Spamhaus DROP or EDROP list with lines like "<prefix> ; <SBL ID>".
+// Every range is associated with its SBL ID or with the value set with WithValue
+// in case that the line does not contain one. The list name, version and last modification
+// date are taken from the header and stored as metadata of the list.
+func (n *NutBreaker) ImportSpamhaus(r io.Reader, opts ...ImportOption) (ImportResult, error) {
+	r, err := n.verifiedInput(r, opts)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	im := n.newImporter(opts)
+	meta := ListMetadata{Format: "spamhaus"}
+
+	header := true
+	err = scanLines(r, func(line int, text string) error {
+		im.line()
+
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, ";") {
+			if header {
+				parseSpamhausHeader(&meta, strings.TrimSpace(strings.TrimPrefix(trimmed, ";")))
+			}
+			return nil
+		}
+		if trimmed == "" {
+			return nil
+		}
+
+		if header {
+			header = false
+			if meta.Name == "" {
+				return fmt.Errorf("%w: missing Spamhaus header", ErrInvalidListFormat)
+			}
+		}
+
+		ipRange, sbl := splitListLine(trimmed)
+		value := im.opts.value
+		if sbl != "" {
+			value = []byte(sbl)
+		}
+		return im.add(line, text, ipRange, value)
+	})
+	if err != nil {
+		return im.result, err
+	}
+	if header && meta.Name == "" {
+		return im.result, fmt.Errorf("%w: missing Spamhaus header", ErrInvalidListFormat)
+	}
+	return im.finishList(meta)
+}
+
+// parseSpamhausHeader extracts the metadata from a single header line without its leading ';'.
+func parseSpamhausHeader(meta *ListMetadata, line string) {
+	switch {
+	case meta.Name == "" && strings.HasPrefix(line, "Spamhaus"):
+		// Spamhaus DROP List 2024/10/05 - (c) 2024 The Spamhaus Project SLU
+		title, _, _ := strings.Cut(line, " - ")
+		fields := strings.Fields(title)
+		last := fields[len(fields)-1]
+		if _, err := time.Parse("2006/01/02", last); err == nil && len(fields) > 1 {
+			meta.Version = last
+			fields = fields[:len(fields)-1]
+		}
+		meta.Name = strings.Join(fields, " ")
+	case strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://"):
+		meta.Source = line
+	case strings.HasPrefix(line, "Last-Modified:"):
+		value := strings.TrimSpace(strings.TrimPrefix(line, "Last-Modified:"))
+		if t, err := time.Parse(time.RFC1123, value); err == nil {
+			meta.Generated = t
+		}
+	}
+}
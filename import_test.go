@@ -0,0 +1,135 @@
+package nutbreaker
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportStrict(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	list := "10.0.0.0/24\n10.0.1.5/24\n10.0.2.0/24 - 10.0.3.0\n"
+	result, err := ndb.Import(strings.NewReader(list), WithStrictParsing())
+	require.NoError(err)
+	require.Equal(1, result.Imported)
+	require.Equal(2, result.Failed)
+
+	var perr *ParseError
+	require.ErrorAs(result.Errors[0], &perr)
+	require.Equal(ParseErrHostBits, perr.Kind)
+	require.Equal(2, result.Errors[0].Line)
+	require.ErrorAs(result.Errors[1], &perr)
+	require.Equal(ParseErrSyntax, perr.Kind)
+	require.Equal(12, perr.Pos)
+
+	// without strict parsing the host bits are cleared
+	result, err = ndb.Import(strings.NewReader(list))
+	require.NoError(err)
+	require.Equal(2, result.Imported)
+	value, err := ndb.Find("10.0.1.0")
+	require.NoError(err)
+	require.Empty(value)
+}
+
+func TestImport(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	list := strings.Join([]string{
+		"# some vpn list",
+		"; generated daily",
+		"",
+		"1.2.3.4",
+		"10.0.0.0/24 # provider a",
+		"11.0.0.1 - 11.0.0.10 ; provider b",
+		"12.0.0.1 annotated provider",
+		"invalid",
+		"::1",
+		"13.0.0.0/33",
+		"  14.0.0.1  ",
+		"443",
+	}, "\r\n")
+
+	var progress []ImportProgress
+	result, err := ndb.Import(strings.NewReader(list),
+		WithValue([]byte("vpn")),
+		WithCommentValue(),
+		WithBatchSize(2),
+		WithProgress(func(p ImportProgress) {
+			progress = append(progress, p)
+		}),
+	)
+	require.NoError(err)
+	require.Equal(12, result.Lines)
+	require.Equal(5, result.Imported)
+	require.Equal(4, result.Failed)
+	require.Len(result.Errors, 4)
+	require.Equal(8, result.Errors[0].Line)
+	require.Equal("invalid", result.Errors[0].Text)
+	require.ErrorIs(result.Errors[0], ErrInvalidRange)
+	require.Equal(9, result.Errors[1].Line)
+	require.ErrorIs(result.Errors[1], ErrIPv6NotSupported)
+	require.Equal(10, result.Errors[2].Line)
+
+	// a lone number is not an address in a text list
+	require.Equal(12, result.Errors[3].Line)
+	require.Equal("443", result.Errors[3].Text)
+	require.ErrorIs(result.Errors[3], ErrInvalidRange)
+
+	data, err := json.Marshal(result.Errors[0])
+	require.NoError(err)
+	var encoded map[string]any
+	require.NoError(json.Unmarshal(data, &encoded))
+	require.Equal(map[string]any{
+		"line":  float64(8),
+		"text":  "invalid",
+		"error": result.Errors[0].Err.Error(),
+	}, encoded)
+
+	require.Equal([]ImportProgress{
+		{Lines: 5, Imported: 2},
+		{Lines: 7, Imported: 4},
+		{Lines: 12, Imported: 5, Failed: 4},
+	}, progress)
+
+	for ip, expected := range map[string]string{
+		"1.2.3.4":    "vpn",
+		"10.0.0.128": "provider a",
+		"11.0.0.5":   "provider b",
+		"12.0.0.1":   "annotated provider",
+		"14.0.0.1":   "vpn",
+	} {
+		v, err := ndb.Find(ip)
+		require.NoError(err, ip)
+		require.Equal(expected, string(v), ip)
+	}
+	consistent(t, ndb)
+}
+
+func TestSplitListLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		ipRange string
+		comment string
+	}{
+		{"", "", ""},
+		{"# comment only", "", "comment only"},
+		{"1.2.3.4", "1.2.3.4", ""},
+		{"1.2.3.0/24;SBL123", "1.2.3.0/24", "SBL123"},
+		{"1.2.3.4 - 1.2.3.5 annotation", "1.2.3.4 - 1.2.3.5", "annotation"},
+		{"1.2.3.4- 1.2.3.5", "1.2.3.4- 1.2.3.5", ""},
+		{"1.2.3.4 -1.2.3.5", "1.2.3.4 -1.2.3.5", ""},
+		{"1.2.3.4-1.2.3.5 annotation # comment", "1.2.3.4-1.2.3.5", "comment"},
+	}
+	for _, tt := range tests {
+		ipRange, comment := splitListLine(tt.line)
+		require.Equal(t, tt.ipRange, ipRange, tt.line)
+		require.Equal(t, tt.comment, comment, tt.line)
+	}
+}
@@ -0,0 +1,155 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// RecoveryPolicy decides what happens if the integrity check at startup fails, see WithIntegrityCheck.
+type RecoveryPolicy int
+
+const (
+	// RecoverRefuse refuses to open the database with ErrIntegrityCheckFailed.
+	RecoverRefuse RecoveryPolicy = iota
+	// RecoverReadOnly opens the database, all write operations fail with ErrReadOnly.
+	// Repair is the only write operation that is allowed, the database is writable again
+	// once it was repaired successfully.
+	RecoverReadOnly
+	// RecoverRepair rebuilds the range index from all recoverable ranges, see Repair.
+	RecoverRepair
+	// RecoverSnapshot replaces the range index with the most recently created snapshot.
+	RecoverSnapshot
+	// RecoverBackup restores the archive that is set with WithRecoveryBackup, see Restore.
+	RecoverBackup
+)
+
+func (p RecoveryPolicy) String() string {
+	switch p {
+	case RecoverRefuse:
+		return "refuse"
+	case RecoverReadOnly:
+		return "read-only"
+	case RecoverRepair:
+		return "repair"
+	case RecoverSnapshot:
+		return "snapshot"
+	case RecoverBackup:
+		return "backup"
+	default:
+		return fmt.Sprintf("RecoveryPolicy(%d)", int(p))
+	}
+}
+
+// IntegrityReport returns the result of the integrity check at startup, which describes the
+// state before any recovery. Returns false if the check was not enabled with WithIntegrityCheck.
+func (n *NutBreaker) IntegrityReport() (VerifyReport, bool) {
+	if n.integrity == nil {
+		return VerifyReport{}, false
+	}
+	return *n.integrity, true
+}
+
+// ReadOnly returns true if the database was opened read-only after a failed integrity check
+// and was not repaired since.
+func (n *NutBreaker) ReadOnly() bool {
+	return n.readOnly.Load()
+}
+
+// checkIntegrity verifies the range index and applies the recovery policy if it is inconsistent.
+func (n *NutBreaker) checkIntegrity(policy RecoveryPolicy, backup string) error {
+	report, err := n.Verify()
+	if err != nil {
+		return err
+	}
+	n.integrity = &report
+	if report.OK() {
+		return nil
+	}
+
+	failed := fmt.Errorf("%w: %d issues, first: %s", ErrIntegrityCheckFailed, len(report.Issues), report.Issues[0])
+	switch policy {
+	case RecoverReadOnly:
+		n.readOnly.Store(true)
+		return nil
+	case RecoverRepair:
+		_, err = n.Repair()
+	case RecoverSnapshot:
+		err = n.recoverSnapshot()
+	case RecoverBackup:
+		err = n.recoverBackup(backup)
+	default:
+		return failed
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s recovery failed: %w", failed, policy, err)
+	}
+
+	recovered, err := n.Verify()
+	if err != nil {
+		return err
+	}
+	if !recovered.OK() {
+		return fmt.Errorf("%w: still inconsistent after %s recovery: %s", failed, policy, recovered.Issues[0])
+	}
+	return nil
+}
+
+// recoverSnapshot rebuilds the range index from the most recently created snapshot.
+func (n *NutBreaker) recoverSnapshot() error {
+	err := n.update(n.createBuckets)
+	if err != nil {
+		return err
+	}
+	return n.update(func(tx *nutsdb.Tx) error {
+		head, err := n.snapshotHead(tx)
+		if err != nil {
+			return err
+		}
+		if head == "" {
+			return ErrSnapshotNotFound
+		}
+		state, err := n.snapshotState(tx, head)
+		if err != nil {
+			return err
+		}
+
+		bounds := make([]boundary, 0, len(state))
+		for ip, v := range state {
+			b, err := newBoundaryFloat64(float64(ip), v.Low, v.High, v.Value)
+			if err != nil {
+				return err
+			}
+			bounds = append(bounds, b)
+		}
+		sort.Slice(bounds, func(i, j int) bool {
+			return bounds[i].Score < bounds[j].Score
+		})
+		return n.rebuildIndex(tx, bounds)
+	})
+}
+
+// recoverBackup restores the archive at path.
+func (n *NutBreaker) recoverBackup(path string) error {
+	if path == "" {
+		return errors.New("no recovery backup configured")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var opts []ImportOption
+	if n.keyring != nil {
+		sig, err := os.ReadFile(path + ".sig")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		opts = append(opts, WithSignature(sig))
+	}
+	return n.restoreArchive(bytes.NewReader(data), path, opts)
+}
@@ -0,0 +1,385 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/require"
+)
+
+var tornBaseRanges = []string{
+	"10.0.0.0 - 10.0.0.255 a",
+	"10.0.2.0 - 10.0.2.255 b",
+	"10.0.4.0 - 10.0.4.255 c",
+	"10.0.6.1 d",
+}
+
+// tornDB creates a database in dir with a snapshot and a backup of the base ranges, whose last
+// commit is interrupted after crashAt boundaries were written. Returns the number of boundaries
+// that the interrupted commit would have written.
+func tornDB(t *testing.T, dir string, crashAt int) int {
+	require := require.New(t)
+
+	ndb, err := NewNutBreaker(WithDir(dir))
+	require.NoError(err)
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+	require.NoError(ndb.Reset())
+
+	for _, r := range []struct{ ipRange, value string }{
+		{"10.0.0.0/24", "a"},
+		{"10.0.2.0/24", "b"},
+		{"10.0.4.0/24", "c"},
+		{"10.0.6.1", "d"},
+	} {
+		_, err = ndb.Insert(r.ipRange, []byte(r.value))
+		require.NoError(err)
+	}
+	require.NoError(ndb.Snapshot("base"))
+
+	f, err := os.Create(filepath.Join(dir, "backup.nbk"))
+	require.NoError(err)
+	require.NoError(ndb.Backup(f))
+	require.NoError(f.Close())
+
+	return tornInsert(t, ndb, "10.0.0.128 - 10.0.6.1", []byte("e"), crashAt)
+}
+
+// tornInsert stages an insert but writes only the first crashAt of its boundaries, which leaves
+// the index in the state of a commit that was interrupted. Returns the number of staged boundaries.
+func tornInsert(t *testing.T, ndb *NutBreaker, ipRange string, value []byte, crashAt int) int {
+	var staged int
+	err := ndb.db.Update(func(tx *nutsdb.Tx) error {
+		txn := newTxn(ndb, tx, true)
+		_, err := txn.Insert(ipRange, value)
+		if err != nil {
+			return err
+		}
+
+		staged = len(txn.scores)
+		for _, score := range txn.scores[:min(crashAt, staged)] {
+			_, err = txn.commitBoundary(txn.pending[score])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	return staged
+}
+
+func TestIntegrityCheckPolicies(t *testing.T) {
+	require := require.New(t)
+
+	// count the boundaries of the interrupted commit
+	points := tornDB(t, t.TempDir(), 1<<30)
+	require.Greater(points, 3)
+
+	inconsistent := 0
+	for crashAt := 0; crashAt <= points; crashAt++ {
+		dir := t.TempDir()
+		tornDB(t, dir, crashAt)
+
+		// the check detects the interrupted commit
+		ndb, err := NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverReadOnly))
+		require.NoError(err)
+		report, ok := ndb.IntegrityReport()
+		require.True(ok)
+		if report.OK() {
+			require.False(ndb.ReadOnly())
+			require.NoError(ndb.Close())
+			continue
+		}
+		inconsistent++
+
+		require.True(ndb.ReadOnly())
+		_, err = ndb.Insert("1.2.3.4", nil)
+		require.ErrorIs(err, ErrReadOnly)
+		require.ErrorIs(ndb.Snapshot("broken"), ErrReadOnly)
+		_, err = ndb.Repair()
+		require.NoError(err)
+		consistent(t, ndb)
+		require.False(ndb.ReadOnly())
+		_, err = ndb.Insert("1.2.3.4", nil)
+		require.NoError(err)
+		require.NoError(ndb.Close())
+
+		for _, policy := range []RecoveryPolicy{RecoverRefuse, RecoverRepair, RecoverSnapshot, RecoverBackup} {
+			t.Run(fmt.Sprintf("crash after %d/%s", crashAt, policy), func(t *testing.T) {
+				recoverTornDB(t, crashAt, policy)
+			})
+		}
+	}
+	require.Greater(inconsistent, 0)
+}
+
+// recoverTornDB opens a torn database with the given recovery policy.
+func recoverTornDB(t *testing.T, crashAt int, policy RecoveryPolicy) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	tornDB(t, dir, crashAt)
+
+	ndb, err := NewNutBreaker(
+		WithDir(dir),
+		WithIntegrityCheck(policy),
+		WithRecoveryBackup(filepath.Join(dir, "backup.nbk")),
+	)
+	if policy == RecoverRefuse {
+		require.ErrorIs(err, ErrIntegrityCheckFailed)
+		return
+	}
+	require.NoError(err)
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+
+	report, ok := ndb.IntegrityReport()
+	require.True(ok)
+	require.False(report.OK())
+	require.False(ndb.ReadOnly())
+
+	switch policy {
+	case RecoverSnapshot, RecoverBackup:
+		requireRanges(t, ndb, tornBaseRanges...)
+	default:
+		consistent(t, ndb)
+	}
+	_, err = ndb.Insert("1.2.3.4", []byte("x"))
+	require.NoError(err)
+	consistent(t, ndb)
+}
+
+func TestIntegrityCheckConsistent(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	tornDB(t, dir, 1<<30)
+
+	ndb, err := NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverRefuse))
+	require.NoError(err)
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+	report, ok := ndb.IntegrityReport()
+	require.True(ok)
+	require.True(report.OK())
+	require.Equal(2, report.Ranges)
+
+	_, err = NewNutBreaker(WithDir(t.TempDir()), WithIntegrityCheck(RecoveryPolicy(42)))
+	require.Error(err)
+}
+
+func TestIntegrityCheckMissingSnapshot(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	tornDB(t, dir, 1)
+
+	ndb, err := NewNutBreaker(WithDir(dir))
+	require.NoError(err)
+	require.NoError(ndb.DeleteSnapshot("base"))
+	require.NoError(ndb.Close())
+
+	_, err = NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverSnapshot))
+	require.ErrorIs(err, ErrIntegrityCheckFailed)
+	require.ErrorIs(err, ErrSnapshotNotFound)
+
+	_, err = NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverBackup))
+	require.ErrorIs(err, ErrIntegrityCheckFailed)
+}
+
+func TestIntegrityCheckMissingSentinel(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	ndb, err := NewNutBreaker(WithDir(dir))
+	require.NoError(err)
+	_, err = ndb.Insert("10.0.0.0/24", []byte("a"))
+	require.NoError(err)
+	err = ndb.db.Update(func(tx *nutsdb.Tx) error {
+		err := tx.ZRem(ndb.blacklistBucket, ndb.blacklistSortedSetKey, posInfKey)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(ndb.blacklistBucket, posInfKey)
+	})
+	require.NoError(err)
+	require.NoError(ndb.Close())
+
+	// the check runs before the sentinels are initialized
+	_, err = NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverRefuse))
+	require.ErrorIs(err, ErrIntegrityCheckFailed)
+
+	// a read-only database is not modified
+	ndb, err = NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverReadOnly))
+	require.NoError(err)
+	require.True(ndb.ReadOnly())
+	report, err := ndb.Verify()
+	require.NoError(err)
+	require.False(report.OK())
+	require.Equal(IssueMissingSentinel, report.Issues[0].Kind)
+	require.NoError(ndb.Close())
+
+	ndb, err = NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverRepair))
+	require.NoError(err)
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+	report, ok := ndb.IntegrityReport()
+	require.True(ok)
+	require.False(report.OK())
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 a")
+	consistent(t, ndb)
+}
+
+// The steps of Reset and Restore are separate transactions. A crash between them must leave
+// a consistent database with the previous ranges.
+func TestIntegrityCheckInterruptedReset(t *testing.T) {
+	for done := 0; done < 3; done++ {
+		t.Run(fmt.Sprintf("after %d steps", done), func(t *testing.T) {
+			require := require.New(t)
+
+			dir := t.TempDir()
+			ndb, err := NewNutBreaker(WithDir(dir))
+			require.NoError(err)
+			for _, r := range []struct{ ipRange, value string }{
+				{"10.0.0.0/24", "a"},
+				{"10.0.2.0/24", "b"},
+			} {
+				_, err = ndb.Insert(r.ipRange, []byte(r.value))
+				require.NoError(err)
+			}
+
+			// the steps of Reset
+			steps := []func(tx *nutsdb.Tx) error{ndb.createBuckets, ndb.initBuckets, func(tx *nutsdb.Tx) error {
+				return ndb.flush(tx, AuditReset)
+			}}
+			for _, step := range steps[:done] {
+				require.NoError(ndb.update(step))
+			}
+			require.NoError(ndb.Close())
+
+			ndb, err = NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverRefuse))
+			require.NoError(err)
+			defer func() {
+				require.NoError(ndb.Close())
+			}()
+			requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 a", "10.0.2.0 - 10.0.2.255 b")
+
+			require.NoError(ndb.Reset())
+			requireRanges(t, ndb)
+		})
+	}
+}
+
+func TestIntegrityCheckInterruptedRestore(t *testing.T) {
+	require := require.New(t)
+
+	source, err := NewNutBreaker(WithDir(t.TempDir()), WithAuditLog())
+	require.NoError(err)
+	defer source.Close()
+	_, err = source.Insert("10.0.0.0/24", []byte("restored"))
+	require.NoError(err)
+	var backup bytes.Buffer
+	require.NoError(source.Backup(&backup))
+
+	dir := t.TempDir()
+	ndb, err := NewNutBreaker(WithDir(dir))
+	require.NoError(err)
+	_, err = ndb.Insert("10.0.1.0/24", []byte("kept"))
+	require.NoError(err)
+
+	// the first step of Restore creates the missing audit bucket
+	records, err := readBackup(bytes.NewReader(backup.Bytes()))
+	require.NoError(err)
+	require.NoError(ndb.createRestoreBuckets(records))
+	require.NoError(ndb.Close())
+
+	ndb, err = NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverRefuse))
+	require.NoError(err)
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+	requireRanges(t, ndb, "10.0.1.0 - 10.0.1.255 kept")
+
+	require.NoError(ndb.Restore(bytes.NewReader(backup.Bytes())))
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 restored")
+}
+
+// crashDirEnv is set for the child process of TestCrashRecovery, which writes until it is killed.
+const crashDirEnv = "NUTBREAKER_CRASH_DIR"
+
+func TestCrashRecovery(t *testing.T) {
+	if dir := os.Getenv(crashDirEnv); dir != "" {
+		crashChild(t, dir)
+		return
+	}
+	if testing.Short() {
+		t.Skip("crash recovery spawns processes")
+	}
+	require := require.New(t)
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed: %d", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestCrashRecovery$")
+		cmd.Env = append(os.Environ(), crashDirEnv+"="+dir)
+		require.NoError(cmd.Start())
+
+		time.Sleep(time.Duration(50+rnd.Intn(400)) * time.Millisecond)
+		require.NoError(cmd.Process.Kill())
+		_ = cmd.Wait()
+
+		ndb, err := NewNutBreaker(WithDir(dir), WithIntegrityCheck(RecoverRepair))
+		require.NoError(err, "iteration %d", i)
+		report, ok := ndb.IntegrityReport()
+		require.True(ok)
+		t.Logf("iteration %d: %d ranges, %d issues", i, report.Ranges, len(report.Issues))
+		consistent(t, ndb)
+		require.NoError(ndb.Close())
+	}
+}
+
+// crashChild inserts and removes random ranges and occasionally resets the database or restores
+// the backup of its initial state until the process is killed.
+func crashChild(t *testing.T, dir string) {
+	ndb, err := NewNutBreaker(WithDir(dir))
+	require.NoError(t, err)
+	defer ndb.Close()
+
+	var backup bytes.Buffer
+	require.NoError(t, ndb.Backup(&backup))
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		low := rnd.Uint32() >> 1 >> 8 << 8
+		ipRange := fmt.Sprintf("%s - %s", uint32ToAddr(low), uint32ToAddr(low+uint32(rnd.Intn(4096))))
+		switch r := rnd.Intn(100); {
+		case r == 0:
+			err = ndb.Reset()
+		case r == 1:
+			// Reset and Restore consist of multiple transactions
+			err = ndb.Restore(bytes.NewReader(backup.Bytes()))
+		case r < 25:
+			_, err = ndb.Remove(ipRange)
+		default:
+			_, err = ndb.Insert(ipRange, []byte(strconv.Itoa(rnd.Intn(8))))
+		}
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,117 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONExportImport(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+
+	_, err := ndb.Insert("0.0.0.0", []byte{})
+	require.NoError(t, err)
+	_, err = ndb.Insert("255.255.255.0/24", []byte{0xff, 0x00})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		export  func(*bytes.Buffer) error
+		imports func(*NutBreaker, *bytes.Buffer, ...ImportOption) (ImportResult, error)
+	}{
+		{
+			name:   "json",
+			export: func(b *bytes.Buffer) error { return ndb.ExportJSON(b) },
+			imports: func(n *NutBreaker, b *bytes.Buffer, opts ...ImportOption) (ImportResult, error) {
+				return n.ImportJSON(b, opts...)
+			},
+		},
+		{
+			name:   "jsonl",
+			export: func(b *bytes.Buffer) error { return ndb.ExportJSONL(b) },
+			imports: func(n *NutBreaker, b *bytes.Buffer, opts ...ImportOption) (ImportResult, error) {
+				return n.ImportJSONL(b, opts...)
+			},
+		},
+	}
+
+	expected, err := ndb.exportRanges(exportOptions{})
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+
+			var buf bytes.Buffer
+			require.NoError(tt.export(&buf))
+
+			other, otherCleanup := initDB(t)
+			defer otherCleanup()
+
+			_, err := other.Insert("1.1.1.1", []byte("stale"))
+			require.NoError(err)
+
+			result, err := tt.imports(other, &buf, WithRefresh())
+			require.NoError(err)
+			require.Empty(result.Errors)
+			require.Equal(len(expected), result.Imported)
+
+			actual, err := other.exportRanges(exportOptions{})
+			require.NoError(err)
+			require.Equal(expected, actual)
+			consistent(t, other)
+		})
+	}
+}
+
+func TestJSONLFormat(t *testing.T) {
+	ndb, cleanup := initFirewallDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("255.255.255.255", []byte{0xff})
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportJSONL(&buf, WithExportValues("vpn", "\xff")))
+	require.Equal(`{"low":"10.0.0.3","high":"10.0.0.10","cidrs":["10.0.0.3/32","10.0.0.4/30","10.0.0.8/31","10.0.0.10/32"],"value":"vpn"}`+"\n"+
+		`{"low":"255.255.255.255","high":"255.255.255.255","cidrs":["255.255.255.255/32"],"value_base64":"/w=="}`+"\n", buf.String())
+
+	buf.Reset()
+	require.NoError(ndb.ExportJSON(&buf, WithExportValues("none")))
+	require.Equal("[]\n", buf.String())
+}
+
+func TestJSONImportErrors(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	lines := `{"low":"10.0.0.1","high":"10.0.0.5"}
+
+{"low":"10.0.0.9","high":"10.0.0.8","value":"reversed"}
+{"high":"10.0.0.8"}
+not json
+{"low":"2001:db8::","high":"2001:db8::1"}
+`
+	result, err := ndb.ImportJSONL(strings.NewReader(lines), WithValue([]byte("default")))
+	require.NoError(err)
+	require.Equal(1, result.Imported)
+	require.Equal(4, result.Failed)
+	require.Equal(3, result.Errors[0].Line)
+	require.ErrorIs(result.Errors[1], ErrInvalidRange)
+	require.ErrorIs(result.Errors[2], ErrInvalidListFormat)
+	require.ErrorIs(result.Errors[3], ErrIPv6NotSupported)
+
+	value, err := ndb.Find("10.0.0.3")
+	require.NoError(err)
+	require.Equal("default", string(value))
+
+	_, err = ndb.ImportJSON(strings.NewReader(`{"low":"10.0.0.1"}`))
+	require.ErrorIs(err, ErrInvalidListFormat)
+	_, err = ndb.ImportJSON(strings.NewReader(`[{"low":"10.0.0.1","high":"10.0.0.1"}`))
+	require.ErrorIs(err, ErrInvalidListFormat)
+}
@@ -0,0 +1,125 @@
+package nutbreaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+const (
+	metadataListPrefix = "list:"
+	// metadataKindImport is the kind of lists that are imported directly.
+	metadataKindImport = "import"
+)
+
+// ListMetadata describes an imported list as announced by the headers of its source file.
+type ListMetadata struct {
+	Name string `json:"name"`
+	// Kind is "import" for lists that were imported directly, "file" for file sources and "feed" for feeds.
+	// Lists of different kinds may have the same name.
+	Kind   string `json:"kind"`
+	Format string `json:"format"`
+	// Version is the version or the date string of the list as provided by the publisher.
+	Version  string `json:"version,omitempty"`
+	Category string `json:"category,omitempty"`
+	Source   string `json:"source,omitempty"`
+	// Generated is the time at which the publisher generated the list.
+	Generated time.Time `json:"generated,omitempty"`
+	// Imported is the time of the last import.
+	Imported time.Time `json:"imported"`
+	// Entries is the number of ranges of the last import.
+	Entries int `json:"entries"`
+}
+
+// Metadata returns the metadata of the directly imported list with the given name.
+// The metadata of file sources and feeds is returned by FileWatcher.Metadata and FeedManager.Metadata.
+func (n *NutBreaker) Metadata(name string) (ListMetadata, error) {
+	return n.metadata(metadataKindImport, name)
+}
+
+func (n *NutBreaker) metadata(kind, name string) (ListMetadata, error) {
+	var result ListMetadata
+	err := n.db.View(func(tx *nutsdb.Tx) error {
+		data, err := tx.Get(n.metadataBucket, metadataListKey(kind, name))
+		if err != nil {
+			if errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrNotFoundKey) {
+				return fmt.Errorf("%w: %s %s", ErrMetadataNotFound, kind, name)
+			}
+			return fmt.Errorf("failed to get metadata of %s %s: %w", kind, name, err)
+		}
+
+		err = json.Unmarshal(data, &result)
+		if err != nil {
+			return fmt.Errorf("failed to decode metadata of %s %s: %w", kind, name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return ListMetadata{}, err
+	}
+	return result, nil
+}
+
+// AllMetadata returns the metadata of all imported lists, file sources and feeds ordered by name and kind.
+func (n *NutBreaker) AllMetadata() ([]ListMetadata, error) {
+	var result []ListMetadata
+	err := n.db.View(func(tx *nutsdb.Tx) error {
+		values, err := tx.PrefixScan(n.metadataBucket, []byte(metadataListPrefix), 0, nutsdb.ScanNoLimit)
+		if err != nil {
+			if errors.Is(err, nutsdb.ErrPrefixScan) {
+				return nil
+			}
+			return fmt.Errorf("failed to list metadata: %w", err)
+		}
+
+		result = make([]ListMetadata, 0, len(values))
+		for _, v := range values {
+			var m ListMetadata
+			err = json.Unmarshal(v, &m)
+			if err != nil {
+				return fmt.Errorf("failed to decode metadata: %w", err)
+			}
+			result = append(result, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Kind < result[j].Kind
+	})
+	return result, nil
+}
+
+func (n *NutBreaker) setMetadata(m ListMetadata) error {
+	return n.update(func(tx *nutsdb.Tx) error {
+		return n.putMetadata(tx, metadataKindImport, m)
+	})
+}
+
+func (n *NutBreaker) putMetadata(tx *nutsdb.Tx, kind string, m ListMetadata) error {
+	if m.Name == "" {
+		return errors.New("metadata without list name")
+	}
+	m.Kind = kind
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata of %s: %w", m.Name, err)
+	}
+	return tx.Put(n.metadataBucket, metadataListKey(kind, m.Name), data, 0)
+}
+
+// metadataListKey returns the key of the metadata of a list, e.g. "list:feed:<name>",
+// lists of different kinds do not overwrite each other's metadata.
+func metadataListKey(kind, name string) []byte {
+	return []byte(metadataListPrefix + kind + ":" + name)
+}
@@ -0,0 +1,615 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"sort"
+)
+
+// Implementation of the MaxMind DB file format version 2.0
+// https://maxmind.github.io/MaxMind-DB/
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// size of the zero filled separator between the search tree and the data section
+const mmdbDataSectionSeparator = 16
+
+// maximum size of the metadata section that is searched for the metadata marker
+const mmdbMetadataMaxSize = 128 * 1024
+
+// maximum depth of nested maps and arrays
+const mmdbMaxDepth = 64
+
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEnd       = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+)
+
+var errInvalidMMDB = fmt.Errorf("%w: invalid mmdb", ErrInvalidListFormat)
+
+// mmdbDecoder decodes values of the data section or of the metadata section.
+// Pointers are offsets relative to the beginning of buf.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset of the next value.
+func (d mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("%w: exceeded maximum nesting depth", errInvalidMMDB)
+	}
+
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == mmdbPointer {
+		// the pointed to value is never a pointer itself
+		value, _, err := d.decode(size, depth+1)
+		return value, offset, err
+	}
+
+	switch typ {
+	case mmdbMap:
+		// size is read from the file, limit the preallocation like for arrays
+		m := make(map[string]any, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			var key, value any
+			key, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key of type %T", errInvalidMMDB, key)
+			}
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			var value any
+			value, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case mmdbBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("%w: boolean of size %d", errInvalidMMDB, size)
+		}
+		return size == 1, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buf)) || end < offset {
+		return nil, 0, fmt.Errorf("%w: value at %d exceeds buffer", errInvalidMMDB, offset)
+	}
+	payload := d.buf[offset:end]
+
+	switch typ {
+	case mmdbString:
+		return string(payload), end, nil
+	case mmdbBytes:
+		return bytes.Clone(payload), end, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of size %d", errInvalidMMDB, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), end, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of size %d", errInvalidMMDB, size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), end, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		maxSize := map[byte]uint{mmdbUint16: 2, mmdbUint32: 4, mmdbUint64: 8}[typ]
+		if size > maxSize {
+			return nil, 0, fmt.Errorf("%w: unsigned integer of size %d", errInvalidMMDB, size)
+		}
+		var v uint64
+		for _, b := range payload {
+			v = v<<8 | uint64(b)
+		}
+		return v, end, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: int32 of size %d", errInvalidMMDB, size)
+		}
+		var v uint32
+		for _, b := range payload {
+			v = v<<8 | uint32(b)
+		}
+		return int32(v), end, nil
+	case mmdbUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("%w: uint128 of size %d", errInvalidMMDB, size)
+		}
+		return new(big.Int).SetBytes(payload), end, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", errInvalidMMDB, typ)
+	}
+}
+
+// control decodes the control byte(s) at offset.
+// For pointers the returned size is the pointer value.
+func (d mmdbDecoder) control(offset uint) (typ byte, size, next uint, err error) {
+	read := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(d.buf)) {
+			return nil, fmt.Errorf("%w: control at %d exceeds buffer", errInvalidMMDB, offset)
+		}
+		b := d.buf[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+	uintN := func(b []byte) uint {
+		var v uint
+		for _, c := range b {
+			v = v<<8 | uint(c)
+		}
+		return v
+	}
+
+	b, err := read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	ctrl := b[0]
+	typ = ctrl >> 5
+
+	if typ == mmdbPointer {
+		ss := uint(ctrl>>3) & 0x3
+		vvv := uint(ctrl & 0x7)
+		b, err = read(ss + 1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		switch ss {
+		case 0:
+			size = vvv<<8 | uintN(b)
+		case 1:
+			size = (vvv<<16 | uintN(b)) + 2048
+		case 2:
+			size = (vvv<<24 | uintN(b)) + 526336
+		default:
+			size = uintN(b)
+		}
+		return typ, size, offset, nil
+	}
+
+	if typ == mmdbExtended {
+		b, err = read(1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		typ = b[0] + 7
+		if typ <= mmdbMap {
+			return 0, 0, 0, fmt.Errorf("%w: invalid extended type %d", errInvalidMMDB, typ)
+		}
+	}
+
+	size = uint(ctrl & 0x1f)
+	switch size {
+	case 29:
+		b, err = read(1)
+		size = 29 + uintN(b)
+	case 30:
+		b, err = read(2)
+		size = 285 + uintN(b)
+	case 31:
+		b, err = read(3)
+		size = 65821 + uintN(b)
+	}
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return typ, size, offset, nil
+}
+
+// mmdbEncoder encodes values for the data section or the metadata section.
+type mmdbEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *mmdbEncoder) control(typ byte, size int) {
+	first := byte(0)
+	if typ <= mmdbMap {
+		first = typ << 5
+	}
+
+	var ext []byte
+	switch {
+	case size < 29:
+		first |= byte(size)
+	case size < 285:
+		first |= 29
+		ext = []byte{byte(size - 29)}
+	case size < 65821:
+		first |= 30
+		v := size - 285
+		ext = []byte{byte(v >> 8), byte(v)}
+	default:
+		first |= 31
+		v := size - 65821
+		ext = []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+
+	e.buf.WriteByte(first)
+	if typ > mmdbMap {
+		e.buf.WriteByte(typ - 7)
+	}
+	e.buf.Write(ext)
+}
+
+func (e *mmdbEncoder) uint(typ byte, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	payload := bytes.TrimLeft(b[:], "\x00")
+	e.control(typ, len(payload))
+	e.buf.Write(payload)
+}
+
+func (e *mmdbEncoder) encode(value any) error {
+	switch v := value.(type) {
+	case string:
+		e.control(mmdbString, len(v))
+		e.buf.WriteString(v)
+	case []byte:
+		e.control(mmdbBytes, len(v))
+		e.buf.Write(v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		e.control(mmdbBool, size)
+	case uint16:
+		e.uint(mmdbUint16, uint64(v))
+	case uint32:
+		e.uint(mmdbUint32, uint64(v))
+	case uint64:
+		e.uint(mmdbUint64, v)
+	case float64:
+		e.control(mmdbDouble, 8)
+		_ = binary.Write(&e.buf, binary.BigEndian, math.Float64bits(v))
+	case []string:
+		e.control(mmdbArray, len(v))
+		for _, s := range v {
+			err := e.encode(s)
+			if err != nil {
+				return err
+			}
+		}
+	case []any:
+		e.control(mmdbArray, len(v))
+		for _, a := range v {
+			err := e.encode(a)
+			if err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		e.control(mmdbMap, len(v))
+		for _, k := range keys {
+			err := e.encode(k)
+			if err != nil {
+				return err
+			}
+			err = e.encode(v[k])
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported mmdb value type %T", value)
+	}
+	return nil
+}
+
+// mmdbReader reads the search tree and the data section of a database.
+type mmdbReader struct {
+	tree       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	data       mmdbDecoder
+	metadata   map[string]any
+}
+
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	searchFrom := max(0, len(buf)-mmdbMetadataMaxSize)
+	idx := bytes.LastIndex(buf[searchFrom:], mmdbMetadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("%w: metadata marker not found", errInvalidMMDB)
+	}
+	metaStart := searchFrom + idx + len(mmdbMetadataMarker)
+
+	value, _, err := mmdbDecoder{buf: buf[metaStart:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	meta, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata of type %T", errInvalidMMDB, value)
+	}
+
+	r := &mmdbReader{metadata: meta}
+	r.nodeCount, err = mmdbMetaUint(meta, "node_count")
+	if err != nil {
+		return nil, err
+	}
+	r.recordSize, err = mmdbMetaUint(meta, "record_size")
+	if err != nil {
+		return nil, err
+	}
+	r.ipVersion, err = mmdbMetaUint(meta, "ip_version")
+	if err != nil {
+		return nil, err
+	}
+	major, err := mmdbMetaUint(meta, "binary_format_major_version")
+	if err != nil {
+		return nil, err
+	}
+	if major != 2 {
+		return nil, fmt.Errorf("%w: unsupported binary format version %d", errInvalidMMDB, major)
+	}
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", errInvalidMMDB, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", errInvalidMMDB, r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	dataStart := treeSize + mmdbDataSectionSeparator
+	dataEnd := uint(searchFrom + idx)
+	if dataStart > dataEnd {
+		return nil, fmt.Errorf("%w: search tree exceeds file", errInvalidMMDB)
+	}
+	r.tree = buf[:treeSize]
+	r.data = mmdbDecoder{buf: buf[dataStart:dataEnd]}
+	return r, nil
+}
+
+func mmdbMetaUint(meta map[string]any, key string) (uint, error) {
+	v, ok := meta[key].(uint64)
+	if !ok {
+		return 0, fmt.Errorf("%w: missing metadata %s", errInvalidMMDB, key)
+	}
+	return uint(v), nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *mmdbReader) record(node uint, bit uint32) uint {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+uint(bit)*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		b := r.tree[node*8+uint(bit)*4:]
+		return uint(binary.BigEndian.Uint32(b))
+	}
+}
+
+// networks calls fn for every IPv4 network that points to a data record
+// in ascending order with the offset of the record within the data section.
+func (r *mmdbReader) networks(fn func(prefix netip.Prefix, offset uint) error) error {
+	node := uint(0)
+	if r.ipVersion == 6 {
+		// IPv4 addresses are stored within ::/96
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node = r.record(node, 0)
+		}
+	}
+	var visited uint
+	return r.walk(node, 0, 0, &visited, fn)
+}
+
+// walk visits the subtree of node depth-first. Every node of a valid search tree is reached
+// by a single path, a tree that refers to more nodes than it contains shares or cycles through
+// nodes and is rejected before the walk explodes.
+func (r *mmdbReader) walk(node uint, ip uint32, depth int, visited *uint, fn func(prefix netip.Prefix, offset uint) error) error {
+	switch {
+	case node == r.nodeCount:
+		return nil
+	case node > r.nodeCount:
+		offset := node - r.nodeCount - mmdbDataSectionSeparator
+		if node-r.nodeCount < mmdbDataSectionSeparator || offset >= uint(len(r.data.buf)) {
+			return fmt.Errorf("%w: invalid data pointer %d", errInvalidMMDB, node)
+		}
+		return fn(netip.PrefixFrom(uint32ToAddr(ip), depth), offset)
+	case depth == 32:
+		return fmt.Errorf("%w: search tree deeper than 32 bits", errInvalidMMDB)
+	}
+	*visited++
+	if *visited > r.nodeCount {
+		return fmt.Errorf("%w: search tree visits more than %d nodes", errInvalidMMDB, r.nodeCount)
+	}
+
+	for bit := uint32(0); bit <= 1; bit++ {
+		err := r.walk(r.record(node, bit), ip|bit<<(31-depth), depth+1, visited, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mmdbWriter builds an IPv4 search tree whose networks point to deduplicated data records.
+type mmdbWriter struct {
+	// every node has a left and a right record, which either contain a node index,
+	// the index of a data record encoded as -(idx+1) or 0 for empty records.
+	nodes   [][2]int
+	data    mmdbEncoder
+	offsets []int          // offsets of data records
+	records map[string]int // index of data records by their encoding
+}
+
+func newMMDBWriter() *mmdbWriter {
+	return &mmdbWriter{
+		// root node
+		nodes:   make([][2]int, 1),
+		records: make(map[string]int),
+	}
+}
+
+// insert adds a network that must not overlap with previously inserted networks.
+func (w *mmdbWriter) insert(prefix netip.Prefix, record any) error {
+	if prefix.Bits() == 0 {
+		// the root node cannot be a data record
+		for _, half := range []string{"0.0.0.0/1", "128.0.0.0/1"} {
+			err := w.insert(netip.MustParsePrefix(half), record)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var enc mmdbEncoder
+	err := enc.encode(record)
+	if err != nil {
+		return err
+	}
+	key := enc.buf.String()
+	idx, ok := w.records[key]
+	if !ok {
+		idx = len(w.offsets)
+		w.offsets = append(w.offsets, w.data.buf.Len())
+		w.data.buf.Write(enc.buf.Bytes())
+		w.records[key] = idx
+	}
+
+	ip := addrToUint32(prefix.Addr())
+	node := 0
+	for depth := 0; depth < prefix.Bits(); depth++ {
+		bit := (ip >> (31 - depth)) & 1
+		if depth == prefix.Bits()-1 {
+			if w.nodes[node][bit] != 0 {
+				return fmt.Errorf("network %s overlaps with a previously inserted network", prefix)
+			}
+			w.nodes[node][bit] = -(idx + 1)
+			break
+		}
+
+		next := w.nodes[node][bit]
+		switch {
+		case next < 0:
+			return fmt.Errorf("network %s overlaps with a previously inserted network", prefix)
+		case next == 0:
+			next = len(w.nodes)
+			w.nodes = append(w.nodes, [2]int{})
+			w.nodes[node][bit] = next
+		}
+		node = next
+	}
+	return nil
+}
+
+// write serializes the database with the given metadata.
+func (w *mmdbWriter) write(buf *bytes.Buffer, meta map[string]any) error {
+	nodeCount := uint64(len(w.nodes))
+	maxRecord := nodeCount + mmdbDataSectionSeparator + uint64(w.data.buf.Len())
+
+	var recordSize uint64
+	switch {
+	case maxRecord < 1<<24:
+		recordSize = 24
+	case maxRecord < 1<<28:
+		recordSize = 28
+	case maxRecord < 1<<32:
+		recordSize = 32
+	default:
+		return errors.New("mmdb exceeds the maximum size")
+	}
+
+	value := func(r int) uint64 {
+		switch {
+		case r > 0:
+			return uint64(r)
+		case r < 0:
+			return nodeCount + mmdbDataSectionSeparator + uint64(w.offsets[-r-1])
+		default:
+			return nodeCount
+		}
+	}
+
+	for _, n := range w.nodes {
+		left, right := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			buf.Write([]byte{
+				byte(left >> 16), byte(left >> 8), byte(left),
+				byte(right >> 16), byte(right >> 8), byte(right),
+			})
+		case 28:
+			buf.Write([]byte{
+				byte(left >> 16), byte(left >> 8), byte(left),
+				byte(left>>20)&0xf0 | byte(right>>24)&0x0f,
+				byte(right >> 16), byte(right >> 8), byte(right),
+			})
+		default:
+			_ = binary.Write(buf, binary.BigEndian, [2]uint32{uint32(left), uint32(right)})
+		}
+	}
+
+	buf.Write(make([]byte, mmdbDataSectionSeparator))
+	buf.Write(w.data.buf.Bytes())
+	buf.Write(mmdbMetadataMarker)
+
+	meta["node_count"] = uint32(nodeCount)
+	meta["record_size"] = uint16(recordSize)
+	meta["ip_version"] = uint16(4)
+	meta["binary_format_major_version"] = uint16(2)
+	meta["binary_format_minor_version"] = uint16(0)
+
+	var enc mmdbEncoder
+	err := enc.encode(meta)
+	if err != nil {
+		return err
+	}
+	buf.Write(enc.buf.Bytes())
+	return nil
+}
@@ -0,0 +1,303 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"math/big"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMMDBEncoding(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected []byte
+	}{
+		{"Hello", append([]byte{0x45}, "Hello"...)},
+		{strings.Repeat("a", 29), append([]byte{0x5d, 0x00}, strings.Repeat("a", 29)...)},
+		{strings.Repeat("a", 285), append([]byte{0x5e, 0x00, 0x00}, strings.Repeat("a", 285)...)},
+		{uint16(0x1234), []byte{0xa2, 0x12, 0x34}},
+		{uint32(0), []byte{0xc0}},
+		{uint64(1), []byte{0x01, 0x02, 0x01}},
+		{true, []byte{0x01, 0x07}},
+		{false, []byte{0x00, 0x07}},
+		{[]string{"a"}, []byte{0x01, 0x04, 0x41, 'a'}},
+		{map[string]any{"en": "x"}, []byte{0xe1, 0x42, 'e', 'n', 0x41, 'x'}},
+	}
+
+	for _, tt := range tests {
+		var enc mmdbEncoder
+		require.NoError(t, enc.encode(tt.value))
+		require.Equal(t, tt.expected, enc.buf.Bytes(), "%v", tt.value)
+
+		decoded, next, err := mmdbDecoder{buf: tt.expected}.decode(0, 0)
+		require.NoError(t, err)
+		require.Equal(t, uint(len(tt.expected)), next)
+
+		switch v := tt.value.(type) {
+		case uint16:
+			require.Equal(t, uint64(v), decoded)
+		case uint32:
+			require.Equal(t, uint64(v), decoded)
+		case []string:
+			require.Equal(t, []any{v[0]}, decoded)
+		default:
+			require.Equal(t, tt.value, decoded)
+		}
+	}
+}
+
+func TestMMDBDecoding(t *testing.T) {
+	require := require.New(t)
+
+	buf := []byte{
+		0x42, 'h', 'i', // 0: "hi"
+		0x20, 0x00, // 3: pointer to 0
+		0x04, 0x01, 0xff, 0xff, 0xff, 0xfe, // 5: int32 -2
+		0x02, 0x03, 0x01, 0x02, // 11: uint128 258
+		0x68, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, // 15: double 1.0
+	}
+	dec := mmdbDecoder{buf: buf}
+
+	v, next, err := dec.decode(3, 0)
+	require.NoError(err)
+	require.Equal("hi", v)
+	require.Equal(uint(5), next)
+
+	v, _, err = dec.decode(5, 0)
+	require.NoError(err)
+	require.Equal(int32(-2), v)
+
+	v, _, err = dec.decode(11, 0)
+	require.NoError(err)
+	require.Equal(0, big.NewInt(258).Cmp(v.(*big.Int)))
+
+	v, _, err = dec.decode(15, 0)
+	require.NoError(err)
+	require.Equal(1.0, v)
+
+	for _, ctrl := range [][]byte{
+		{0x28, 0x00, 0x00},
+		{0x30, 0x00, 0x00, 0x00},
+		{0x38, 0x00, 0x00, 0x00, 0x05},
+	} {
+		typ, ptr, _, err := mmdbDecoder{buf: ctrl}.control(0)
+		require.NoError(err)
+		require.Equal(byte(mmdbPointer), typ)
+		switch len(ctrl) {
+		case 3:
+			require.Equal(uint(2048), ptr)
+		case 4:
+			require.Equal(uint(526336), ptr)
+		default:
+			require.Equal(uint(5), ptr)
+		}
+	}
+
+	_, _, err = mmdbDecoder{buf: []byte{0x45, 'a'}}.decode(0, 0)
+	require.ErrorIs(err, ErrInvalidListFormat)
+
+	// a map that claims about 16 million entries is rejected without allocating them
+	_, _, err = mmdbDecoder{buf: []byte{0xff, 0xff, 0xff, 0xff}}.decode(0, 0)
+	require.ErrorIs(err, ErrInvalidListFormat)
+}
+
+func TestMMDBRecordSizes(t *testing.T) {
+	require := require.New(t)
+
+	tests := []struct {
+		size        uint
+		tree        []byte
+		left, right uint
+	}{
+		{24, []byte{0xab, 0xcd, 0xef, 0xfe, 0xdc, 0xba}, 0xabcdef, 0xfedcba},
+		{28, []byte{0xbc, 0xde, 0xf0, 0xaf, 0xed, 0xcb, 0xa0}, 0xabcdef0, 0xfedcba0},
+		{32, []byte{0x00, 0xab, 0xcd, 0xef, 0x00, 0xfe, 0xdc, 0xba}, 0xabcdef, 0xfedcba},
+	}
+	for _, tt := range tests {
+		r := &mmdbReader{tree: tt.tree, nodeCount: 1, recordSize: tt.size}
+		require.Equal(tt.left, r.record(0, 0), "%d", tt.size)
+		require.Equal(tt.right, r.record(0, 1), "%d", tt.size)
+	}
+}
+
+func TestMMDBSearchTreeBounds(t *testing.T) {
+	require := require.New(t)
+
+	noop := func(netip.Prefix, uint) error {
+		return nil
+	}
+
+	// node 0 refers to itself
+	r := &mmdbReader{tree: []byte{0, 0, 0, 0, 0, 1}, nodeCount: 1, recordSize: 24, ipVersion: 4}
+	err := r.networks(noop)
+	require.ErrorIs(err, ErrInvalidListFormat)
+	require.ErrorContains(err, "visits more than 1 nodes")
+
+	// both records of every node refer to the next node, which would visit 2^31 nodes
+	const nodes = 31
+	var tree []byte
+	for i := uint32(1); i <= nodes; i++ {
+		tree = append(tree, byte(i>>16), byte(i>>8), byte(i), byte(i>>16), byte(i>>8), byte(i))
+	}
+	r = &mmdbReader{tree: tree, nodeCount: nodes, recordSize: 24, ipVersion: 4}
+	err = r.networks(noop)
+	require.ErrorIs(err, ErrInvalidListFormat)
+	require.ErrorContains(err, "visits more than 31 nodes")
+}
+
+func TestMMDBExportImport(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("0.0.0.0 - 0.0.0.10", []byte("zero"))
+	require.NoError(err)
+	_, err = ndb.Insert("10.0.0.3 - 10.0.1.200", []byte("vpn"))
+	require.NoError(err)
+	_, err = ndb.Insert("10.0.2.0/24", []byte("tor"))
+	require.NoError(err)
+	_, err = ndb.Insert("255.255.255.255", []byte{0xff, 0xfe})
+	require.NoError(err)
+
+	var buf bytes.Buffer
+	require.NoError(ndb.ExportMMDB(&buf, WithDatabaseType("nutbreaker-test"), WithDescription("test list")))
+
+	db, err := newMMDBReader(buf.Bytes())
+	require.NoError(err)
+	require.Equal(uint(24), db.recordSize)
+
+	var networks []string
+	require.NoError(db.networks(func(prefix netip.Prefix, offset uint) error {
+		networks = append(networks, prefix.String())
+		return nil
+	}))
+	require.Contains(networks, "10.0.0.3/32")
+	require.Contains(networks, "10.0.2.0/24")
+
+	other, otherCleanup := initDB(t)
+	defer otherCleanup()
+
+	result, err := other.ImportMMDB(bytes.NewReader(buf.Bytes()), MMDBMapping{
+		Filter: func(r MMDBRecord) bool {
+			v, _ := r.Field("value")
+			return v != "tor"
+		},
+		Value: "{value}",
+	})
+	require.NoError(err)
+	require.Empty(result.Errors)
+	require.Equal(1, result.Skipped)
+	require.Equal("nutbreaker-test", result.Metadata.Name)
+	require.Equal("test list", result.Metadata.Category)
+
+	expected, err := ndb.exportRanges(exportOptions{filter: func(r Range) bool {
+		return string(r.Value) != "tor"
+	}})
+	require.NoError(err)
+	actual, err := other.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.Equal(expected, actual)
+	consistent(t, other)
+}
+
+func TestMMDBRecordField(t *testing.T) {
+	r := MMDBRecord{Data: map[string]any{
+		"country": map[string]any{"iso_code": "DE"},
+		"subdivisions": []any{
+			map[string]any{"names": map[string]any{"en": "Berlin"}},
+		},
+	}}
+
+	v, ok := r.Field("country.iso_code")
+	require.True(t, ok)
+	require.Equal(t, "DE", v)
+
+	v, ok = r.Field("subdivisions.0.names.en")
+	require.True(t, ok)
+	require.Equal(t, "Berlin", v)
+
+	_, ok = r.Field("subdivisions.1.names.en")
+	require.False(t, ok)
+	_, ok = r.Field("country.iso_code.x")
+	require.False(t, ok)
+}
+
+// The reference databases in testdata/mmdb are test files of the MaxMind DB specification,
+// see https://github.com/maxmind/MaxMind-DB/tree/main/test-data
+func TestMMDBReferenceDatabases(t *testing.T) {
+	for _, size := range []string{"24", "28", "32"} {
+		t.Run(size, func(t *testing.T) {
+			ndb, cleanup := initDB(t)
+			defer cleanup()
+			require := require.New(t)
+
+			f, err := os.Open("testdata/mmdb/MaxMind-DB-test-ipv4-" + size + ".mmdb")
+			require.NoError(err)
+			defer f.Close()
+
+			result, err := ndb.ImportMMDB(f, MMDBMapping{Value: "{ip}"})
+			require.NoError(err)
+			require.Empty(result.Errors)
+			require.Equal("Test", result.Metadata.Name)
+
+			ranges, err := ndb.exportRanges(exportOptions{})
+			require.NoError(err)
+			actual := make([]string, 0, len(ranges))
+			for _, r := range ranges {
+				actual = append(actual, r.String()+"="+string(r.Value))
+			}
+			require.Equal([]string{
+				"1.1.1.1=1.1.1.1",
+				"1.1.1.2 - 1.1.1.3=1.1.1.2",
+				"1.1.1.4 - 1.1.1.7=1.1.1.4",
+				"1.1.1.8 - 1.1.1.15=1.1.1.8",
+				"1.1.1.16 - 1.1.1.31=1.1.1.16",
+				"1.1.1.32=1.1.1.32",
+			}, actual)
+			consistent(t, ndb)
+		})
+	}
+
+	t.Run("anonymous ip", func(t *testing.T) {
+		ndb, cleanup := initDB(t)
+		defer cleanup()
+		require := require.New(t)
+
+		f, err := os.Open("testdata/mmdb/GeoIP2-Anonymous-IP-Test.mmdb")
+		require.NoError(err)
+		defer f.Close()
+
+		// the IPv4 subtree of the IPv6 database is imported, IPv6 networks are ignored
+		result, err := ndb.ImportMMDB(f, MMDBMapping{
+			Filter: func(r MMDBRecord) bool {
+				v, _ := r.Field("is_tor_exit_node")
+				return v == true
+			},
+			Value: "tor",
+		})
+		require.NoError(err)
+		require.Empty(result.Errors)
+		require.Equal("GeoIP2-Anonymous-IP", result.Metadata.Name)
+
+		ranges, err := ndb.exportRanges(exportOptions{})
+		require.NoError(err)
+		actual := make([]string, 0, len(ranges))
+		for _, r := range ranges {
+			actual = append(actual, r.String())
+		}
+		require.Equal([]string{
+			"1.124.213.1",
+			"65.0.0.0 - 65.7.255.255",
+			"81.2.69.0 - 81.2.69.255",
+		}, actual)
+
+		value, err := ndb.Find("65.3.2.1")
+		require.NoError(err)
+		require.Equal("tor", string(value))
+		consistent(t, ndb)
+	})
+}
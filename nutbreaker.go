@@ -4,10 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"net/netip"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync/atomic"
+	"time"
 
 	"github.com/nutsdb/nutsdb"
 )
@@ -18,6 +19,24 @@ type NutBreaker struct {
 	blacklistBucket       string
 	blacklistSortedSetKey []byte
 	whitelistBucket       string
+	auditBucket           string
+	audit                 bool
+	snapshotBucket        string
+	metadataBucket        string
+	historyBucket         string
+	history               bool
+	historyRetention      time.Duration
+	keyring               *Keyring
+
+	// set if the integrity check at startup failed with the RecoverReadOnly policy
+	// until the database is repaired
+	readOnly  atomic.Bool
+	integrity *VerifyReport
+
+	// distinguishes journal entries that are recorded at the same time
+	seq atomic.Uint32
+
+	now func() time.Time
 }
 
 func NewNutBreaker(opts ...Option) (nb *NutBreaker, err error) {
@@ -33,6 +52,10 @@ func NewNutBreaker(opts ...Option) (nb *NutBreaker, err error) {
 		blacklistBucket:       "blacklist",
 		blacklistSortedSetKey: "blacklist-zkey",
 		whitelistBucket:       "whitelist",
+		auditBucket:           "audit",
+		snapshotBucket:        "snapshots",
+		metadataBucket:        "metadata",
+		historyBucket:         "history",
 	}
 
 	for _, o := range opts {
@@ -50,7 +73,7 @@ func NewNutBreaker(opts ...Option) (nb *NutBreaker, err error) {
 	}
 	defer func() {
 		if err != nil {
-			err = errors.Join(db.Close())
+			err = errors.Join(err, db.Close())
 		}
 	}()
 
@@ -60,25 +83,80 @@ func NewNutBreaker(opts ...Option) (nb *NutBreaker, err error) {
 		blacklistBucket:       opt.blacklistBucket,
 		whitelistBucket:       opt.whitelistBucket,
 		blacklistSortedSetKey: []byte(opt.blacklistSortedSetKey),
-	}
-
-	// init database
-	err = nb.db.Update(nb.createBuckets)
+		auditBucket:           opt.auditBucket,
+		audit:                 opt.audit,
+		snapshotBucket:        opt.snapshotBucket,
+		metadataBucket:        opt.metadataBucket,
+		historyBucket:         opt.historyBucket,
+		history:               opt.history,
+		historyRetention:      opt.historyRetention,
+		keyring:               opt.keyring,
+		now:                   time.Now,
+	}
+
+	var exists bool
+	err = nb.db.View(func(tx *nutsdb.Tx) error {
+		exists = nb.bucketsExist(tx)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	err = nb.db.Update(nb.initBuckets)
+	err = nb.db.View(nb.loadSeq)
 	if err != nil {
 		return nil, err
 	}
 
+	// an existing database is verified before it is initialized, which would insert missing
+	// sentinels and must not modify a database that is refused or opened read-only
+	if opt.integrityCheck && exists {
+		err = nb.checkIntegrity(opt.recovery, opt.recoveryBackup)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// init database
+	if !nb.readOnly.Load() {
+		err = nb.db.Update(nb.createBuckets)
+		if err != nil {
+			return nil, err
+		}
+		err = nb.db.Update(nb.initBuckets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opt.integrityCheck && !exists {
+		err = nb.checkIntegrity(opt.recovery, opt.recoveryBackup)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return nb, nil
 }
 
+// update executes fn within a read/write transaction unless the database is read-only.
+func (n *NutBreaker) update(fn func(tx *nutsdb.Tx) error) error {
+	if n.readOnly.Load() {
+		return ErrReadOnly
+	}
+	return n.db.Update(fn)
+}
+
 func (n *NutBreaker) DataDir() string {
 	return n.dataDir
 }
 
+// bucketsExist returns false for a new database without range index.
+func (n *NutBreaker) bucketsExist(tx *nutsdb.Tx) bool {
+	return tx.ExistBucket(nutsdb.DataStructureBTree, n.blacklistBucket) ||
+		tx.ExistBucket(nutsdb.DataStructureSortedSet, n.blacklistBucket) ||
+		tx.ExistBucket(nutsdb.DataStructureBTree, n.whitelistBucket)
+}
+
 func (n *NutBreaker) createBuckets(tx *nutsdb.Tx) (err error) {
 	if !tx.ExistBucket(nutsdb.DataStructureBTree, n.blacklistBucket) {
 		err = tx.NewKVBucket(n.blacklistBucket)
@@ -101,6 +179,34 @@ func (n *NutBreaker) createBuckets(tx *nutsdb.Tx) (err error) {
 		}
 	}
 
+	if !tx.ExistBucket(nutsdb.DataStructureBTree, n.snapshotBucket) {
+		err = tx.NewKVBucket(n.snapshotBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot kv bucket: %v", err)
+		}
+	}
+
+	if !tx.ExistBucket(nutsdb.DataStructureBTree, n.metadataBucket) {
+		err = tx.NewKVBucket(n.metadataBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create metadata kv bucket: %v", err)
+		}
+	}
+
+	if n.audit && !tx.ExistBucket(nutsdb.DataStructureBTree, n.auditBucket) {
+		err = tx.NewKVBucket(n.auditBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create audit kv bucket: %v", err)
+		}
+	}
+
+	if n.history && !tx.ExistBucket(nutsdb.DataStructureBTree, n.historyBucket) {
+		err = tx.NewKVBucket(n.historyBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create history kv bucket: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -121,6 +227,13 @@ func (n *NutBreaker) initBuckets(tx *nutsdb.Tx) (err error) {
 	if err != nil {
 		return fmt.Errorf("failed to insert posInfBoundary: %v", err)
 	}
+
+	if n.history {
+		err = n.initHistory(tx)
+		if err != nil {
+			return fmt.Errorf("failed to init history: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -128,43 +241,77 @@ func (n *NutBreaker) Close() error {
 	return n.db.Close()
 }
 
-func (n *NutBreaker) flush(tx *nutsdb.Tx) (err error) {
+// flush removes all ranges and whitelist entries within a single transaction.
+// The removed boundaries are recorded in the history, the action is recorded in the audit log.
+func (n *NutBreaker) flush(tx *nutsdb.Tx, action AuditAction) (err error) {
+	bs, err := n.all(newTxn(n, tx, false))
+	if err != nil {
+		return err
+	}
 
-	if tx.ExistBucket(
-		nutsdb.DataStructureBTree,
-		n.blacklistBucket,
-	) {
-		err = tx.DeleteBucket(nutsdb.DataStructureBTree, n.blacklistBucket)
+	changes := make([]historyChange, 0, len(bs))
+	for _, b := range bs {
+		if b.IsInf() {
+			continue
+		}
+		v := b.ToDBValue()
+		changes = append(changes, historyChange{IP: uint32(b.Score), Before: &v})
+	}
+
+	err = n.rebuildIndex(tx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to flush blacklist: %w", err)
+	}
+
+	keys, err := tx.GetKeys(n.whitelistBucket)
+	if err != nil {
+		return fmt.Errorf("failed to read whitelist bucket: %w", err)
+	}
+	for _, key := range keys {
+		err = tx.Delete(n.whitelistBucket, key)
 		if err != nil {
-			return fmt.Errorf("failed to delete blacklist kv bucket: %v", err)
+			return fmt.Errorf("failed to flush whitelist: %w", err)
 		}
 	}
 
-	if tx.ExistBucket(nutsdb.DataStructureBTree, n.whitelistBucket) {
-		err = tx.DeleteBucket(nutsdb.DataStructureBTree, n.whitelistBucket)
+	seq := n.seq.Load()
+	if n.audit {
+		err = n.writeAudit(tx, []AuditEntry{n.bulkAuditEntry(action, "", nil)})
 		if err != nil {
-			return fmt.Errorf("failed to create whitelist bucket: %v", err)
+			return err
 		}
 	}
-	return nil
+	err = n.recordHistory(tx, changes)
+	if err != nil {
+		return err
+	}
+	return n.saveSeq(tx, seq)
 }
 
+// Flush removes all ranges within a single transaction.
 func (n *NutBreaker) Flush() error {
-	return n.db.Update(n.flush)
+	return n.update(func(tx *nutsdb.Tx) error {
+		return n.flush(tx, AuditFlush)
+	})
 }
 
+// Reset creates missing buckets and removes all ranges, see Flush.
 func (n *NutBreaker) Reset() error {
-	err := n.db.Update(n.flush)
+	// buckets cannot be created and written within the same transaction,
+	// only the last transaction modifies existing data.
+	err := n.update(n.createBuckets)
 	if err != nil {
 		return err
 	}
 
-	err = n.db.Update(n.createBuckets)
+	err = n.update(n.initBuckets)
 	if err != nil {
 		return err
 	}
 
-	err = n.db.Update(n.initBuckets)
+	err = n.update(func(tx *nutsdb.Tx) error {
+		return n.flush(tx, AuditReset)
+	})
 	if err != nil {
 		return err
 	}
@@ -174,7 +321,7 @@ func (n *NutBreaker) Reset() error {
 
 func (n *NutBreaker) getAll() ([]boundary, error) {
 	result := make([]boundary, 0, 3)
-	err := n.db.View(func(tx *nutsdb.Tx) error {
+	err := n.View(func(tx *Txn) error {
 		inside, err := n.all(tx)
 		if err != nil {
 			return err
@@ -189,34 +336,15 @@ func (n *NutBreaker) getAll() ([]boundary, error) {
 	return result, nil
 }
 
-func (n *NutBreaker) all(tx *nutsdb.Tx) (inside []boundary, err error) {
-	members, err := tx.ZRangeByScore(
-		n.blacklistBucket,
-		n.blacklistSortedSetKey,
-		negInf,
-		posInf,
-		&nutsdb.GetByScoreRangeOptions{
-			ExcludeStart: false,
-			ExcludeEnd:   false,
-		},
-	)
+func (n *NutBreaker) all(tx *Txn) (inside []boundary, err error) {
+	inside, err = tx.rangeByScore(negInf, posInf, 0)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all: %v", err)
 	}
-
-	inside = make([]boundary, 0, len(members))
-	var b boundary
-	for _, m := range members {
-		b, err = newBoundaryFromDB(tx, n.blacklistBucket, m)
-		if err != nil {
-			return nil, err
-		}
-		inside = append(inside, b)
-	}
 	return inside, nil
 }
 
-func (n *NutBreaker) vicinity(tx *nutsdb.Tx, low, high boundary, num int) (below, inside, above []boundary, err error) {
+func (n *NutBreaker) vicinity(tx *Txn, low, high boundary, num int) (below, inside, above []boundary, err error) {
 	if num < 0 {
 		panic(fmt.Sprintf("passed num parameter must be >= 0, got %d", num))
 	}
@@ -230,122 +358,55 @@ func (n *NutBreaker) vicinity(tx *nutsdb.Tx, low, high boundary, num int) (below
 		}
 	}()
 
-	membersBelow, err := tx.ZRangeByScore(
-		n.blacklistBucket,
-		n.blacklistSortedSetKey,
+	below, err = tx.rangeByScore(
 		low.Below().Score, //reverse order of scores in order to get nearest below
 		negInf,
-		&nutsdb.GetByScoreRangeOptions{
-			ExcludeStart: false,
-			ExcludeEnd:   false,
-			Limit:        num,
-		},
+		num,
 	)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	membersInside, err := tx.ZRangeByScore(
-		n.blacklistBucket,
-		n.blacklistSortedSetKey,
+	inside, err = tx.rangeByScore(
 		low.Score,
 		high.Score,
-		&nutsdb.GetByScoreRangeOptions{
-			ExcludeStart: false,
-			ExcludeEnd:   false,
-		},
+		0,
 	)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	membersAbove, err := tx.ZRangeByScore(
-		n.blacklistBucket,
-		n.blacklistSortedSetKey,
+	above, err = tx.rangeByScore(
 		high.Above().Score,
 		posInf,
-		&nutsdb.GetByScoreRangeOptions{
-			ExcludeStart: false,
-			ExcludeEnd:   false,
-			Limit:        num,
-		},
+		num,
 	)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	var b boundary
-	below = make([]boundary, 0, len(membersBelow))
-	inside = make([]boundary, 0, len(membersInside))
-	above = make([]boundary, 0, len(membersAbove))
-
-	// create below IPs
-	for _, m := range membersBelow {
-		b, err = newBoundaryFromDB(tx, n.blacklistBucket, m)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		below = append(below, b)
-	}
-
 	// should be faster than prepending values to a slice
 	if len(below) > 1 {
 		sort.Sort(byIP(below))
 	}
-
-	// create inside IPs
-	for _, m := range membersInside {
-		b, err = newBoundaryFromDB(tx, n.blacklistBucket, m)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		inside = append(inside, b)
-	}
-
-	if len(inside) > 1 {
-		sort.Sort(byIP(inside))
-	}
-
-	// create above IPs
-	for _, m := range membersAbove {
-		b, err = newBoundaryFromDB(tx, n.blacklistBucket, m)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		above = append(above, b)
-	}
-
-	if len(above) > 1 {
-		sort.Sort(byIP(above))
-	}
 	return below, inside, above, nil
 }
 
-func (n *NutBreaker) Insert(ipRange string, value []byte) (err error) {
-	tx, err := n.db.Begin(true)
+// Insert inserts a new IP range or IP with an associated value.
+// The result lists all previously stored ranges that were overwritten.
+func (n *NutBreaker) Insert(ipRange string, value []byte, opts ...MutationOption) (result MutationResult, err error) {
+	err = n.Update(func(tx *Txn) (err error) {
+		result, err = tx.Insert(ipRange, value, opts...)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return MutationResult{}, err
 	}
-	defer func() {
-		if err != nil {
-			err = errors.Join(err, tx.Rollback())
-		} else {
-			err = errors.Join(err, tx.Commit())
-		}
-	}()
-
-	return n.insert(tx, ipRange, value)
-
-	// use this wrapper once the bug is fixed
-	/*
-		return n.db.Update(func(tx *nutsdb.Tx) error {
-				return
-			})
-	*/
+	return result, nil
 }
 
 // Insert inserts a new IP range or IP into the database with an associated reason string
-func (n *NutBreaker) insert(tx *nutsdb.Tx, ipRange string, value []byte) (err error) {
+func (n *NutBreaker) insert(tx *Txn, ipRange string, value []byte) (result MutationResult, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to insert %s: %v", ipRange, err)
@@ -354,39 +415,49 @@ func (n *NutBreaker) insert(tx *nutsdb.Tx, ipRange string, value []byte) (err er
 
 	low, high, err := parseRange(ipRange, value)
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	belowN, inside, aboveN, err := n.vicinity(tx, low, high, 1)
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	if len(belowN) == 0 || len(aboveN) == 0 {
-		return fmt.Errorf("database inconsistent: %d below, %d above", len(belowN), len(aboveN))
+		return MutationResult{}, fmt.Errorf("database inconsistent: %d below, %d above", len(belowN), len(aboveN))
 	}
 
+	result = newMutationResult(
+		overlappingRanges(belowN, inside, aboveN, low, high),
+		Range{Low: low.IP, High: high.IP, Value: value},
+		false,
+	)
+
 	// remove inside
 	err = n.removeInside(tx, inside)
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	// pretend that single ip ranges are also just lower or upper boundaries.
 	insertLowerBound, err := n.fixRangeBelow(tx, low.AsLowerBound(), belowN[0])
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	insertUpperBound, err := n.fixRangeAbove(tx, high.AsUpperBound(), aboveN[0])
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
-	return n.insertRange(tx, low, high, insertLowerBound, insertUpperBound)
+	err = n.insertRange(tx, low, high, insertLowerBound, insertUpperBound)
+	if err != nil {
+		return MutationResult{}, err
+	}
+	return result, nil
 }
 
-func (n *NutBreaker) fixRangeBelow(tx *nutsdb.Tx, low, belowNearest boundary) (insertLowerBound bool, err error) {
+func (n *NutBreaker) fixRangeBelow(tx *Txn, low, belowNearest boundary) (insertLowerBound bool, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to insertLowerBound %s: %v", low, err)
@@ -408,11 +479,7 @@ func (n *NutBreaker) fixRangeBelow(tx *nutsdb.Tx, low, belowNearest boundary) (i
 
 		canInsertBelowLow := !belowNearest.EqualIP(belowCut)
 		if canInsertBelowLow {
-			err = belowCut.Insert(
-				tx,
-				n.blacklistBucket,
-				n.blacklistSortedSetKey,
-			)
+			err = tx.insert(belowCut)
 			if err != nil {
 				return false, err
 			}
@@ -423,10 +490,7 @@ func (n *NutBreaker) fixRangeBelow(tx *nutsdb.Tx, low, belowNearest boundary) (i
 		// lower boundary by inserting an upper boundary
 		// -> make the existing boundary a double boundary
 		belowNearest.SetDoubleBound()
-		err = belowNearest.Update(
-			tx,
-			n.blacklistBucket,
-		)
+		err = tx.update(belowNearest)
 		if err != nil {
 			return false, err
 		}
@@ -437,10 +501,7 @@ func (n *NutBreaker) fixRangeBelow(tx *nutsdb.Tx, low, belowNearest boundary) (i
 	if belowNearest.IsDoubleBound() && belowNearest.EqualIP(belowCut) && belowNearest.EqualValue(low) {
 		// one IP below we have a double boundary range with the same reason
 		belowNearest.SetLowerBound()
-		err = belowNearest.Update(
-			tx,
-			n.blacklistBucket,
-		)
+		err = tx.update(belowNearest)
 		if err != nil {
 			return false, err
 		}
@@ -450,7 +511,7 @@ func (n *NutBreaker) fixRangeBelow(tx *nutsdb.Tx, low, belowNearest boundary) (i
 	return true, nil
 }
 
-func (n *NutBreaker) fixRangeAbove(tx *nutsdb.Tx, high, aboveNearest boundary) (insertUpperBound bool, err error) {
+func (n *NutBreaker) fixRangeAbove(tx *Txn, high, aboveNearest boundary) (insertUpperBound bool, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to insertUpperBound %s: %v", high, err)
@@ -472,11 +533,7 @@ func (n *NutBreaker) fixRangeAbove(tx *nutsdb.Tx, high, aboveNearest boundary) (
 
 		canInsertAboveHigh := !aboveNearest.EqualIP(aboveCut)
 		if canInsertAboveHigh {
-			err = aboveCut.Insert(
-				tx,
-				n.blacklistBucket,
-				n.blacklistSortedSetKey,
-			)
+			err = tx.insert(aboveCut)
 			if err != nil {
 				return false, err
 			}
@@ -487,10 +544,7 @@ func (n *NutBreaker) fixRangeAbove(tx *nutsdb.Tx, high, aboveNearest boundary) (
 		// lower boundary by inserting an upper boundary
 		// -> make the existing boundary a double boundary
 		aboveNearest.SetDoubleBound()
-		err = aboveNearest.Update(
-			tx,
-			n.blacklistBucket,
-		)
+		err = tx.update(aboveNearest)
 		if err != nil {
 			return false, err
 		}
@@ -501,10 +555,7 @@ func (n *NutBreaker) fixRangeAbove(tx *nutsdb.Tx, high, aboveNearest boundary) (
 	if aboveNearest.IsDoubleBound() && aboveNearest.EqualIP(aboveCut) && aboveNearest.EqualValue(high) {
 		// one IP below we have a double boundary range with the same reason
 		aboveNearest.SetLowerBound()
-		err = aboveNearest.Update(
-			tx,
-			n.blacklistBucket,
-		)
+		err = tx.update(aboveNearest)
 		if err != nil {
 			return false, err
 		}
@@ -515,52 +566,32 @@ func (n *NutBreaker) fixRangeAbove(tx *nutsdb.Tx, high, aboveNearest boundary) (
 }
 
 // simply inserts a range, either a double boundary or a single boundary based on the boolean flags
-func (n *NutBreaker) insertRange(tx *nutsdb.Tx, low, high boundary, insertLow, insertHigh bool) (err error) {
+func (n *NutBreaker) insertRange(tx *Txn, low, high boundary, insertLow, insertHigh bool) (err error) {
 	if insertLow && insertHigh {
 
 		// double boundary, single insertion
-		if low.Equal(high) {
-			return low.AsDoubleBound().Insert(
-				tx,
-				n.blacklistBucket,
-				n.blacklistSortedSetKey,
-			)
+		if low.EqualIP(high) {
+			return tx.insert(low.AsDoubleBound())
 		}
 
 		// insert two different boundaries
-		err = low.Insert(
-			tx,
-			n.blacklistBucket,
-			n.blacklistSortedSetKey,
-		)
+		err = tx.insert(low)
 		if err != nil {
 			return err
 		}
-		err = high.Insert(
-			tx,
-			n.blacklistBucket,
-			n.blacklistSortedSetKey,
-		)
+		err = tx.insert(high)
 		if err != nil {
 			return err
 		}
 		return nil
 	} else if insertLow {
 
-		err = low.AsLowerBound().Insert(
-			tx,
-			n.blacklistBucket,
-			n.blacklistSortedSetKey,
-		)
+		err = tx.insert(low.AsLowerBound())
 		if err != nil {
 			return err
 		}
 	} else if insertHigh {
-		err = high.AsUpperBound().Insert(
-			tx,
-			n.blacklistBucket,
-			n.blacklistSortedSetKey,
-		)
+		err = tx.insert(high.AsUpperBound())
 		if err != nil {
 			return err
 		}
@@ -568,13 +599,20 @@ func (n *NutBreaker) insertRange(tx *nutsdb.Tx, low, high boundary, insertLow, i
 	return nil
 }
 
-func (n *NutBreaker) Remove(ipRange string) error {
-	return n.db.Update(func(tx *nutsdb.Tx) error {
-		return n.remove(tx, ipRange)
+// Remove removes an IP range or IP.
+// The result lists all previously stored ranges that were removed or cut.
+func (n *NutBreaker) Remove(ipRange string, opts ...MutationOption) (result MutationResult, err error) {
+	err = n.Update(func(tx *Txn) (err error) {
+		result, err = tx.Remove(ipRange, opts...)
+		return err
 	})
+	if err != nil {
+		return MutationResult{}, err
+	}
+	return result, nil
 }
 
-func (n *NutBreaker) remove(tx *nutsdb.Tx, ipRange string) (err error) {
+func (n *NutBreaker) remove(tx *Txn, ipRange string) (result MutationResult, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to remove %s: %v", ipRange, err)
@@ -583,43 +621,45 @@ func (n *NutBreaker) remove(tx *nutsdb.Tx, ipRange string) (err error) {
 
 	low, high, err := parseRange(ipRange, nil)
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	below, inside, above, err := n.vicinity(tx, low, high, 1)
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	if len(below) == 0 || len(above) == 0 {
-		return fmt.Errorf("database inconsistent: %d below, %d above", len(below), len(above))
+		return MutationResult{}, fmt.Errorf("database inconsistent: %d below, %d above", len(below), len(above))
 	}
 
+	result = newMutationResult(
+		overlappingRanges(below, inside, above, low, high),
+		Range{Low: low.IP, High: high.IP},
+		true,
+	)
+
 	err = n.removeInside(tx, inside)
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	err = n.removeLowerBound(tx, low, below[0])
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
 	err = n.removeUpperBound(tx, high, above[0])
 	if err != nil {
-		return err
+		return MutationResult{}, err
 	}
 
-	return nil
+	return result, nil
 }
 
-func (n *NutBreaker) removeInside(tx *nutsdb.Tx, inside []boundary) (err error) {
+func (n *NutBreaker) removeInside(tx *Txn, inside []boundary) (err error) {
 	for _, bnd := range inside {
-		err = bnd.Remove(
-			tx,
-			n.blacklistBucket,
-			n.blacklistSortedSetKey,
-		)
+		err = tx.delete(bnd)
 		if err != nil {
 			return fmt.Errorf("failed to remove inside %s: %v", bnd, err)
 		}
@@ -627,7 +667,7 @@ func (n *NutBreaker) removeInside(tx *nutsdb.Tx, inside []boundary) (err error)
 	return nil
 }
 
-func (n *NutBreaker) removeLowerBound(tx *nutsdb.Tx, low, belowNearest boundary) (err error) {
+func (n *NutBreaker) removeLowerBound(tx *Txn, low, belowNearest boundary) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to removeLow %s: %w", low, err)
@@ -643,22 +683,15 @@ func (n *NutBreaker) removeLowerBound(tx *nutsdb.Tx, low, belowNearest boundary)
 	if belowNearest.EqualIP(belowCut) {
 		// ip is one ip below and was cut to be a range that only contains a single ip
 		belowNearest.SetDoubleBound()
-		return belowNearest.Update(
-			tx,
-			n.blacklistBucket,
-		)
+		return tx.update(belowNearest)
 	}
 
 	// we cut a different range with the removal
 	// we need to add the upper boundary of the cut range
-	return belowCut.Insert(
-		tx,
-		n.blacklistBucket,
-		n.blacklistSortedSetKey,
-	)
+	return tx.insert(belowCut)
 }
 
-func (n *NutBreaker) removeUpperBound(tx *nutsdb.Tx, high, aboveNearest boundary) (err error) {
+func (n *NutBreaker) removeUpperBound(tx *Txn, high, aboveNearest boundary) (err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("failed to removeHigh %s: %w", high, err)
@@ -674,30 +707,18 @@ func (n *NutBreaker) removeUpperBound(tx *nutsdb.Tx, high, aboveNearest boundary
 	if aboveNearest.EqualIP(aboveCut) {
 		// ip is one ip above and was cut to be a range that only contains a single ip
 		aboveNearest.SetDoubleBound()
-		return aboveNearest.Update(
-			tx,
-			n.blacklistBucket,
-		)
+		return tx.update(aboveNearest)
 	}
 
 	// we cut a different range with the removal
 	// we need to add the lower boundary of the cut range
-	return aboveCut.Insert(
-		tx,
-		n.blacklistBucket,
-		n.blacklistSortedSetKey,
-	)
+	return tx.insert(aboveCut)
 }
 
 func (n *NutBreaker) Find(ip string) (value []byte, err error) {
-	err = n.db.View(func(tx *nutsdb.Tx) (err error) {
-		v, err := n.find(tx, ip)
-		if err != nil {
-			return err
-		}
-		value = make([]byte, len(v))
-		copy(value, v)
-		return nil
+	err = n.View(func(tx *Txn) (err error) {
+		value, err = tx.Find(ip)
+		return err
 	})
 	if err != nil {
 		return nil, err
@@ -710,55 +731,21 @@ func (n *NutBreaker) Find(ip string) (value []byte, err error) {
 // returns a reason or either
 // ErrIPNotFound if no IP was found
 // ErrDatabaseInconsistent if the database has become inconsistent.
-func (n *NutBreaker) find(tx *nutsdb.Tx, ip string) (value []byte, err error) {
-	addr, err := netip.ParseAddr(ip)
+func (n *NutBreaker) find(tx *Txn, ip string) (value []byte, err error) {
+	r, err := n.lookup(tx, ip)
 	if err != nil {
 		return nil, err
 	}
-
-	if !addr.Is4() {
-		return nil, ErrIPv6NotSupported
-	}
-
-	bnd, err := newBoundary(addr, true, true, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	below, inside, above, err := n.vicinity(tx, bnd, bnd, 1)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(inside) == 1 {
-		found := inside[0]
-		return found.Value, nil
-	}
-
-	if len(below) == 0 || len(above) == 0 {
-		return nil, fmt.Errorf("database inconsistent: %d below, %d above", len(below), len(above))
-	}
-
-	belowNearest := below[0]
-	aboveNearest := above[0]
-
-	if belowNearest.IsLowerBound() && aboveNearest.IsUpperBound() {
-		if belowNearest.EqualValue(aboveNearest) {
-			return belowNearest.Value, nil
-		}
-		return nil, fmt.Errorf("reasons inconsistent: %v != %v", belowNearest.Value, aboveNearest.Value)
-	}
-
-	return nil, ErrIPNotFound
+	return r.Value, nil
 }
 
 func (n *NutBreaker) isConsistent(ipRange ...string) error {
-	return n.db.View(func(tx *nutsdb.Tx) error {
+	return n.View(func(tx *Txn) error {
 		return n.consistent(tx, ipRange...)
 	})
 }
 
-func (n *NutBreaker) consistent(tx *nutsdb.Tx, ipRange ...string) error {
+func (n *NutBreaker) consistent(tx *Txn, ipRange ...string) error {
 	ipr := ""
 	if len(ipRange) > 0 {
 		ipr = ipRange[0]
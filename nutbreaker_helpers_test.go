@@ -8,7 +8,6 @@ import (
 	"strconv"
 	"testing"
 
-	"github.com/nutsdb/nutsdb"
 	"github.com/stretchr/testify/require"
 )
 
@@ -30,7 +29,7 @@ func vicinity(t *testing.T, ndb *NutBreaker, ipRanges string, num ...int) (below
 	low, high, err := parseRange(ipRanges, []byte("vicinity value"))
 	require.NoError(err, "parseRange() error = %v, wantErr %v", err, true)
 
-	err = ndb.db.View(func(tx *nutsdb.Tx) error {
+	err = ndb.View(func(tx *Txn) error {
 		b, i, a, err := ndb.vicinity(tx, low, high, n)
 		require.NoError(err, "vicinity() error = %v, wantErr %v", err, true)
 		below = append(below, b...)
@@ -38,7 +37,7 @@ func vicinity(t *testing.T, ndb *NutBreaker, ipRanges string, num ...int) (below
 		above = append(above, a...)
 		return nil
 	})
-	require.NoError(err, "ndb.db.View() error")
+	require.NoError(err, "ndb.View() error")
 	return below, inside, above
 }
 
@@ -46,6 +45,10 @@ func consistent(t *testing.T, ndb *NutBreaker) {
 	require := require.New(t)
 	err := ndb.isConsistent()
 	require.NoError(err, "ndb.isConsistent() error: Database INCONSISTENT")
+
+	report, err := ndb.Verify()
+	require.NoError(err)
+	require.Empty(report.Issues, "ndb.Verify() issues: Database INCONSISTENT")
 }
 
 func insert(t *testing.T, ndb *NutBreaker, sameValue bool, ipRanges ...string) (inserted []boundary) {
@@ -67,7 +70,7 @@ func insert(t *testing.T, ndb *NutBreaker, sameValue bool, ipRanges ...string) (
 			b = append(b, lo, hi)
 		}
 
-		err = ndb.Insert(r, value)
+		_, err = ndb.Insert(r, value)
 		require.NoError(err, "Insert(): %s", r)
 	}
 	return b
@@ -105,3 +108,16 @@ func equalBoundaries(t *testing.T, expected, got []boundary, err string) {
 
 	require.Equalf(expectedStr, actualStr, "equal() error: %s", err)
 }
+
+// initRangesDB returns a database that contains the ranges of the alternating range and value arguments,
+// e.g. initRangesDB(t, "10.0.0.0/24", "vpn", "10.0.2.1", "tor").
+func initRangesDB(t *testing.T, rangesAndValues ...string) (*NutBreaker, func()) {
+	require.Zero(t, len(rangesAndValues)%2, "missing value of range")
+
+	ndb, cleanup := initDB(t)
+	for i := 0; i < len(rangesAndValues); i += 2 {
+		_, err := ndb.Insert(rangesAndValues[i], []byte(rangesAndValues[i+1]))
+		require.NoError(t, err, "Insert(): %s", rangesAndValues[i])
+	}
+	return ndb, cleanup
+}
@@ -2,6 +2,8 @@ package nutbreaker
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestInsertSingleBigRange(t *testing.T) {
@@ -285,6 +287,39 @@ func TestInsertDoubleBoundaryInsideLB(t *testing.T) {
 	consistent(t, ndb)
 }
 
+func TestInsertSingleAddressRange(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	// ranges whose low and high address are equal are stored as a single double boundary
+	insert(
+		t,
+		ndb,
+		false,
+		"123.0.0.0 - 123.0.0.10",
+		"123.0.0.5 - 123.0.0.5",
+		"123.0.0.20 - 123.0.0.20",
+		"123.0.0.30/32",
+	)
+	consistent(t, ndb)
+
+	for ip, expected := range map[string]string{
+		"123.0.0.4":  "value 0",
+		"123.0.0.5":  "value 1",
+		"123.0.0.6":  "value 0",
+		"123.0.0.20": "value 2",
+		"123.0.0.30": "value 3",
+	} {
+		value, err := ndb.Find(ip)
+		require.NoError(err, ip)
+		require.Equal(expected, string(value), ip)
+	}
+
+	_, err := ndb.Find("123.0.0.21")
+	require.ErrorIs(err, ErrIPNotFound)
+}
+
 /*
 func TestInsertMultipleOverlapping(t *testing.T) {
 	ranges := []string{
@@ -1,5 +1,10 @@
 package nutbreaker
 
+import (
+	"fmt"
+	"time"
+)
+
 type Option func(*options) error
 
 type options struct {
@@ -7,6 +12,17 @@ type options struct {
 	blacklistBucket       string
 	blacklistSortedSetKey string
 	whitelistBucket       string
+	auditBucket           string
+	audit                 bool
+	snapshotBucket        string
+	metadataBucket        string
+	historyBucket         string
+	history               bool
+	historyRetention      time.Duration
+	keyring               *Keyring
+	integrityCheck        bool
+	recovery              RecoveryPolicy
+	recoveryBackup        string
 }
 
 func WithDir(dir string) Option {
@@ -15,3 +31,92 @@ func WithDir(dir string) Option {
 		return nil
 	}
 }
+
+// WithAuditLog enables the append-only audit log that records every mutation.
+func WithAuditLog() Option {
+	return func(o *options) error {
+		o.audit = true
+		return nil
+	}
+}
+
+// WithHistory enables the journal of all changes that allows to query the list at
+// any point in time within the retention period. A retention of 0 keeps the history forever.
+// The recorded history is discarded if the ranges were changed while the database was opened
+// without history.
+func WithHistory(retention time.Duration) Option {
+	return func(o *options) error {
+		if retention < 0 {
+			return fmt.Errorf("history retention must not be negative: %s", retention)
+		}
+		o.history = true
+		o.historyRetention = retention
+		return nil
+	}
+}
+
+// WithTrustedKeys requires a valid signature of a trusted key for every imported list and restored backup,
+// see WithSignature.
+func WithTrustedKeys(keyring *Keyring) Option {
+	return func(o *options) error {
+		if keyring == nil {
+			return fmt.Errorf("keyring must not be nil")
+		}
+		o.keyring = keyring
+		return nil
+	}
+}
+
+// WithIntegrityCheck verifies the range index when the database is opened and applies the
+// given policy if the index is inconsistent, see Verify and IntegrityReport.
+func WithIntegrityCheck(policy RecoveryPolicy) Option {
+	return func(o *options) error {
+		if policy < RecoverRefuse || policy > RecoverBackup {
+			return fmt.Errorf("invalid recovery policy: %d", policy)
+		}
+		o.integrityCheck = true
+		o.recovery = policy
+		return nil
+	}
+}
+
+// WithRecoveryBackup sets the archive that is restored by the RecoverBackup policy.
+// The archive is verified with the detached signature at path + ".sig" if WithTrustedKeys is set.
+func WithRecoveryBackup(path string) Option {
+	return func(o *options) error {
+		if path == "" {
+			return fmt.Errorf("recovery backup path must not be empty")
+		}
+		o.recoveryBackup = path
+		return nil
+	}
+}
+
+type MutationOption func(*mutationOptions)
+
+type mutationOptions struct {
+	actor   string
+	comment string
+}
+
+func newMutationOptions(opts []MutationOption) mutationOptions {
+	var mo mutationOptions
+	for _, o := range opts {
+		o(&mo)
+	}
+	return mo
+}
+
+// WithActor sets the actor that is recorded in the audit log.
+func WithActor(actor string) MutationOption {
+	return func(o *mutationOptions) {
+		o.actor = actor
+	}
+}
+
+// WithComment sets the comment that is recorded in the audit log.
+func WithComment(comment string) MutationOption {
+	return func(o *mutationOptions) {
+		o.comment = comment
+	}
+}
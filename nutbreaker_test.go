@@ -112,7 +112,7 @@ func TestInsert(t *testing.T) {
 			// consistency after every insert
 			for _, ipRange := range tt.ipRanges {
 				v := ipRange.Value()
-				err := ndb.Insert(ipRange.Range, v)
+				_, err := ndb.Insert(ipRange.Range, v)
 				require.Falsef((err != nil) != tt.wantErr,
 					"ndb.Insert() error = %v, wantErr %v, range passed: %q",
 					err,
@@ -149,7 +149,7 @@ func TestFind(t *testing.T) {
 				reasonToFind := []byte(rir.Reason)
 				rangeToFind := rir.Range
 
-				err := ndb.Insert(rangeToFind, reasonToFind)
+				_, err := ndb.Insert(rangeToFind, reasonToFind)
 				require.NoError(err,
 					"ndb.Insert(): range passed: %q",
 					rangeToFind,
@@ -193,7 +193,7 @@ func TestClientRemove(t *testing.T) {
 				reasonToFind := []byte(rir.Reason)
 				rangeToFind := rir.Range
 
-				err := ndb.Insert(rangeToFind, reasonToFind)
+				_, err := ndb.Insert(rangeToFind, reasonToFind)
 				require.NoError(err, "ndb.Insert() error")
 
 				require.NoErrorf(ndb.isConsistent(rangeToFind),
@@ -223,7 +223,8 @@ func TestClientRemove(t *testing.T) {
 				}
 
 				require.Equal(reasonToFind, got, "ndb.Find(), WRONG REASON")
-				require.NoError(ndb.Remove(rangeToFind))
+				_, err = ndb.Remove(rangeToFind)
+				require.NoError(err)
 				require.NoErrorf(ndb.isConsistent(),
 					"ndb.Remove() error : Database INCONSISTENT after removing range: %s",
 					rangeToFind,
@@ -0,0 +1,185 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// OperationKind describes what a planned operation does with a boundary.
+type OperationKind string
+
+const (
+	// OperationCreate creates a boundary that does not exist yet.
+	OperationCreate OperationKind = "create"
+	// OperationUpdate changes the bound flags or the value of an existing boundary.
+	OperationUpdate OperationKind = "update"
+	// OperationDelete deletes an existing boundary.
+	OperationDelete OperationKind = "delete"
+)
+
+// Boundary is the lower and/or upper end of a stored range.
+type Boundary struct {
+	IP    netip.Addr `json:"ip"`
+	Lower bool       `json:"lower"`
+	Upper bool       `json:"upper"`
+	Value []byte     `json:"value"`
+}
+
+func (b Boundary) String() string {
+	suf := "invalid"
+	if b.Lower && b.Upper {
+		suf = "db"
+	} else if b.Lower {
+		suf = "lb"
+	} else if b.Upper {
+		suf = "ub"
+	}
+	return fmt.Sprintf("%s:%s", b.IP, suf)
+}
+
+// Operation is a single boundary change that would be written by a mutation.
+// Before is nil for created boundaries, After is nil for deleted boundaries.
+type Operation struct {
+	Kind   OperationKind `json:"kind"`
+	Before *Boundary     `json:"before,omitempty"`
+	After  *Boundary     `json:"after,omitempty"`
+}
+
+// Plan describes the changes of a mutation without applying them.
+type Plan struct {
+	// Operations contains all boundary changes in ascending order.
+	Operations []Operation `json:"operations"`
+	// Ranges contains all ranges between the lowest and the highest changed boundary
+	// as they would be stored after the mutation.
+	Ranges []Range `json:"ranges"`
+	// Result lists all previously stored ranges whose value would change.
+	Result MutationResult `json:"result"`
+}
+
+// Changed returns true if the mutation would change any boundary.
+func (p Plan) Changed() bool {
+	return len(p.Operations) > 0
+}
+
+// PlanInsert runs the same logic as Insert against a read-only transaction
+// and returns the planned changes without committing anything.
+func (n *NutBreaker) PlanInsert(ipRange string, value []byte) (Plan, error) {
+	return n.plan(func(tx *Txn) (MutationResult, error) {
+		return n.insert(tx, ipRange, value)
+	})
+}
+
+// PlanRemove runs the same logic as Remove against a read-only transaction
+// and returns the planned changes without committing anything.
+func (n *NutBreaker) PlanRemove(ipRange string) (Plan, error) {
+	return n.plan(func(tx *Txn) (MutationResult, error) {
+		return n.remove(tx, ipRange)
+	})
+}
+
+func (n *NutBreaker) plan(mutate func(tx *Txn) (MutationResult, error)) (plan Plan, err error) {
+	err = n.db.View(func(tx *nutsdb.Tx) error {
+		// the changes are only staged and never committed,
+		// which is why the transaction may be treated as writable.
+		t := newTxn(n, tx, true)
+		result, err := mutate(t)
+		if err != nil {
+			return err
+		}
+
+		plan, err = t.plan()
+		if err != nil {
+			return err
+		}
+		plan.Result = result.clone()
+		return nil
+	})
+	if err != nil {
+		return Plan{}, err
+	}
+	return plan, nil
+}
+
+// plan returns the staged changes of t.
+// The returned values do not reference any memory of the underlying transaction.
+func (t *Txn) plan() (Plan, error) {
+	var plan Plan
+	for _, score := range t.scores {
+		p := t.pending[score]
+
+		old, err := t.stored(p.boundary)
+		if err != nil {
+			return Plan{}, err
+		}
+
+		var op Operation
+		if old != nil {
+			op.Before = &Boundary{
+				IP:    p.IP,
+				Lower: old.Low,
+				Upper: old.High,
+				Value: bytes.Clone(old.Value),
+			}
+		}
+		if !p.deleted {
+			op.After = &Boundary{
+				IP:    p.IP,
+				Lower: p.LowerBound,
+				Upper: p.UpperBound,
+				Value: bytes.Clone(p.Value),
+			}
+		}
+
+		switch {
+		case op.Before == nil && op.After == nil:
+			// created and deleted again
+			continue
+		case op.Before == nil:
+			op.Kind = OperationCreate
+		case op.After == nil:
+			op.Kind = OperationDelete
+		case op.Before.Lower == op.After.Lower &&
+			op.Before.Upper == op.After.Upper &&
+			bytes.Equal(op.Before.Value, op.After.Value):
+			continue
+		default:
+			op.Kind = OperationUpdate
+		}
+		plan.Operations = append(plan.Operations, op)
+	}
+
+	if len(plan.Operations) == 0 {
+		return plan, nil
+	}
+
+	first := plan.Operations[0]
+	last := plan.Operations[len(plan.Operations)-1]
+	low, err := newBoundary(first.ip(), true, true, nil)
+	if err != nil {
+		return Plan{}, err
+	}
+	high, err := newBoundary(last.ip(), true, true, nil)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	ranges, err := t.n.overlapping(t, low, high)
+	if err != nil {
+		return Plan{}, err
+	}
+	for _, r := range ranges {
+		r.Value = bytes.Clone(r.Value)
+		plan.Ranges = append(plan.Ranges, r)
+	}
+	return plan, nil
+}
+
+func (o Operation) ip() netip.Addr {
+	if o.After != nil {
+		return o.After.IP
+	}
+	return o.Before.IP
+}
@@ -0,0 +1,73 @@
+package nutbreaker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("10.0.0.0 - 10.0.0.100", []byte("spam"))
+	require.NoError(err)
+	before, err := ndb.getAll()
+	require.NoError(err)
+
+	plan, err := ndb.PlanInsert("10.0.0.10 - 10.0.0.20", []byte("vpn"))
+	require.NoError(err)
+	require.True(plan.Changed())
+
+	ops := make([]string, 0, len(plan.Operations))
+	for _, op := range plan.Operations {
+		require.NotNil(op.After)
+		require.Nil(op.Before)
+		require.Equal(OperationCreate, op.Kind)
+		ops = append(ops, op.After.String())
+	}
+	require.Equal([]string{
+		"10.0.0.9:ub",
+		"10.0.0.10:lb",
+		"10.0.0.20:ub",
+		"10.0.0.21:lb",
+	}, ops)
+
+	ranges := make([]string, 0, len(plan.Ranges))
+	for _, r := range plan.Ranges {
+		ranges = append(ranges, r.String()+" "+string(r.Value))
+	}
+	require.Equal([]string{
+		"10.0.0.0 - 10.0.0.9 spam",
+		"10.0.0.10 - 10.0.0.20 vpn",
+		"10.0.0.21 - 10.0.0.100 spam",
+	}, ranges)
+
+	require.Len(plan.Result.Segments, 1)
+	require.Equal(SegmentSplit, plan.Result.Segments[0].Kind)
+
+	plan, err = ndb.PlanRemove("10.0.0.0 - 10.0.0.50")
+	require.NoError(err)
+	require.Len(plan.Operations, 2)
+	require.Equal(OperationDelete, plan.Operations[0].Kind)
+	require.Equal("10.0.0.0:lb", plan.Operations[0].Before.String())
+	require.Equal(OperationCreate, plan.Operations[1].Kind)
+	require.Equal("10.0.0.51:lb", plan.Operations[1].After.String())
+	require.Len(plan.Ranges, 1)
+	require.Equal("10.0.0.51 - 10.0.0.100", plan.Ranges[0].String())
+
+	plan, err = ndb.PlanInsert("10.0.0.5", []byte("spam"))
+	require.NoError(err)
+	require.False(plan.Changed())
+	require.False(plan.Result.Changed())
+
+	_, err = ndb.PlanInsert("invalid", nil)
+	require.Error(err)
+
+	// nothing was committed
+	after, err := ndb.getAll()
+	require.NoError(err)
+	require.Equal(before, after)
+	consistent(t, ndb)
+}
@@ -0,0 +1,107 @@
+package nutbreaker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net/netip"
+)
+
+// Range is a contiguous IP range with its associated value.
+// Low and High are both inclusive.
+type Range struct {
+	Low   netip.Addr `json:"low"`
+	High  netip.Addr `json:"high"`
+	Value []byte     `json:"value"`
+}
+
+// String returns the range in the same notation that is accepted by Insert and Remove.
+func (r Range) String() string {
+	if r.Low == r.High {
+		return r.Low.String()
+	}
+	return fmt.Sprintf("%s - %s", r.Low, r.High)
+}
+
+// Contains returns true if ip is within the range.
+func (r Range) Contains(ip netip.Addr) bool {
+	return r.Low.Compare(ip) <= 0 && ip.Compare(r.High) <= 0
+}
+
+// Overlaps returns true if both ranges share at least one IP.
+func (r Range) Overlaps(other Range) bool {
+	return r.Low.Compare(other.High) <= 0 && other.Low.Compare(r.High) <= 0
+}
+
+// Prefixes returns the smallest list of CIDR prefixes that exactly covers the range.
+func (r Range) Prefixes() []netip.Prefix {
+	lo := addrToUint32(r.Low)
+	hi := addrToUint32(r.High)
+
+	var result []netip.Prefix
+	for lo <= hi {
+		size := bits.TrailingZeros32(lo) // 32 for lo == 0
+		for size > 0 && uint64(lo)+(uint64(1)<<size)-1 > uint64(hi) {
+			size--
+		}
+		result = append(result, netip.PrefixFrom(uint32ToAddr(lo), 32-size))
+
+		next := uint64(lo) + uint64(1)<<size
+		if next > uint64(hi) {
+			break
+		}
+		lo = uint32(next)
+	}
+	return result
+}
+
+func addrToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uint32ToAddr(ip uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], ip)
+	return netip.AddrFrom4(b)
+}
+
+// rangesFromBoundaries converts a sorted list of boundaries into ranges.
+// Infinity boundaries as well as upper boundaries without a preceding lower
+// boundary are skipped.
+func rangesFromBoundaries(bs []boundary) []Range {
+	result := make([]Range, 0, len(bs)/2+1)
+	var (
+		low  boundary
+		open bool
+	)
+	for _, b := range bs {
+		if b.IsInf() {
+			continue
+		}
+
+		switch {
+		case b.IsDoubleBound():
+			result = append(result, Range{
+				Low:   b.IP,
+				High:  b.IP,
+				Value: b.Value,
+			})
+			open = false
+		case b.IsLowerBound():
+			low = b
+			open = true
+		case b.IsUpperBound():
+			if !open {
+				continue
+			}
+			result = append(result, Range{
+				Low:   low.IP,
+				High:  b.IP,
+				Value: b.Value,
+			})
+			open = false
+		}
+	}
+	return result
+}
@@ -1,81 +1,391 @@
 package nutbreaker
 
 import (
+	"errors"
 	"fmt"
-
+	"math/bits"
 	"net/netip"
-
-	"github.com/xgfone/go-netaddr"
+	"strconv"
+	"strings"
 )
 
-func parseRange(r string, value []byte) (low, high boundary, err error) {
-	ip, err := netip.ParseAddr(r)
-	if err == nil {
-		if ip.Is6() {
-			return empty, empty, ErrIPv6NotSupported
-		}
+// ParseRange parses an IPv4 range in one of the following notations:
+//
+//	range    = spec [ "#" comment ]
+//	spec     = addr                    single address     1.2.3.4
+//	         | addr "/" length         CIDR, length 0-32  1.2.3.0/24
+//	         | addr "/" netmask        dotted netmask     1.2.3.0/255.255.255.0
+//	         | addr "-" addr           inclusive range    1.2.3.4 - 1.2.3.50
+//	         | addr "-" octet          short range        1.2.3.4-50
+//	         | wildcard                trailing octets    1.2.3.*, 1.2.*.*
+//	         | integer [ "-" integer ] decimal addresses  16909060-16909110
+//	addr     = dotted decimal IPv4 address without leading zeros
+//	wildcard = addr with the last n octets replaced by "*"
+//	integer  = decimal number from 0 to 4294967295
+//
+// A single integer is only accepted by ParseRangeStrict, as numbers like counters or
+// ports are common in the annotations of lists and would be imported as addresses.
+// Spaces are allowed around the spec and around "-". The comment is ignored.
+// Host bits of CIDRs and netmasks are cleared, the netmask must be contiguous.
+// Short ranges replace the last octet of the first address. The high address of
+// a range must not be smaller than its low address. IPv6 addresses are rejected
+// with ErrIPv6NotSupported, all other invalid input with ErrInvalidRange.
+//
+// Errors are of type *ParseError.
+//
+// For compatibility, input that does not match the grammar is accepted if it contains
+// a range "<IP> - <IP>" anywhere, see ParseRangeStrict.
+func ParseRange(s string) (Range, error) {
+	r, err := parseRangeSpec(s, false)
+	if err == nil || errors.Is(err, ErrIPv6NotSupported) {
+		return r, err
+	}
 
-		r, err := newBoundary(ip, true, true, value)
-		if err != nil {
-			return empty, empty, err
+	if matches := customIPRangeRegex.FindStringSubmatch(s); len(matches) == 3 {
+		low, lerr := netip.ParseAddr(matches[1])
+		high, herr := netip.ParseAddr(matches[2])
+		if lerr == nil && herr == nil && low.Is4() && high.Is4() && low.Compare(high) <= 0 {
+			return Range{Low: low, High: high}, nil
 		}
-		return r, r, nil
 	}
-	// parsing as IP failed
+	return Range{}, err
+}
 
-	net, err := netaddr.NewIPNetwork(r)
-	if err == nil {
-		fip := net.First().IP()
-		first, ok := netip.AddrFromSlice(fip)
-		if !ok {
-			return empty, empty, fmt.Errorf("%w: first ip: %s: %w", ErrInvalidRange, fip, err)
-		}
-		lip := net.Last().IP()
-		last, ok := netip.AddrFromSlice(lip)
-		if !ok {
-			return empty, empty, fmt.Errorf("%w: last ip: %s: %w", ErrInvalidRange, lip, err)
-		}
+// ParseRangeStrict parses a range like ParseRange, but rejects input that does not match
+// the grammar completely as well as CIDRs and netmasks with host bits set.
+func ParseRangeStrict(s string) (Range, error) {
+	return parseRangeSpec(s, true)
+}
 
-		low, err = newBoundary(first, true, false, value)
-		if err != nil {
-			return empty, empty, err
-		}
+func parseRange(s string, value []byte) (low, high boundary, err error) {
+	r, err := ParseRange(s)
+	if err != nil {
+		return empty, empty, err
+	}
 
-		high, err = newBoundary(last, false, true, value)
+	if r.Low == r.High {
+		b, err := newBoundary(r.Low, true, true, value)
 		if err != nil {
 			return empty, empty, err
 		}
-		return low, high, nil
+		return b, b, nil
+	}
 
+	low, err = newBoundary(r.Low, true, false, value)
+	if err != nil {
+		return empty, empty, err
+	}
+	high, err = newBoundary(r.High, false, true, value)
+	if err != nil {
+		return empty, empty, err
 	}
-	// parsing as cidr failed x.x.x.x/24
+	return low, high, nil
+}
 
-	if matches := customIPRangeRegex.FindStringSubmatch(r); len(matches) == 3 {
-		lowerBound := matches[1]
-		upperBound := matches[2]
+// ParseErrorKind classifies a ParseError.
+type ParseErrorKind int
 
-		lowIP, err := netip.ParseAddr(lowerBound)
-		if err != nil {
-			return empty, empty, fmt.Errorf("%w: %w", ErrInvalidRange, err)
-		}
-		highIP, err := netip.ParseAddr(upperBound)
-		if err != nil {
-			return empty, empty, fmt.Errorf("%w: %w", ErrInvalidRange, err)
+const (
+	// ParseErrSyntax is unexpected or missing input.
+	ParseErrSyntax ParseErrorKind = iota + 1
+	// ParseErrInvalidAddress is an invalid address, octet, netmask or prefix length.
+	ParseErrInvalidAddress
+	// ParseErrReversedRange is a range whose high address is smaller than its low address.
+	ParseErrReversedRange
+	// ParseErrIPv6 is an IPv6 address.
+	ParseErrIPv6
+	// ParseErrHostBits is a CIDR or netmask with host bits set in strict mode.
+	ParseErrHostBits
+)
+
+func (k ParseErrorKind) String() string {
+	switch k {
+	case ParseErrSyntax:
+		return "syntax error"
+	case ParseErrInvalidAddress:
+		return "invalid address"
+	case ParseErrReversedRange:
+		return "reversed range"
+	case ParseErrIPv6:
+		return "ipv6 address"
+	case ParseErrHostBits:
+		return "host bits set"
+	default:
+		return fmt.Sprintf("ParseErrorKind(%d)", int(k))
+	}
+}
+
+// ParseError is returned by ParseRange and ParseRangeStrict.
+// It matches ErrIPv6NotSupported for IPv6 addresses and ErrInvalidRange otherwise.
+type ParseError struct {
+	Input string
+	// Pos is the byte offset of the offending part of Input.
+	Pos  int
+	Kind ParseErrorKind
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %q at position %d: %s", e.Kind, e.Input, e.Pos, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	if e.Kind == ParseErrIPv6 {
+		return ErrIPv6NotSupported
+	}
+	return ErrInvalidRange
+}
+
+// rangeParser consumes the input of ParseRange from left to right.
+type rangeParser struct {
+	input  string
+	pos    int
+	strict bool
+}
+
+// parseRangeSpec parses s according to the grammar of ParseRange.
+func parseRangeSpec(s string, strict bool) (Range, error) {
+	p := &rangeParser{input: s, strict: strict}
+	p.skipSpace()
+
+	start := p.pos
+	first := p.word()
+	if first == "" {
+		return Range{}, p.fail(start, ParseErrSyntax, "missing address")
+	}
+
+	var (
+		r   Range
+		err error
+	)
+	switch {
+	case strings.Contains(first, ":"):
+		return Range{}, p.parseIPv6(start, first)
+	case strings.Contains(first, "*"):
+		r, err = p.parseWildcard(start, first)
+	case !strings.Contains(first, "."):
+		r, err = p.parseIntegers(start, first)
+	default:
+		r, err = p.parseAddr(start, first)
+	}
+	if err != nil {
+		return Range{}, err
+	}
+
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] != '#' {
+		return Range{}, p.fail(p.pos, ParseErrSyntax, fmt.Sprintf("unexpected %q", p.input[p.pos:]))
+	}
+	return r, nil
+}
+
+// parseAddr parses a range that starts with the address first at position start.
+func (p *rangeParser) parseAddr(start int, first string) (Range, error) {
+	low, err := p.parseIPv4(start, first)
+	if err != nil {
+		return Range{}, err
+	}
+
+	p.skipSpace()
+	switch {
+	case p.consume('/'):
+		return p.parseMask(start, low)
+	case p.consume('-'):
+		p.skipSpace()
+		pos := p.pos
+		second := p.word()
+		switch {
+		case second == "":
+			return Range{}, p.fail(pos, ParseErrSyntax, "missing high address")
+		case strings.Contains(second, ":"):
+			return Range{}, p.parseIPv6(pos, second)
+		case strings.Contains(second, "."):
+			high, err := p.parseIPv4(pos, second)
+			if err != nil {
+				return Range{}, err
+			}
+			return p.newRange(pos, low, high)
+		default:
+			octet, err := parseOctet(second)
+			if err != nil {
+				return Range{}, p.fail(pos, ParseErrInvalidAddress, fmt.Sprintf("invalid last octet %q", second))
+			}
+			high := low.As4()
+			high[3] = octet
+			return p.newRange(pos, low, netip.AddrFrom4(high))
 		}
+	default:
+		return Range{Low: low, High: low}, nil
+	}
+}
+
+// parseMask parses the prefix length or netmask of the network address addr at position start.
+func (p *rangeParser) parseMask(start int, addr netip.Addr) (Range, error) {
+	pos := p.pos
+	mask := p.word()
 
-		if lowIP.Compare(highIP) > 0 {
-			return empty, empty, fmt.Errorf("%w: first ip must be smaller than the second", ErrInvalidRange)
+	var length int
+	if strings.Contains(mask, ".") {
+		m, err := netip.ParseAddr(mask)
+		if err != nil || !m.Is4() {
+			return Range{}, p.fail(pos, ParseErrInvalidAddress, fmt.Sprintf("invalid netmask %q", mask))
+		}
+		ui32 := addrToUint32(m)
+		length = bits.LeadingZeros32(^ui32)
+		if ui32 != ^uint32(0)<<(32-length) {
+			return Range{}, p.fail(pos, ParseErrInvalidAddress, fmt.Sprintf("netmask %q is not contiguous", mask))
 		}
+	} else {
+		l, err := strconv.ParseUint(mask, 10, 8)
+		if err != nil || l > 32 {
+			return Range{}, p.fail(pos, ParseErrInvalidAddress, fmt.Sprintf("invalid prefix length %q", mask))
+		}
+		length = int(l)
+	}
 
-		low, err = newBoundary(lowIP, true, false, value)
-		if err != nil {
-			return empty, empty, err
+	prefix := netip.PrefixFrom(addr, length).Masked()
+	if p.strict && prefix.Addr() != addr {
+		return Range{}, p.fail(start, ParseErrHostBits, fmt.Sprintf("network address of %s is %s", addr, prefix.Addr()))
+	}
+	return Range{Low: prefix.Addr(), High: lastAddr(prefix)}, nil
+}
+
+// parseIntegers parses a single decimal address or a range of decimal addresses.
+func (p *rangeParser) parseIntegers(start int, first string) (Range, error) {
+	low, err := p.parseInteger(start, first)
+	if err != nil {
+		return Range{}, err
+	}
+
+	p.skipSpace()
+	if !p.consume('-') {
+		if !p.strict {
+			return Range{}, p.fail(start, ParseErrInvalidAddress, fmt.Sprintf("single decimal address %q requires strict parsing", first))
 		}
-		high, err = newBoundary(highIP, false, true, value)
-		if err != nil {
-			return empty, empty, err
+		return Range{Low: low, High: low}, nil
+	}
+	p.skipSpace()
+	pos := p.pos
+	high, err := p.parseInteger(pos, p.word())
+	if err != nil {
+		return Range{}, err
+	}
+	return p.newRange(pos, low, high)
+}
+
+// parseWildcard parses an address whose last octets are "*".
+func (p *rangeParser) parseWildcard(start int, s string) (Range, error) {
+	octets := strings.Split(s, ".")
+	if len(octets) != 4 {
+		return Range{}, p.fail(start, ParseErrInvalidAddress, "wildcard requires four octets")
+	}
+
+	var low, high [4]byte
+	wildcard := false
+	pos := start
+	for i, o := range octets {
+		switch {
+		case o == "*":
+			wildcard = true
+			low[i], high[i] = 0, 255
+		case wildcard:
+			return Range{}, p.fail(pos, ParseErrInvalidAddress, "only trailing octets can be wildcards")
+		default:
+			v, err := parseOctet(o)
+			if err != nil {
+				return Range{}, p.fail(pos, ParseErrInvalidAddress, fmt.Sprintf("invalid octet %q", o))
+			}
+			low[i], high[i] = v, v
 		}
-		return low, high, nil
+		pos += len(o) + 1
+	}
+	return Range{Low: netip.AddrFrom4(low), High: netip.AddrFrom4(high)}, nil
+}
+
+func (p *rangeParser) parseIPv4(pos int, s string) (netip.Addr, error) {
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, p.fail(pos, ParseErrInvalidAddress, err.Error())
+	}
+	if !ip.Is4() {
+		return netip.Addr{}, p.fail(pos, ParseErrIPv6, "IPv6 is not supported")
+	}
+	return ip, nil
+}
+
+// parseIPv6 returns an error of kind ParseErrIPv6 for valid IPv6 addresses.
+func (p *rangeParser) parseIPv6(pos int, s string) error {
+	_, err := netip.ParseAddr(s)
+	if err != nil {
+		return p.fail(pos, ParseErrInvalidAddress, err.Error())
 	}
-	return empty, empty, ErrInvalidRange
+	return p.fail(pos, ParseErrIPv6, "IPv6 is not supported")
+}
+
+func (p *rangeParser) parseInteger(pos int, s string) (netip.Addr, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return netip.Addr{}, p.fail(pos, ParseErrInvalidAddress, fmt.Sprintf("invalid decimal address %q", s))
+	}
+	return uint32ToAddr(uint32(v)), nil
+}
+
+// newRange validates the order of the addresses, pos is the position of the high address.
+func (p *rangeParser) newRange(pos int, low, high netip.Addr) (Range, error) {
+	if low.Compare(high) > 0 {
+		return Range{}, p.fail(pos, ParseErrReversedRange, fmt.Sprintf("%s is smaller than %s", high, low))
+	}
+	return Range{Low: low, High: high}, nil
+}
+
+// word returns the next run of characters that can be part of an address.
+func (p *rangeParser) word() string {
+	start := p.pos
+	for p.pos < len(p.input) && isAddrChar(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *rangeParser) consume(c byte) bool {
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *rangeParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *rangeParser) fail(pos int, kind ParseErrorKind, msg string) *ParseError {
+	return &ParseError{
+		Input: p.input,
+		Pos:   pos,
+		Kind:  kind,
+		Msg:   msg,
+	}
+}
+
+func isAddrChar(c byte) bool {
+	return c >= '0' && c <= '9' ||
+		c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c == '.' || c == ':' || c == '*'
+}
+
+func parseOctet(s string) (byte, error) {
+	if len(s) > 1 && s[0] == '0' {
+		return 0, strconv.ErrSyntax
+	}
+	v, err := strconv.ParseUint(s, 10, 8)
+	return byte(v), err
+}
+
+// lastAddr returns the last address of an IPv4 prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	return uint32ToAddr(addrToUint32(p.Addr()) | ^uint32(0)>>p.Bits())
 }
@@ -0,0 +1,149 @@
+package nutbreaker
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		low, high string
+		expected  []string
+	}{
+		{"1.2.3.4", "1.2.3.4", []string{"1.2.3.4/32"}},
+		{"10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.3", "10.0.0.10", []string{"10.0.0.3/32", "10.0.0.4/30", "10.0.0.8/31", "10.0.0.10/32"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"127.255.255.255", "128.0.0.0", []string{"127.255.255.255/32", "128.0.0.0/32"}},
+	}
+
+	for _, tt := range tests {
+		r := Range{Low: netip.MustParseAddr(tt.low), High: netip.MustParseAddr(tt.high)}
+		actual := make([]string, 0, len(tt.expected))
+		for _, p := range r.Prefixes() {
+			actual = append(actual, p.String())
+		}
+		require.Equal(t, tt.expected, actual, r.String())
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		err      error
+	}{
+		{"1.2.3.4", "1.2.3.4", nil},
+		{"  1.2.3.4  ", "1.2.3.4", nil},
+		{"1.2.3.0/24", "1.2.3.0 - 1.2.3.255", nil},
+		{"1.2.3.4/24", "1.2.3.0 - 1.2.3.255", nil},
+		{"0.0.0.0/0", "0.0.0.0 - 255.255.255.255", nil},
+		{"1.2.3.4/32", "1.2.3.4", nil},
+		{"1.2.3.0/255.255.255.0", "1.2.3.0 - 1.2.3.255", nil},
+		{"1.2.0.0/255.254.0.0", "1.2.0.0 - 1.3.255.255", nil},
+		{"1.2.3.4 - 1.2.3.50", "1.2.3.4 - 1.2.3.50", nil},
+		{"1.2.3.4-1.2.3.50", "1.2.3.4 - 1.2.3.50", nil},
+		{"1.2.3.4-50", "1.2.3.4 - 1.2.3.50", nil},
+		{"1.2.3.4 - 50", "1.2.3.4 - 1.2.3.50", nil},
+		{"1.2.3.*", "1.2.3.0 - 1.2.3.255", nil},
+		{"1.2.*.*", "1.2.0.0 - 1.2.255.255", nil},
+		{"*.*.*.*", "0.0.0.0 - 255.255.255.255", nil},
+		{"16909060-16909110", "1.2.3.4 - 1.2.3.54", nil},
+		{"0 - 4294967295", "0.0.0.0 - 255.255.255.255", nil},
+		{"1.2.3.4 # comment", "1.2.3.4", nil},
+		{"1.2.3.0/24# comment", "1.2.3.0 - 1.2.3.255", nil},
+		{"1.2.3.4-50 # short range", "1.2.3.4 - 1.2.3.50", nil},
+		// legacy: a range anywhere in the input
+		{"range 1.2.3.4 - 1.2.3.5 trailing", "1.2.3.4 - 1.2.3.5", nil},
+
+		{"", "", ErrInvalidRange},
+		{"# comment", "", ErrInvalidRange},
+		{"1.2.3", "", ErrInvalidRange},
+		{"1.2.3.256", "", ErrInvalidRange},
+		{"01.2.3.4", "", ErrInvalidRange},
+		{"1.2.3.4/33", "", ErrInvalidRange},
+		{"1.2.3.4/255.0.255.0", "", ErrInvalidRange},
+		{"1.2.3.50-4", "", ErrInvalidRange},
+		{"1.2.3.50 - 1.2.3.4", "", ErrInvalidRange},
+		{"1.2.3.4-256", "", ErrInvalidRange},
+		{"1.*.3.*", "", ErrInvalidRange},
+		{"1.2.*", "", ErrInvalidRange},
+		{"1.2.3.*/24", "", ErrInvalidRange},
+		{"4294967296", "", ErrInvalidRange},
+		{"16909060", "", ErrInvalidRange},
+		{"20-10", "", ErrInvalidRange},
+		{"1.2.3.4 foo", "", ErrInvalidRange},
+		{"::1", "", ErrIPv6NotSupported},
+		{"2001:db8::/32", "", ErrIPv6NotSupported},
+		{"1.2.3.4 - ::ffff:1.2.3.5", "", ErrIPv6NotSupported},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange(tt.input)
+		if tt.err != nil {
+			require.ErrorIs(t, err, tt.err, tt.input)
+			continue
+		}
+		require.NoError(t, err, tt.input)
+		require.Equal(t, tt.expected, r.String(), tt.input)
+	}
+}
+
+func TestParseRangeStrict(t *testing.T) {
+	tests := []struct {
+		input string
+		kind  ParseErrorKind
+		pos   int
+	}{
+		{"", ParseErrSyntax, 0},
+		{"garbage 1.2.3.4-1.2.3.5 trailing", ParseErrInvalidAddress, 0},
+		{"1.2.3.4-1.2.3.5 trailing", ParseErrSyntax, 16},
+		{"1.2.3.4 -", ParseErrSyntax, 9},
+		{"  1.2.3.256", ParseErrInvalidAddress, 2},
+		{"1.2.3.0/33", ParseErrInvalidAddress, 8},
+		{"1.2.3.0/255.0.255.0", ParseErrInvalidAddress, 8},
+		{"1.2.3.5/24", ParseErrHostBits, 0},
+		{"1.2.3.5/255.255.255.0", ParseErrHostBits, 0},
+		{"1.2.3.50 - 1.2.3.4", ParseErrReversedRange, 11},
+		{"1.2.3.50-4", ParseErrReversedRange, 9},
+		{"1.2.*.4", ParseErrInvalidAddress, 6},
+		{"::1", ParseErrIPv6, 0},
+		{"1.2.3.4 - ::ffff:1.2.3.5", ParseErrIPv6, 10},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseRangeStrict(tt.input)
+		var perr *ParseError
+		require.ErrorAs(t, err, &perr, tt.input)
+		require.Equal(t, tt.input, perr.Input)
+		require.Equal(t, tt.kind, perr.Kind, tt.input)
+		require.Equal(t, tt.pos, perr.Pos, tt.input)
+		if tt.kind == ParseErrIPv6 {
+			require.ErrorIs(t, err, ErrIPv6NotSupported)
+		} else {
+			require.ErrorIs(t, err, ErrInvalidRange)
+		}
+	}
+
+	r, err := ParseRangeStrict("1.2.3.0/24 # comment")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.0 - 1.2.3.255", r.String())
+
+	// single decimal addresses are only accepted in strict mode
+	r, err = ParseRangeStrict("16909060")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.4", r.String())
+
+	// the lenient parser clears host bits and accepts legacy input
+	r, err = ParseRange("1.2.3.5/24")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.0 - 1.2.3.255", r.String())
+	_, err = ParseRange("garbage 1.2.3.4-1.2.3.5 trailing")
+	require.NoError(t, err)
+
+	_, err = ParseRange("1.2.3.4 foo")
+	require.EqualError(t, err, `syntax error: "1.2.3.4 foo" at position 8: unexpected "foo"`)
+}
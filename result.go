@@ -0,0 +1,102 @@
+package nutbreaker
+
+import (
+	"bytes"
+)
+
+// SegmentKind describes how a previously stored range was affected by a mutation.
+type SegmentKind string
+
+const (
+	// SegmentOverwritten is a range that was completely replaced by an inserted range.
+	SegmentOverwritten SegmentKind = "overwritten"
+	// SegmentRemoved is a range that was completely removed.
+	SegmentRemoved SegmentKind = "removed"
+	// SegmentTruncated is a range that was partially replaced or removed at one of its ends.
+	SegmentTruncated SegmentKind = "truncated"
+	// SegmentSplit is a range that was split into two ranges, as its middle was replaced or removed.
+	SegmentSplit SegmentKind = "split"
+)
+
+// Segment is a previously stored range that was affected by a mutation.
+type Segment struct {
+	Kind SegmentKind `json:"kind"`
+	// Previous is the whole range including its value as it was stored before the mutation.
+	Previous Range `json:"previous"`
+	// Affected is the part of Previous that was replaced or removed.
+	Affected Range `json:"affected"`
+}
+
+// MutationResult describes the changes of an Insert or Remove.
+type MutationResult struct {
+	// Segments contains all previously stored ranges that were affected in ascending order.
+	// Ranges that have the same value as an inserted range are not listed, as their value did not change.
+	Segments []Segment `json:"segments"`
+}
+
+// Changed returns true if any previously stored range was replaced or removed.
+func (r MutationResult) Changed() bool {
+	return len(r.Segments) > 0
+}
+
+// clone returns a deep copy of r that does not reference the values of a transaction.
+func (r MutationResult) clone() MutationResult {
+	if r.Segments == nil {
+		return r
+	}
+	segments := make([]Segment, len(r.Segments))
+	for i, s := range r.Segments {
+		s.Previous.Value = bytes.Clone(s.Previous.Value)
+		s.Affected.Value = bytes.Clone(s.Affected.Value)
+		segments[i] = s
+	}
+	return MutationResult{Segments: segments}
+}
+
+// newMutationResult classifies the previous ranges that overlap with the mutated range.
+// The value of mutated is the inserted value and ignored for removals.
+func newMutationResult(previous []Range, mutated Range, remove bool) MutationResult {
+	var result MutationResult
+	for _, p := range previous {
+		if !p.Overlaps(mutated) {
+			continue
+		}
+		if !remove && bytes.Equal(p.Value, mutated.Value) {
+			continue
+		}
+
+		affected := Range{
+			Low:   p.Low,
+			High:  p.High,
+			Value: p.Value,
+		}
+		if affected.Low.Less(mutated.Low) {
+			affected.Low = mutated.Low
+		}
+		if mutated.High.Less(affected.High) {
+			affected.High = mutated.High
+		}
+
+		cutBelow := p.Low.Less(mutated.Low)
+		cutAbove := mutated.High.Less(p.High)
+
+		var kind SegmentKind
+		switch {
+		case cutBelow && cutAbove:
+			kind = SegmentSplit
+		case cutBelow || cutAbove:
+			kind = SegmentTruncated
+		case remove:
+			kind = SegmentRemoved
+		default:
+			kind = SegmentOverwritten
+		}
+
+		result.Segments = append(result.Segments, Segment{
+			Kind:     kind,
+			Previous: p,
+			Affected: affected,
+		})
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package nutbreaker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutationResult(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	result, err := ndb.Insert("10.0.0.0 - 10.0.0.100", []byte("spam"))
+	require.NoError(err)
+	require.False(result.Changed())
+
+	// same value is not listed
+	result, err = ndb.Insert("10.0.0.50 - 10.0.0.150", []byte("spam"))
+	require.NoError(err)
+	require.False(result.Changed())
+
+	result, err = ndb.Insert("10.0.0.10 - 10.0.0.20", []byte("vpn"))
+	require.NoError(err)
+	require.Len(result.Segments, 1)
+	require.Equal(SegmentSplit, result.Segments[0].Kind)
+	require.Equal("10.0.0.0 - 10.0.0.150", result.Segments[0].Previous.String())
+	require.Equal("10.0.0.10 - 10.0.0.20", result.Segments[0].Affected.String())
+	require.Equal([]byte("spam"), result.Segments[0].Affected.Value)
+
+	result, err = ndb.Insert("10.0.0.5 - 10.0.0.25", []byte("tor"))
+	require.NoError(err)
+	require.Len(result.Segments, 3)
+	require.Equal(SegmentTruncated, result.Segments[0].Kind)
+	require.Equal("10.0.0.5 - 10.0.0.9", result.Segments[0].Affected.String())
+	require.Equal(SegmentOverwritten, result.Segments[1].Kind)
+	require.Equal("10.0.0.10 - 10.0.0.20", result.Segments[1].Previous.String())
+	require.Equal([]byte("vpn"), result.Segments[1].Previous.Value)
+	require.Equal(SegmentTruncated, result.Segments[2].Kind)
+	require.Equal("10.0.0.21 - 10.0.0.25", result.Segments[2].Affected.String())
+
+	result, err = ndb.Remove("10.0.0.0 - 10.0.0.25")
+	require.NoError(err)
+	require.Len(result.Segments, 2)
+	require.Equal(SegmentRemoved, result.Segments[0].Kind)
+	require.Equal("10.0.0.0 - 10.0.0.4", result.Segments[0].Previous.String())
+	require.Equal(SegmentRemoved, result.Segments[1].Kind)
+	require.Equal("10.0.0.5 - 10.0.0.25", result.Segments[1].Previous.String())
+
+	// removing nothing
+	result, err = ndb.Remove("192.168.0.0/24")
+	require.NoError(err)
+	require.False(result.Changed())
+	consistent(t, ndb)
+}
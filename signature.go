@@ -0,0 +1,232 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// first field of a detached signature
+	signatureVersion = "nutbreaker-signature-v1"
+	// prepended to the digest of the signed input, so that signatures of lists cannot be reused
+	// for other purposes of the same key
+	signatureDomain = "nutbreaker signed list v1\n"
+)
+
+// Keyring is a set of trusted ed25519 public keys that are identified by a name.
+// A Keyring is safe for concurrent use.
+type Keyring struct {
+	mu   sync.RWMutex
+	keys map[string]ed25519.PublicKey
+}
+
+// NewKeyring returns an empty keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys: make(map[string]ed25519.PublicKey),
+	}
+}
+
+// ParseKeyring reads a keyring with one "<key id> <base64 public key>" pair per line.
+// Empty lines and lines starting with '#' are ignored.
+func ParseKeyring(r io.Reader) (*Keyring, error) {
+	k := NewKeyring()
+	err := scanLines(r, func(line int, text string) error {
+		text = strings.TrimSpace(text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			return nil
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return fmt.Errorf("line %d: expected key id and public key", line)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return fmt.Errorf("line %d: invalid public key: %w", line, err)
+		}
+		err = k.Add(fields[0], key)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+	return k, nil
+}
+
+// Add trusts key with the given id. Adding a different key with an existing id fails.
+func (k *Keyring) Add(id string, key ed25519.PublicKey) error {
+	if !validKeyID(id) {
+		return fmt.Errorf("invalid key id: %q", id)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key size of key %s: %d", id, len(key))
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if existing, ok := k.keys[id]; ok && !existing.Equal(key) {
+		return fmt.Errorf("key %s already exists", id)
+	}
+	k.keys[id] = bytes.Clone(key)
+	return nil
+}
+
+// Remove revokes the key with the given id.
+func (k *Keyring) Remove(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, id)
+}
+
+// IDs returns the sorted ids of all trusted keys.
+func (k *Keyring) IDs() []string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WriteTo writes the keyring in the format that is read by ParseKeyring.
+func (k *Keyring) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, id := range k.IDs() {
+		k.mu.RLock()
+		key, ok := k.keys[id]
+		k.mu.RUnlock()
+		if ok {
+			fmt.Fprintf(&buf, "%s %s\n", id, base64.StdEncoding.EncodeToString(key))
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// Verify checks the detached signature sig of data, which must be created by Sign
+// with one of the trusted keys.
+func (k *Keyring) Verify(data, sig []byte) error {
+	id, signature, err := parseSignature(sig)
+	if err != nil {
+		return err
+	}
+
+	k.mu.RLock()
+	key, ok := k.keys[id]
+	k.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUntrustedKey, id)
+	}
+
+	digest := sha256.Sum256(data)
+	if !ed25519.Verify(key, signedMessage(digest[:]), signature) {
+		return fmt.Errorf("%w: signature of key %s does not match", ErrInvalidSignature, id)
+	}
+	return nil
+}
+
+// Sign reads r completely and writes a detached signature of its content to w, which is verified
+// with the public key of key that is added as keyID to the keyring of the receiver.
+// The signature is a single line "nutbreaker-signature-v1 <key id> <base64 signature>".
+func Sign(w io.Writer, r io.Reader, keyID string, key ed25519.PrivateKey) error {
+	if !validKeyID(keyID) {
+		return fmt.Errorf("invalid key id: %q", keyID)
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid private key size: %d", len(key))
+	}
+
+	h := sha256.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return fmt.Errorf("failed to read signed input: %w", err)
+	}
+
+	signature := ed25519.Sign(key, signedMessage(h.Sum(nil)))
+	_, err = fmt.Fprintf(w, "%s %s %s\n", signatureVersion, keyID, base64.StdEncoding.EncodeToString(signature))
+	if err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+	return nil
+}
+
+func signedMessage(digest []byte) []byte {
+	return append([]byte(signatureDomain), digest...)
+}
+
+func validKeyID(id string) bool {
+	return id != "" && !strings.ContainsFunc(id, func(r rune) bool {
+		return r <= ' ' || r == 0x7f
+	})
+}
+
+// parseSignature parses a detached signature that was written by Sign.
+func parseSignature(sig []byte) (id string, signature []byte, err error) {
+	fields := strings.Fields(string(sig))
+	if len(fields) != 3 || fields[0] != signatureVersion {
+		return "", nil, fmt.Errorf("%w: expected %q followed by key id and signature", ErrInvalidSignature, signatureVersion)
+	}
+	signature, err = base64.StdEncoding.DecodeString(fields[2])
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return "", nil, fmt.Errorf("%w: malformed signature of key %s", ErrInvalidSignature, fields[1])
+	}
+	return fields[1], signature, nil
+}
+
+// WithSignature sets the detached signature of the imported input that was created by Sign.
+// The input is read completely and verified before anything is written.
+func WithSignature(sig []byte) ImportOption {
+	return func(o *importOptions) {
+		o.signature = sig
+	}
+}
+
+// WithKeyring requires a signature of one of the given keys for a single import, which takes
+// precedence over the keyring set with WithTrustedKeys.
+func WithKeyring(keyring *Keyring) ImportOption {
+	return func(o *importOptions) {
+		o.keyring = keyring
+	}
+}
+
+// verifiedInput returns r if no signature is required, otherwise the verified content of r.
+func (n *NutBreaker) verifiedInput(r io.Reader, opts []ImportOption) (io.Reader, error) {
+	o := newImportOptions(opts)
+	keyring := o.keyring
+	if keyring == nil {
+		keyring = n.keyring
+	}
+	if keyring == nil {
+		if o.signature != nil {
+			return nil, fmt.Errorf("%w: no trusted keys to verify the signature", ErrUntrustedKey)
+		}
+		return r, nil
+	}
+	if len(o.signature) == 0 {
+		return nil, ErrUnsigned
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed input: %w", err)
+	}
+	err = keyring.Verify(data, o.signature)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,231 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSigningKey(t *testing.T, keyring *Keyring, id string) ed25519.PrivateKey {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	if keyring != nil {
+		require.NoError(t, keyring.Add(id, public))
+	}
+	return private
+}
+
+func sign(t *testing.T, data, id string, key ed25519.PrivateKey) []byte {
+	var sig bytes.Buffer
+	require.NoError(t, Sign(&sig, strings.NewReader(data), id, key))
+	return sig.Bytes()
+}
+
+func TestSignedImport(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	keyring := NewKeyring()
+	publisher := newSigningKey(t, keyring, "publisher")
+	stranger := newSigningKey(t, nil, "publisher")
+
+	list := "10.0.0.0/24 # vpn\n10.0.1.1 # tor\n"
+	sig := sign(t, list, "publisher", publisher)
+	require.True(strings.HasPrefix(string(sig), "nutbreaker-signature-v1 publisher "))
+
+	tests := []struct {
+		name string
+		list string
+		opts []ImportOption
+		err  error
+	}{
+		{"unsigned", list, []ImportOption{WithKeyring(keyring)}, ErrUnsigned},
+		{"tampered", list + "0.0.0.0/0\n", []ImportOption{WithKeyring(keyring), WithSignature(sig)}, ErrInvalidSignature},
+		{"untrusted key", list, []ImportOption{WithKeyring(keyring), WithSignature(sign(t, list, "stranger", stranger))}, ErrUntrustedKey},
+		{"forged key id", list, []ImportOption{WithKeyring(keyring), WithSignature(sign(t, list, "publisher", stranger))}, ErrInvalidSignature},
+		{"malformed", list, []ImportOption{WithKeyring(keyring), WithSignature([]byte("garbage"))}, ErrInvalidSignature},
+		{"no keyring", list, []ImportOption{WithSignature(sig)}, ErrUntrustedKey},
+	}
+	for _, tc := range tests {
+		_, err := ndb.Import(strings.NewReader(tc.list), append(tc.opts, WithCommentValue())...)
+		require.ErrorIs(err, tc.err, tc.name)
+	}
+	requireRanges(t, ndb)
+
+	result, err := ndb.Import(strings.NewReader(list), WithKeyring(keyring), WithSignature(sig), WithCommentValue())
+	require.NoError(err)
+	require.Equal(2, result.Imported)
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 vpn", "10.0.1.1 tor")
+
+	// revoked keys are no longer trusted
+	keyring.Remove("publisher")
+	_, err = ndb.Import(strings.NewReader(list), WithKeyring(keyring), WithSignature(sig))
+	require.ErrorIs(err, ErrUntrustedKey)
+}
+
+func TestTrustedKeys(t *testing.T) {
+	require := require.New(t)
+
+	keyring := NewKeyring()
+	key := newSigningKey(t, keyring, "publisher")
+
+	dataDir := generateRandomDbDirName()
+	defer os.RemoveAll(dataDir)
+	ndb, err := NewNutBreaker(WithDir(dataDir), WithTrustedKeys(keyring))
+	require.NoError(err)
+	defer func() {
+		require.NoError(ndb.Close())
+	}()
+	require.NoError(ndb.Reset())
+
+	// every importer requires a signature
+	_, err = ndb.Import(strings.NewReader("10.0.0.1\n"))
+	require.ErrorIs(err, ErrUnsigned)
+	_, err = ndb.ImportJSONL(strings.NewReader(`{"low":"10.0.0.1","high":"10.0.0.1"}`))
+	require.ErrorIs(err, ErrUnsigned)
+	_, err = ndb.ImportSpamhaus(strings.NewReader("10.0.0.0/24 ; SBL1\n"))
+	require.ErrorIs(err, ErrUnsigned)
+	require.ErrorIs(ndb.Restore(strings.NewReader("")), ErrUnsigned)
+	requireRanges(t, ndb)
+
+	_, err = ndb.Insert("10.0.0.1", []byte("manual"))
+	require.NoError(err)
+	var archive bytes.Buffer
+	require.NoError(ndb.Backup(&archive))
+	sig := sign(t, archive.String(), "publisher", key)
+	_, err = ndb.Remove("10.0.0.1")
+	require.NoError(err)
+
+	corrupted := bytes.Clone(archive.Bytes())
+	corrupted[len(corrupted)-1] ^= 1
+	require.ErrorIs(ndb.Restore(bytes.NewReader(corrupted), WithSignature(sig)), ErrInvalidSignature)
+	requireRanges(t, ndb)
+
+	require.NoError(ndb.Restore(bytes.NewReader(archive.Bytes()), WithSignature(sig)))
+	requireRanges(t, ndb, "10.0.0.1 manual")
+}
+
+func TestSignedFileSource(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	keyring := NewKeyring()
+	key := newSigningKey(t, keyring, "publisher")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "blocklist.txt")
+	sigPath := path + ".sig"
+	mtime := time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)
+	writeSource(t, path, "10.0.0.1\n", &mtime)
+
+	w := ndb.NewFileWatcher()
+	report, err := w.Add(FileSource{
+		Name:          "blocklist",
+		Path:          path,
+		Options:       []ImportOption{WithKeyring(keyring), WithValue([]byte("x"))},
+		SignaturePath: sigPath,
+	})
+	require.NoError(err)
+	require.ErrorIs(report.Err, ErrUnsigned)
+	requireRanges(t, ndb)
+
+	// a new signature reloads the unchanged file
+	writeSource(t, sigPath, string(sign(t, "10.0.0.1\n", "publisher", key)), &mtime)
+	reports := w.Check()
+	require.Len(reports, 1)
+	require.NoError(reports[0].Err)
+	requireRanges(t, ndb, "10.0.0.1 x")
+
+	// the last good list is kept if the file does not match its signature
+	writeSource(t, path, "0.0.0.0/0\n", &mtime)
+	reports = w.Check()
+	require.Len(reports, 1)
+	require.ErrorIs(reports[0].Err, ErrInvalidSignature)
+	requireRanges(t, ndb, "10.0.0.1 x")
+}
+
+func TestSignedFeed(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	keyring := NewKeyring()
+	key := newSigningKey(t, keyring, "publisher")
+
+	list := &feedServer{}
+	list.set("10.0.0.1\n", `"v1"`, time.Time{})
+	sig := &feedServer{}
+	sig.set(string(sign(t, "10.0.0.1\n", "publisher", key)), "", time.Time{})
+
+	mux := http.NewServeMux()
+	mux.Handle("/list.txt", list)
+	mux.Handle("/list.txt.sig", sig)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	m := ndb.NewFeedManager()
+	require.NoError(m.Add(Feed{
+		Name:         "feed",
+		URL:          ts.URL + "/list.txt",
+		Options:      []ImportOption{WithKeyring(keyring), WithValue([]byte("x"))},
+		SignatureURL: ts.URL + "/list.txt.sig",
+	}))
+
+	report, err := m.Fetch(context.Background(), "feed")
+	require.NoError(err)
+	require.NoError(report.Err)
+	requireRanges(t, ndb, "10.0.0.1 x")
+
+	list.set("0.0.0.0/0\n", `"v2"`, time.Time{})
+	report, err = m.Fetch(context.Background(), "feed")
+	require.NoError(err)
+	require.ErrorIs(report.Err, ErrInvalidSignature)
+
+	sig.fail(http.StatusNotFound)
+	report, err = m.Fetch(context.Background(), "feed")
+	require.NoError(err)
+	require.Error(report.Err)
+	requireRanges(t, ndb, "10.0.0.1 x")
+}
+
+func TestKeyring(t *testing.T) {
+	require := require.New(t)
+
+	keyring := NewKeyring()
+	newSigningKey(t, keyring, "b")
+	newSigningKey(t, keyring, "a")
+	require.Error(keyring.Add("a", make(ed25519.PublicKey, ed25519.PublicKeySize)))
+	require.Error(keyring.Add("with space", make(ed25519.PublicKey, ed25519.PublicKeySize)))
+	require.Error(keyring.Add("c", []byte{1, 2, 3}))
+
+	var buf bytes.Buffer
+	_, err := keyring.WriteTo(&buf)
+	require.NoError(err)
+	require.Equal(2, strings.Count(buf.String(), "\n"))
+	require.True(strings.HasPrefix(buf.String(), "a "))
+
+	parsed, err := ParseKeyring(strings.NewReader("# trusted publishers\n\n" + buf.String()))
+	require.NoError(err)
+	require.Equal([]string{"a", "b"}, parsed.IDs())
+
+	var written bytes.Buffer
+	_, err = parsed.WriteTo(&written)
+	require.NoError(err)
+	require.Equal(buf.String(), written.String())
+
+	_, err = ParseKeyring(strings.NewReader("a not-base64!\n"))
+	require.Error(err)
+	_, err = ParseKeyring(strings.NewReader("a\n"))
+	require.Error(err)
+}
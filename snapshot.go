@@ -0,0 +1,461 @@
+package nutbreaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// maximum number of boundaries per stored snapshot chunk,
+// which keeps every chunk well below the nutsdb segment size.
+const snapshotChunkSize = 4096
+
+var (
+	snapshotHeadKey    = []byte("head")
+	snapshotMetaPrefix = "snapshot:"
+	snapshotDataPrefix = "delta:"
+)
+
+// SnapshotInfo describes a named snapshot.
+type SnapshotInfo struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	// Ranges is the number of ranges that the snapshot contains.
+	Ranges int `json:"ranges"`
+}
+
+// snapshotMeta is stored for every snapshot.
+// Snapshots form a chain in which every snapshot only stores the delta to its parent,
+// which is the snapshot that was created right before it.
+type snapshotMeta struct {
+	SnapshotInfo
+	Parent string `json:"parent,omitempty"`
+	Chunks int    `json:"chunks"`
+}
+
+// snapshotBoundary is the compact representation of a stored boundary.
+type snapshotBoundary struct {
+	IP    uint32 `json:"ip"`
+	Low   bool   `json:"low,omitempty"`
+	High  bool   `json:"high,omitempty"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// boundaryDelta transforms one boundary state into another one.
+type boundaryDelta struct {
+	Set []snapshotBoundary `json:"set,omitempty"`
+	Del []uint32           `json:"del,omitempty"`
+}
+
+// boundaryState contains all boundaries except for the infinity boundaries indexed by their IP.
+type boundaryState map[uint32]dbValue
+
+func newBoundaryState(bs []boundary) boundaryState {
+	state := make(boundaryState, len(bs))
+	for _, b := range bs {
+		if b.IsInf() {
+			continue
+		}
+		state[uint32(b.Score)] = b.ToDBValue()
+	}
+	return state
+}
+
+// boundaries returns the sorted boundaries of the state.
+func (s boundaryState) boundaries() ([]boundary, error) {
+	result := make([]boundary, 0, len(s))
+	for ip, v := range s {
+		b, err := newBoundaryFloat64(float64(ip), v.Low, v.High, v.Value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	sort.Sort(byIP(result))
+	return result, nil
+}
+
+func (s boundaryState) apply(d boundaryDelta) {
+	for _, ip := range d.Del {
+		delete(s, ip)
+	}
+	for _, b := range d.Set {
+		s[b.IP] = dbValue{Low: b.Low, High: b.High, Value: b.Value}
+	}
+}
+
+// diffStates returns the delta that transforms from into to.
+func diffStates(from, to boundaryState) boundaryDelta {
+	var d boundaryDelta
+	for ip, v := range to {
+		old, ok := from[ip]
+		if ok && old.Low == v.Low && old.High == v.High && string(old.Value) == string(v.Value) {
+			continue
+		}
+		d.Set = append(d.Set, snapshotBoundary{IP: ip, Low: v.Low, High: v.High, Value: v.Value})
+	}
+	for ip := range from {
+		if _, ok := to[ip]; !ok {
+			d.Del = append(d.Del, ip)
+		}
+	}
+	sort.Slice(d.Set, func(i, j int) bool { return d.Set[i].IP < d.Set[j].IP })
+	sort.Slice(d.Del, func(i, j int) bool { return d.Del[i] < d.Del[j] })
+	return d
+}
+
+// composeDeltas returns a single delta that has the same effect as applying first and then second.
+func composeDeltas(first, second boundaryDelta) boundaryDelta {
+	set := make(map[uint32]snapshotBoundary, len(first.Set)+len(second.Set))
+	del := make(map[uint32]bool, len(first.Del)+len(second.Del))
+	for _, ip := range first.Del {
+		del[ip] = true
+	}
+	for _, b := range first.Set {
+		set[b.IP] = b
+	}
+	for _, ip := range second.Del {
+		delete(set, ip)
+		del[ip] = true
+	}
+	for _, b := range second.Set {
+		set[b.IP] = b
+		delete(del, b.IP)
+	}
+
+	var d boundaryDelta
+	for _, b := range set {
+		d.Set = append(d.Set, b)
+	}
+	for ip := range del {
+		d.Del = append(d.Del, ip)
+	}
+	sort.Slice(d.Set, func(i, j int) bool { return d.Set[i].IP < d.Set[j].IP })
+	sort.Slice(d.Del, func(i, j int) bool { return d.Del[i] < d.Del[j] })
+	return d
+}
+
+// Snapshot captures the current state of the list under the given name.
+// Only the changes since the previously created snapshot are stored.
+func (n *NutBreaker) Snapshot(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: empty snapshot name", ErrInvalidSnapshotName)
+	}
+
+	return n.Update(func(tx *Txn) error {
+		_, err := n.snapshotMeta(tx.tx, name)
+		if err == nil {
+			return fmt.Errorf("%w: %s", ErrSnapshotExists, name)
+		}
+		if !errors.Is(err, ErrSnapshotNotFound) {
+			return err
+		}
+
+		all, err := n.all(tx)
+		if err != nil {
+			return err
+		}
+		current := newBoundaryState(all)
+
+		parent, err := n.snapshotHead(tx.tx)
+		if err != nil {
+			return err
+		}
+
+		parentState := boundaryState{}
+		if parent != "" {
+			parentState, err = n.snapshotState(tx.tx, parent)
+			if err != nil {
+				return err
+			}
+		}
+
+		meta := snapshotMeta{
+			SnapshotInfo: SnapshotInfo{
+				Name:    name,
+				Created: n.now(),
+				Ranges:  len(rangesFromBoundaries(all)),
+			},
+			Parent: parent,
+		}
+		err = n.putSnapshot(tx.tx, meta, 0, diffStates(parentState, current))
+		if err != nil {
+			return err
+		}
+
+		return tx.tx.Put(n.snapshotBucket, snapshotHeadKey, []byte(name), 0)
+	})
+}
+
+// ListSnapshots returns all snapshots ordered by their creation time.
+func (n *NutBreaker) ListSnapshots() ([]SnapshotInfo, error) {
+	var result []SnapshotInfo
+	err := n.db.View(func(tx *nutsdb.Tx) error {
+		metas, err := n.snapshotMetas(tx)
+		if err != nil {
+			return err
+		}
+		result = make([]SnapshotInfo, 0, len(metas))
+		for _, m := range metas {
+			result = append(result, m.SnapshotInfo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RestoreSnapshot atomically replaces the current state of the list with the state of the snapshot.
+func (n *NutBreaker) RestoreSnapshot(name string) error {
+	return n.Update(func(tx *Txn) error {
+		target, err := n.snapshotState(tx.tx, name)
+		if err != nil {
+			return err
+		}
+		if n.audit {
+			tx.audit = append(tx.audit, n.bulkAuditEntry(AuditRestoreSnapshot, name, nil))
+		}
+		return n.applyState(tx, target)
+	})
+}
+
+// DeleteSnapshot deletes the snapshot. The changes that it contains are merged
+// into the snapshot that was created after it.
+func (n *NutBreaker) DeleteSnapshot(name string) error {
+	return n.Update(func(tx *Txn) error {
+		meta, err := n.snapshotMeta(tx.tx, name)
+		if err != nil {
+			return err
+		}
+
+		metas, err := n.snapshotMetas(tx.tx)
+		if err != nil {
+			return err
+		}
+
+		delta, err := n.snapshotDelta(tx.tx, meta)
+		if err != nil {
+			return err
+		}
+
+		isHead := true
+		for _, child := range metas {
+			if child.Parent != name {
+				continue
+			}
+			isHead = false
+
+			childDelta, err := n.snapshotDelta(tx.tx, child)
+			if err != nil {
+				return err
+			}
+
+			oldChunks := child.Chunks
+			child.Parent = meta.Parent
+			err = n.putSnapshot(tx.tx, child, oldChunks, composeDeltas(delta, childDelta))
+			if err != nil {
+				return err
+			}
+		}
+
+		if isHead {
+			if meta.Parent == "" {
+				err = tx.tx.Delete(n.snapshotBucket, snapshotHeadKey)
+			} else {
+				err = tx.tx.Put(n.snapshotBucket, snapshotHeadKey, []byte(meta.Parent), 0)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		for i := 0; i < meta.Chunks; i++ {
+			err = tx.tx.Delete(n.snapshotBucket, snapshotChunkKey(name, i))
+			if err != nil {
+				return fmt.Errorf("failed to delete snapshot chunk: %w", err)
+			}
+		}
+		return tx.tx.Delete(n.snapshotBucket, snapshotMetaKey(name))
+	})
+}
+
+// applyState stages all changes that are needed in order to transform the current state into target.
+func (n *NutBreaker) applyState(tx *Txn, target boundaryState) error {
+	all, err := n.all(tx)
+	if err != nil {
+		return err
+	}
+
+	delta := diffStates(newBoundaryState(all), target)
+	for _, ip := range delta.Del {
+		b, err := newBoundaryFloat64(float64(ip), true, true, nil)
+		if err != nil {
+			return err
+		}
+		err = tx.delete(b)
+		if err != nil {
+			return err
+		}
+	}
+	for _, sb := range delta.Set {
+		b, err := newBoundaryFloat64(float64(sb.IP), sb.Low, sb.High, sb.Value)
+		if err != nil {
+			return err
+		}
+		err = tx.insert(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func snapshotMetaKey(name string) []byte {
+	return []byte(snapshotMetaPrefix + name)
+}
+
+func snapshotChunkKey(name string, idx int) []byte {
+	return []byte(fmt.Sprintf("%s%s:%08d", snapshotDataPrefix, name, idx))
+}
+
+func (n *NutBreaker) snapshotHead(tx *nutsdb.Tx) (string, error) {
+	head, err := tx.Get(n.snapshotBucket, snapshotHeadKey)
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrNotFoundKey) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get latest snapshot: %w", err)
+	}
+	return string(head), nil
+}
+
+func (n *NutBreaker) snapshotMeta(tx *nutsdb.Tx, name string) (snapshotMeta, error) {
+	data, err := tx.Get(n.snapshotBucket, snapshotMetaKey(name))
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrNotFoundKey) {
+			return snapshotMeta{}, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+		}
+		return snapshotMeta{}, fmt.Errorf("failed to get snapshot %s: %w", name, err)
+	}
+
+	var meta snapshotMeta
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		return snapshotMeta{}, fmt.Errorf("failed to decode snapshot %s: %w", name, err)
+	}
+	return meta, nil
+}
+
+// snapshotMetas returns all snapshots ordered by their creation time.
+func (n *NutBreaker) snapshotMetas(tx *nutsdb.Tx) ([]snapshotMeta, error) {
+	values, err := tx.PrefixScan(n.snapshotBucket, []byte(snapshotMetaPrefix), 0, nutsdb.ScanNoLimit)
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrPrefixScan) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	metas := make([]snapshotMeta, 0, len(values))
+	for _, v := range values {
+		var meta snapshotMeta
+		err = json.Unmarshal(v, &meta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+		}
+		metas = append(metas, meta)
+	}
+	sort.SliceStable(metas, func(i, j int) bool {
+		return metas[i].Created.Before(metas[j].Created)
+	})
+	return metas, nil
+}
+
+func (n *NutBreaker) snapshotDelta(tx *nutsdb.Tx, meta snapshotMeta) (boundaryDelta, error) {
+	var result boundaryDelta
+	for i := 0; i < meta.Chunks; i++ {
+		data, err := tx.Get(n.snapshotBucket, snapshotChunkKey(meta.Name, i))
+		if err != nil {
+			return boundaryDelta{}, fmt.Errorf("failed to get snapshot %s chunk %d: %w", meta.Name, i, err)
+		}
+		var d boundaryDelta
+		err = json.Unmarshal(data, &d)
+		if err != nil {
+			return boundaryDelta{}, fmt.Errorf("failed to decode snapshot %s chunk %d: %w", meta.Name, i, err)
+		}
+		result.Set = append(result.Set, d.Set...)
+		result.Del = append(result.Del, d.Del...)
+	}
+	return result, nil
+}
+
+// snapshotState reconstructs the full state of a snapshot by applying all deltas of its chain.
+func (n *NutBreaker) snapshotState(tx *nutsdb.Tx, name string) (boundaryState, error) {
+	var chain []snapshotMeta
+	for name != "" {
+		meta, err := n.snapshotMeta(tx, name)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, meta)
+		name = meta.Parent
+	}
+
+	state := boundaryState{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		delta, err := n.snapshotDelta(tx, chain[i])
+		if err != nil {
+			return nil, err
+		}
+		state.apply(delta)
+	}
+	return state, nil
+}
+
+// putSnapshot writes the snapshot meta data and its delta in chunks.
+// Chunks of a previous version of the snapshot beyond the new chunk count are deleted.
+func (n *NutBreaker) putSnapshot(tx *nutsdb.Tx, meta snapshotMeta, oldChunks int, delta boundaryDelta) error {
+	var chunks []boundaryDelta
+	for len(delta.Set) > 0 || len(delta.Del) > 0 {
+		var chunk boundaryDelta
+		num := min(len(delta.Set), snapshotChunkSize)
+		chunk.Set, delta.Set = delta.Set[:num], delta.Set[num:]
+		num = min(len(delta.Del), snapshotChunkSize-num)
+		chunk.Del, delta.Del = delta.Del[:num], delta.Del[num:]
+		chunks = append(chunks, chunk)
+	}
+
+	for i, chunk := range chunks {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to encode snapshot %s chunk %d: %w", meta.Name, i, err)
+		}
+		err = tx.Put(n.snapshotBucket, snapshotChunkKey(meta.Name, i), data, 0)
+		if err != nil {
+			return fmt.Errorf("failed to write snapshot %s chunk %d: %w", meta.Name, i, err)
+		}
+	}
+	for i := len(chunks); i < oldChunks; i++ {
+		err := tx.Delete(n.snapshotBucket, snapshotChunkKey(meta.Name, i))
+		if err != nil {
+			return fmt.Errorf("failed to delete snapshot %s chunk %d: %w", meta.Name, i, err)
+		}
+	}
+
+	meta.Chunks = len(chunks)
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot %s: %w", meta.Name, err)
+	}
+	err = tx.Put(n.snapshotBucket, snapshotMetaKey(meta.Name), data, 0)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot %s: %w", meta.Name, err)
+	}
+	return nil
+}
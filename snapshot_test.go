@@ -0,0 +1,132 @@
+package nutbreaker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	now := time.Now()
+	ndb.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	insert(t, ndb, false,
+		"10.0.0.0/24",
+		"10.0.1.0 - 10.0.1.10",
+		"10.0.2.1",
+	)
+	first, err := ndb.getAll()
+	require.NoError(err)
+	require.NoError(ndb.Snapshot("first"))
+
+	_, err = ndb.Insert("10.0.0.128/25", []byte("changed"))
+	require.NoError(err)
+	_, err = ndb.Remove("10.0.2.1")
+	require.NoError(err)
+	second, err := ndb.getAll()
+	require.NoError(err)
+	require.NoError(ndb.Snapshot("second"))
+
+	// bad import
+	_, err = ndb.Remove("0.0.0.0/0")
+	require.NoError(err)
+	equal(t, ndb, negInfBoundary, posInfBoundary)
+
+	require.NoError(ndb.RestoreSnapshot("first"))
+	equal(t, ndb, first...)
+	consistent(t, ndb)
+
+	require.NoError(ndb.RestoreSnapshot("second"))
+	equal(t, ndb, second...)
+	consistent(t, ndb)
+
+	infos, err := ndb.ListSnapshots()
+	require.NoError(err)
+	require.Len(infos, 2)
+	require.Equal("first", infos[0].Name)
+	require.Equal(3, infos[0].Ranges)
+	require.Equal("second", infos[1].Name)
+	require.Equal(3, infos[1].Ranges)
+
+	// the second snapshot only stores the changes since the first one
+	var (
+		meta  snapshotMeta
+		delta boundaryDelta
+	)
+	err = ndb.db.View(func(tx *nutsdb.Tx) (err error) {
+		meta, err = ndb.snapshotMeta(tx, "second")
+		if err != nil {
+			return err
+		}
+		delta, err = ndb.snapshotDelta(tx, meta)
+		return err
+	})
+	require.NoError(err)
+	require.Equal("first", meta.Parent)
+	require.Len(delta.Set, 3) // 10.0.0.127:ub 10.0.0.128:lb 10.0.0.255:ub
+	require.Len(delta.Del, 1) // 10.0.2.1:db
+
+	// deleting the parent merges its changes into the second snapshot
+	require.NoError(ndb.DeleteSnapshot("first"))
+	_, err = ndb.Remove("0.0.0.0/0")
+	require.NoError(err)
+	require.NoError(ndb.RestoreSnapshot("second"))
+	equal(t, ndb, second...)
+
+	require.ErrorIs(ndb.RestoreSnapshot("first"), ErrSnapshotNotFound)
+	require.ErrorIs(ndb.DeleteSnapshot("first"), ErrSnapshotNotFound)
+	require.ErrorIs(ndb.Snapshot("second"), ErrSnapshotExists)
+	require.ErrorIs(ndb.Snapshot(""), ErrInvalidSnapshotName)
+
+	// deleting the latest snapshot makes its parent the base of the next snapshot
+	require.NoError(ndb.DeleteSnapshot("second"))
+	require.NoError(ndb.Snapshot("third"))
+	infos, err = ndb.ListSnapshots()
+	require.NoError(err)
+	require.Len(infos, 1)
+	require.Equal("third", infos[0].Name)
+}
+
+func TestSnapshotChunks(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	const num = snapshotChunkSize + 10
+	err := ndb.Update(func(tx *Txn) error {
+		for i := 0; i < num; i++ {
+			_, err := tx.Insert(fmt.Sprintf("10.%d.%d.1", i/256, i%256), []byte("value"))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(err)
+	expected, err := ndb.getAll()
+	require.NoError(err)
+
+	require.NoError(ndb.Snapshot("big"))
+	_, err = ndb.Remove("0.0.0.0/0")
+	require.NoError(err)
+	require.NoError(ndb.RestoreSnapshot("big"))
+	equal(t, ndb, expected...)
+
+	var meta snapshotMeta
+	err = ndb.db.View(func(tx *nutsdb.Tx) (err error) {
+		meta, err = ndb.snapshotMeta(tx, "big")
+		return err
+	})
+	require.NoError(err)
+	require.Equal(2, meta.Chunks)
+}
@@ -0,0 +1,502 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// maximum number of records per stored source state chunk,
+// which keeps every chunk well below the nutsdb segment size.
+const sourceChunkSize = 4096
+
+var (
+	sourceStatePrefix = "source:"
+	sourceDataPrefix  = "source-data:"
+)
+
+// kinds of sources, the state of a source is stored per kind and name
+const (
+	sourceKindFile = "file"
+	sourceKindFeed = "feed"
+)
+
+// ImportFunc parses a list in a specific format, e.g. (*NutBreaker).ImportFireHOL.
+type ImportFunc func(n *NutBreaker, r io.Reader, opts ...ImportOption) (ImportResult, error)
+
+// FileSource is a list that is maintained as a file.
+type FileSource struct {
+	// Name identifies the list. The metadata of the list is stored with this name.
+	Name string
+	Path string
+	// Import parses the file, defaults to (*NutBreaker).Import.
+	Import ImportFunc
+	// Options are passed to Import, e.g. WithValue.
+	Options []ImportOption
+	// SignaturePath is the path of the detached signature of the file, see Sign and WithSignature.
+	SignaturePath string
+}
+
+// SourceReport describes a reload of a file source or a fetch of a feed.
+type SourceReport struct {
+	Name string
+	// Path is the path of a file source or the URL of a feed.
+	Path string
+	Time time.Time
+	// Hash is the hex encoded SHA-256 of the file.
+	Hash   string
+	Result ImportResult
+	// Added and Removed are the number of list entries that were added and removed.
+	Added   int
+	Removed int
+	// NotModified is set if a feed did not change since it was fetched the last time.
+	NotModified bool
+	// Err is set if the file could not be read or parsed. The last good state of the list is kept.
+	Err error
+}
+
+// sourceState is stored for every file source or feed and describes the last loaded list.
+type sourceState struct {
+	Hash    string `json:"hash"`
+	Entries int    `json:"entries"`
+	Chunks  int    `json:"chunks"`
+
+	// last loaded file of a file source
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size,omitempty"`
+
+	// cache validators of the last loaded response of a feed
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// sourceRecord is a list entry of the last loaded file.
+type sourceRecord struct {
+	Range string `json:"range"`
+	Value []byte `json:"value,omitempty"`
+}
+
+func (r sourceRecord) key() string {
+	return r.Range + "\x00" + string(r.Value)
+}
+
+// FileWatcher polls the files of registered sources and replaces the content of a list
+// whenever its file changes. Lists should not overlap with ranges of other lists or ranges
+// that are inserted otherwise, as an entry that is removed from a file is removed completely.
+type FileWatcher struct {
+	n       *NutBreaker
+	mu      sync.Mutex
+	sources map[string]*watchedSource
+}
+
+type watchedSource struct {
+	FileSource
+	// last seen file, which is the last good one or a file that failed to parse
+	modTime time.Time
+	size    int64
+	// last seen signature file
+	sigModTime time.Time
+	sigSize    int64
+	// hash of the last good file
+	hash string
+}
+
+// NewFileWatcher returns a watcher without sources.
+func (n *NutBreaker) NewFileWatcher() *FileWatcher {
+	return &FileWatcher{
+		n:       n,
+		sources: make(map[string]*watchedSource),
+	}
+}
+
+// Add registers a source and loads its file unless the file was already loaded before,
+// e.g. before a restart. The returned report is nil if the file did not change.
+func (w *FileWatcher) Add(src FileSource) (*SourceReport, error) {
+	if src.Name == "" || src.Path == "" {
+		return nil, errors.New("file source without name or path")
+	}
+	if src.Import == nil {
+		src.Import = (*NutBreaker).Import
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.sources[src.Name]; ok {
+		return nil, fmt.Errorf("file source %s already exists", src.Name)
+	}
+
+	var state sourceState
+	err := w.n.db.View(func(tx *nutsdb.Tx) (err error) {
+		state, err = w.n.sourceState(tx, sourceKindFile, src.Name)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &watchedSource{
+		FileSource: src,
+		modTime:    state.ModTime,
+		size:       state.Size,
+		sigSize:    -1,
+		hash:       state.Hash,
+	}
+	w.sources[src.Name] = s
+	return w.reload(s, false), nil
+}
+
+// Remove stops watching the source with the given name. The ranges of the list are kept.
+func (w *FileWatcher) Remove(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.sources, name)
+}
+
+// Check polls all files and reloads every changed file. A file is changed if its modification time
+// or size changed and its content differs from the last loaded one.
+// Returns a report for every reloaded file, sorted by the name of the source.
+func (w *FileWatcher) Check() []SourceReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names := make([]string, 0, len(w.sources))
+	for name := range w.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var reports []SourceReport
+	for _, name := range names {
+		if report := w.reload(w.sources[name], false); report != nil {
+			reports = append(reports, *report)
+		}
+	}
+	return reports
+}
+
+// Metadata returns the metadata of the list of the file source with the given name.
+func (w *FileWatcher) Metadata(name string) (ListMetadata, error) {
+	return w.n.metadata(sourceKindFile, name)
+}
+
+// Reload reloads the file of the source with the given name even if it did not change.
+func (w *FileWatcher) Reload(name string) (SourceReport, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s, ok := w.sources[name]
+	if !ok {
+		return SourceReport{}, fmt.Errorf("file source %s does not exist", name)
+	}
+	return *w.reload(s, true), nil
+}
+
+// Run calls Check every interval and passes every report to fn until ctx is done.
+func (w *FileWatcher) Run(ctx context.Context, interval time.Duration, fn func(SourceReport)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			for _, report := range w.Check() {
+				fn(report)
+			}
+		}
+	}
+}
+
+// reload parses the file of a source and applies the difference to the last good state.
+// Returns nil if the file did not change and force is not set.
+func (w *FileWatcher) reload(s *watchedSource, force bool) *SourceReport {
+	report := &SourceReport{
+		Name: s.Name,
+		Path: s.Path,
+		Time: w.n.now(),
+	}
+
+	info, err := os.Stat(s.Path)
+	if err != nil {
+		if !force && s.modTime.IsZero() && s.size < 0 {
+			// the missing file was already reported
+			return nil
+		}
+		s.modTime, s.size = time.Time{}, -1
+		report.Err = fmt.Errorf("failed to read file source %s: %w", s.Name, err)
+		return report
+	}
+	sigModTime, sigSize := time.Time{}, int64(-1)
+	if s.SignaturePath != "" {
+		// a missing signature is refused by the import
+		if sigInfo, err := os.Stat(s.SignaturePath); err == nil {
+			sigModTime, sigSize = sigInfo.ModTime(), sigInfo.Size()
+		}
+	}
+	if !force && info.ModTime().Equal(s.modTime) && info.Size() == s.size &&
+		sigModTime.Equal(s.sigModTime) && sigSize == s.sigSize {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		report.Err = fmt.Errorf("failed to read file source %s: %w", s.Name, err)
+		return report
+	}
+	sum := sha256.Sum256(data)
+	report.Hash = hex.EncodeToString(sum[:])
+
+	s.modTime, s.size = info.ModTime(), info.Size()
+	s.sigModTime, s.sigSize = sigModTime, sigSize
+	if !force && report.Hash == s.hash {
+		return nil
+	}
+
+	opts := s.Options
+	if s.SignaturePath != "" {
+		sig, err := os.ReadFile(s.SignaturePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			report.Err = fmt.Errorf("failed to read signature of file source %s: %w", s.Name, err)
+			return report
+		}
+		opts = append(append([]ImportOption{}, opts...), WithSignature(sig))
+	}
+
+	state := sourceState{
+		Hash:    report.Hash,
+		ModTime: s.modTime,
+		Size:    s.size,
+	}
+	if !w.n.loadSource(report, sourceKindFile, data, s.Import, opts, state) {
+		return report
+	}
+	s.hash = report.Hash
+	return report
+}
+
+// loadSource parses data and replaces the stored records of the list with the parsed ones.
+// The result is stored in the report. Returns false if the data cannot be parsed or the
+// list cannot be updated.
+func (n *NutBreaker) loadSource(report *SourceReport, kind string, data []byte, fn ImportFunc, opts []ImportOption, state sourceState) bool {
+	var parsed []importRecord
+	opts = append(append([]ImportOption{}, opts...), collectRecords(&parsed))
+
+	var err error
+	report.Result, err = fn(n, bytes.NewReader(data), opts...)
+	if err == nil && report.Result.Failed > 0 {
+		err = report.Result.Errors[0]
+		if report.Result.Failed > 1 {
+			err = fmt.Errorf("%w (and %d more invalid lines)", err, report.Result.Failed-1)
+		}
+	}
+	if err != nil {
+		report.Err = fmt.Errorf("failed to parse %s source %s: %w", kind, report.Name, err)
+		return false
+	}
+
+	records := make([]sourceRecord, 0, len(parsed))
+	for _, rec := range parsed {
+		low, high, err := parseRange(rec.ipRange, rec.value)
+		if err != nil {
+			report.Err = fmt.Errorf("failed to parse %s source %s: %w", kind, report.Name, err)
+			return false
+		}
+		records = append(records, sourceRecord{
+			Range: Range{Low: low.IP, High: high.IP}.String(),
+			Value: rec.value,
+		})
+	}
+
+	meta := ListMetadata{Name: report.Name, Format: kind}
+	if report.Result.Metadata != nil {
+		meta = *report.Result.Metadata
+		meta.Name = report.Name
+	}
+	meta.Source = report.Path
+	meta.Imported = report.Time
+	meta.Entries = len(records)
+
+	state.Entries = len(records)
+	mutationOpts := newImportOptions(opts).mutationOpts
+	err = n.Update(func(tx *Txn) (err error) {
+		report.Added, report.Removed, err = n.replaceSource(tx, kind, report.Name, state, records, mutationOpts)
+		if err != nil {
+			return err
+		}
+		return n.putMetadata(tx.tx, kind, meta)
+	})
+	if err != nil {
+		report.Added, report.Removed = 0, 0
+		report.Err = fmt.Errorf("failed to update %s source %s: %w", kind, report.Name, err)
+		return false
+	}
+
+	report.Result.Metadata = &meta
+	return true
+}
+
+// replaceSource replaces the stored records of a source with the given ones.
+// Only the differences are written: removed records are removed, added records are inserted.
+// Kept records that overlap with a removed record or with a preceding inserted record are
+// inserted again, which keeps the precedence of later records within the file.
+func (n *NutBreaker) replaceSource(tx *Txn, kind, name string, state sourceState, records []sourceRecord, opts []MutationOption) (added, removed int, err error) {
+	oldState, err := n.sourceState(tx.tx, kind, name)
+	if err != nil {
+		return 0, 0, err
+	}
+	old, err := n.sourceRecords(tx.tx, kind, name, oldState)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	current := make(map[string]bool, len(records))
+	for _, r := range records {
+		current[r.key()] = true
+	}
+	previous := make(map[string]bool, len(old))
+	for _, r := range old {
+		previous[r.key()] = true
+	}
+
+	var removedRanges []Range
+	for _, r := range old {
+		if current[r.key()] {
+			continue
+		}
+		_, err = tx.Remove(r.Range, opts...)
+		if err != nil {
+			return 0, 0, err
+		}
+		low, high, err := parseRange(r.Range, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		removedRanges = append(removedRanges, Range{Low: low.IP, High: high.IP})
+		removed++
+	}
+
+	var inserted []Range
+	for _, r := range records {
+		low, high, err := parseRange(r.Range, r.Value)
+		if err != nil {
+			return 0, 0, err
+		}
+		rng := Range{Low: low.IP, High: high.IP}
+
+		isNew := !previous[r.key()]
+		if !isNew && !overlapsAny(rng, removedRanges) && !overlapsAny(rng, inserted) {
+			continue
+		}
+
+		_, err = tx.Insert(r.Range, r.Value, opts...)
+		if err != nil {
+			return 0, 0, err
+		}
+		inserted = append(inserted, rng)
+		if isNew {
+			added++
+		}
+	}
+
+	return added, removed, n.putSourceRecords(tx.tx, kind, name, state, oldState.Chunks, records)
+}
+
+func overlapsAny(r Range, ranges []Range) bool {
+	for _, o := range ranges {
+		if r.Low.Compare(o.High) <= 0 && o.Low.Compare(r.High) <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceStateKey returns the key of the state of a source, e.g. "source:feed:<name>",
+// which allows a file source and a feed with the same name.
+func sourceStateKey(kind, name string) []byte {
+	return []byte(sourceStatePrefix + kind + ":" + name)
+}
+
+func sourceChunkKey(kind, name string, idx int) []byte {
+	return []byte(fmt.Sprintf("%s%s:%s:%d", sourceDataPrefix, kind, name, idx))
+}
+
+// sourceState returns the stored state of a source or an empty state if the source was never loaded.
+func (n *NutBreaker) sourceState(tx *nutsdb.Tx, kind, name string) (sourceState, error) {
+	data, err := tx.Get(n.metadataBucket, sourceStateKey(kind, name))
+	if err != nil {
+		if errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrNotFoundKey) {
+			return sourceState{}, nil
+		}
+		return sourceState{}, fmt.Errorf("failed to get state of source %s: %w", name, err)
+	}
+
+	var state sourceState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return sourceState{}, fmt.Errorf("failed to decode state of source %s: %w", name, err)
+	}
+	return state, nil
+}
+
+func (n *NutBreaker) sourceRecords(tx *nutsdb.Tx, kind, name string, state sourceState) ([]sourceRecord, error) {
+	var result []sourceRecord
+	for i := 0; i < state.Chunks; i++ {
+		data, err := tx.Get(n.metadataBucket, sourceChunkKey(kind, name, i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get records of source %s: %w", name, err)
+		}
+
+		var chunk []sourceRecord
+		err = json.Unmarshal(data, &chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode records of source %s: %w", name, err)
+		}
+		result = append(result, chunk...)
+	}
+	return result, nil
+}
+
+func (n *NutBreaker) putSourceRecords(tx *nutsdb.Tx, kind, name string, state sourceState, oldChunks int, records []sourceRecord) error {
+	state.Chunks = 0
+	for start := 0; start < len(records); start += sourceChunkSize {
+		end := min(start+sourceChunkSize, len(records))
+		data, err := json.Marshal(records[start:end])
+		if err != nil {
+			return fmt.Errorf("failed to encode records of source %s: %w", name, err)
+		}
+		err = tx.Put(n.metadataBucket, sourceChunkKey(kind, name, state.Chunks), data, 0)
+		if err != nil {
+			return fmt.Errorf("failed to put records of source %s: %w", name, err)
+		}
+		state.Chunks++
+	}
+	for i := state.Chunks; i < oldChunks; i++ {
+		err := tx.Delete(n.metadataBucket, sourceChunkKey(kind, name, i))
+		if err != nil {
+			return fmt.Errorf("failed to delete records of source %s: %w", name, err)
+		}
+	}
+
+	return n.putSourceState(tx, kind, name, state)
+}
+
+func (n *NutBreaker) putSourceState(tx *nutsdb.Tx, kind, name string, state sourceState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode state of source %s: %w", name, err)
+	}
+	return tx.Put(n.metadataBucket, sourceStateKey(kind, name), data, 0)
+}
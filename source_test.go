@@ -0,0 +1,188 @@
+package nutbreaker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeSource writes a source file with a modification time that differs from the previous one.
+func writeSource(t *testing.T, path, content string, mtime *time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	*mtime = mtime.Add(time.Second)
+	require.NoError(t, os.Chtimes(path, *mtime, *mtime))
+}
+
+func requireRanges(t *testing.T, ndb *NutBreaker, expected ...string) {
+	ranges, err := ndb.exportRanges(exportOptions{})
+	require.NoError(t, err)
+
+	var actual []string
+	for _, r := range ranges {
+		actual = append(actual, r.String()+" "+string(r.Value))
+	}
+	require.Equal(t, expected, actual)
+	consistent(t, ndb)
+}
+
+func TestFileWatcher(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("192.168.0.1", []byte("manual"))
+	require.NoError(err)
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	mtime := time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)
+	writeSource(t, path, "10.0.0.0/24 # a\n10.0.0.100 # b\n11.0.0.1 # c\n", &mtime)
+
+	w := ndb.NewFileWatcher()
+	report, err := w.Add(FileSource{Name: "blocklist", Path: path, Options: []ImportOption{WithCommentValue()}})
+	require.NoError(err)
+	require.NotNil(report)
+	require.NoError(report.Err)
+	require.Equal(3, report.Added)
+	require.Len(report.Hash, 64)
+	requireRanges(t, ndb,
+		"10.0.0.0 - 10.0.0.99 a",
+		"10.0.0.100 b",
+		"10.0.0.101 - 10.0.0.255 a",
+		"11.0.0.1 c",
+		"192.168.0.1 manual",
+	)
+
+	_, err = w.Add(FileSource{Name: "blocklist", Path: path})
+	require.Error(err)
+
+	// unchanged
+	require.Empty(w.Check())
+	writeSource(t, path, "10.0.0.0/24 # a\n10.0.0.100 # b\n11.0.0.1 # c\n", &mtime)
+	require.Empty(w.Check())
+
+	// removing b cuts a, which is inserted again
+	writeSource(t, path, "10.0.0.0/24 # a\n11.0.0.1 # c\n12.0.0.0/8 # d\n", &mtime)
+	reports := w.Check()
+	require.Len(reports, 1)
+	require.NoError(reports[0].Err)
+	require.Equal(1, reports[0].Added)
+	require.Equal(1, reports[0].Removed)
+	require.Equal(3, reports[0].Result.Metadata.Entries)
+	requireRanges(t, ndb,
+		"10.0.0.0 - 10.0.0.255 a",
+		"11.0.0.1 c",
+		"12.0.0.0 - 12.255.255.255 d",
+		"192.168.0.1 manual",
+	)
+
+	// a parse error keeps the last good state and is reported once
+	writeSource(t, path, "10.0.0.0/24 # a\nnot an ip\n", &mtime)
+	reports = w.Check()
+	require.Len(reports, 1)
+	require.ErrorIs(reports[0].Err, ErrInvalidRange)
+	require.Empty(w.Check())
+	requireRanges(t, ndb,
+		"10.0.0.0 - 10.0.0.255 a",
+		"11.0.0.1 c",
+		"12.0.0.0 - 12.255.255.255 d",
+		"192.168.0.1 manual",
+	)
+
+	writeSource(t, path, "10.0.0.0/24 # a\n", &mtime)
+	reports = w.Check()
+	require.Len(reports, 1)
+	require.NoError(reports[0].Err)
+	require.Equal(2, reports[0].Removed)
+	requireRanges(t, ndb,
+		"10.0.0.0 - 10.0.0.255 a",
+		"192.168.0.1 manual",
+	)
+
+	// a missing file is reported once
+	require.NoError(os.Remove(path))
+	reports = w.Check()
+	require.Len(reports, 1)
+	require.ErrorIs(reports[0].Err, os.ErrNotExist)
+	require.Empty(w.Check())
+
+	meta, err := w.Metadata("blocklist")
+	require.NoError(err)
+	require.Equal("file", meta.Kind)
+	require.Equal(path, meta.Source)
+	require.Equal(1, meta.Entries)
+}
+
+func TestFileWatcherRestart(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "firehol.netset")
+	data, err := os.ReadFile("testdata/firehol_level1.netset")
+	require.NoError(err)
+	mtime := time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)
+	writeSource(t, path, string(data), &mtime)
+
+	src := FileSource{Name: "level1", Path: path, Import: (*NutBreaker).ImportFireHOL}
+	report, err := ndb.NewFileWatcher().Add(src)
+	require.NoError(err)
+	require.NoError(report.Err)
+	require.Equal("firehol", report.Result.Metadata.Format)
+
+	expected, err := ndb.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.NotEmpty(expected)
+
+	// a new watcher, e.g. after a restart, does not reload the unchanged file
+	w := ndb.NewFileWatcher()
+	report, err = w.Add(src)
+	require.NoError(err)
+	require.Nil(report)
+
+	forced, err := w.Reload("level1")
+	require.NoError(err)
+	require.NoError(forced.Err)
+	require.Zero(forced.Added)
+	require.Zero(forced.Removed)
+
+	actual, err := ndb.exportRanges(exportOptions{})
+	require.NoError(err)
+	require.Equal(expected, actual)
+
+	_, err = w.Reload("unknown")
+	require.Error(err)
+}
+
+func TestFileWatcherRun(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+
+	path := filepath.Join(t.TempDir(), "list.txt")
+	w := ndb.NewFileWatcher()
+	report, err := w.Add(FileSource{Name: "list", Path: path})
+	require.NoError(t, err)
+	require.ErrorIs(t, report.Err, os.ErrNotExist)
+
+	mtime := time.Date(2024, time.March, 3, 12, 0, 0, 0, time.UTC)
+	writeSource(t, path, "10.0.0.1\n", &mtime)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reports := make(chan SourceReport, 1)
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, 10*time.Millisecond, func(r SourceReport) {
+			reports <- r
+		})
+	}()
+
+	r := <-reports
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.NoError(t, r.Err)
+	require.Equal(t, 1, r.Added)
+}
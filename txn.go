@@ -0,0 +1,431 @@
+package nutbreaker
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// Txn is a transaction that may span multiple operations.
+// A Txn is only valid within the function that is passed to
+// NutBreaker.Update or NutBreaker.View.
+type Txn struct {
+	n        *NutBreaker
+	tx       *nutsdb.Tx
+	writable bool
+
+	// nutsdb neither returns pending sorted set writes from ZRangeByScore
+	// nor supports writing the same key twice within a single transaction.
+	// All boundary changes are staged here and written exactly once on commit.
+	pending map[float64]pendingBoundary
+	scores  []float64 // sorted scores of pending
+	audit   []AuditEntry
+}
+
+type pendingBoundary struct {
+	boundary
+	deleted bool
+}
+
+func newTxn(n *NutBreaker, tx *nutsdb.Tx, writable bool) *Txn {
+	return &Txn{
+		n:        n,
+		tx:       tx,
+		writable: writable,
+		pending:  make(map[float64]pendingBoundary),
+	}
+}
+
+// Update executes fn within a read/write transaction.
+// All changes are committed atomically if fn returns nil, otherwise none of them are applied.
+func (n *NutBreaker) Update(fn func(tx *Txn) error) error {
+	return n.update(func(tx *nutsdb.Tx) error {
+		t := newTxn(n, tx, true)
+		err := fn(t)
+		if err != nil {
+			return err
+		}
+		return t.commit()
+	})
+}
+
+// View executes fn within a read-only transaction.
+func (n *NutBreaker) View(fn func(tx *Txn) error) error {
+	return n.db.View(func(tx *nutsdb.Tx) error {
+		return fn(newTxn(n, tx, false))
+	})
+}
+
+// Insert inserts a new IP range or IP with an associated value.
+// Existing ranges that overlap with the new range are overwritten.
+// The result lists all previously stored ranges that were overwritten.
+func (t *Txn) Insert(ipRange string, value []byte, opts ...MutationOption) (MutationResult, error) {
+	if !t.writable {
+		return MutationResult{}, ErrTxnReadOnly
+	}
+	return t.audited(AuditInsert, ipRange, opts, func() (MutationResult, error) {
+		return t.n.insert(t, ipRange, value)
+	})
+}
+
+// Remove removes an IP range or IP. Existing ranges that overlap partially are cut.
+// The result lists all previously stored ranges that were removed or cut.
+func (t *Txn) Remove(ipRange string, opts ...MutationOption) (MutationResult, error) {
+	if !t.writable {
+		return MutationResult{}, ErrTxnReadOnly
+	}
+	return t.audited(AuditRemove, ipRange, opts, func() (MutationResult, error) {
+		return t.n.remove(t, ipRange)
+	})
+}
+
+// Find returns the value of the range that contains ip.
+// ErrIPNotFound is returned if no range contains ip.
+func (t *Txn) Find(ip string) ([]byte, error) {
+	v, err := t.n.find(t, ip)
+	if err != nil {
+		return nil, err
+	}
+	return append(make([]byte, 0, len(v)), v...), nil
+}
+
+// Lookup returns the whole range that contains ip.
+// ErrIPNotFound is returned if no range contains ip.
+func (t *Txn) Lookup(ip string) (Range, error) {
+	r, err := t.n.lookup(t, ip)
+	if err != nil {
+		return Range{}, err
+	}
+	r.Value = append(make([]byte, 0, len(r.Value)), r.Value...)
+	return r, nil
+}
+
+// Iterate calls fn for every stored range in ascending order until fn returns false.
+func (t *Txn) Iterate(fn func(r Range) bool) error {
+	all, err := t.n.all(t)
+	if err != nil {
+		return err
+	}
+	for _, r := range rangesFromBoundaries(all) {
+		if !fn(r) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// IterateRange calls fn for every stored range that overlaps with ipRange
+// in ascending order until fn returns false.
+// The passed ranges are not cut to the boundaries of ipRange.
+func (t *Txn) IterateRange(ipRange string, fn func(r Range) bool) error {
+	low, high, err := parseRange(ipRange, nil)
+	if err != nil {
+		return err
+	}
+
+	overlapping, err := t.n.overlapping(t, low, high)
+	if err != nil {
+		return err
+	}
+	for _, r := range overlapping {
+		if !fn(r) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// rangeByScore returns the boundaries within start and end including all staged changes.
+// In case that start is bigger than end, the boundaries are returned in descending order.
+// A limit of 0 returns all boundaries.
+func (t *Txn) rangeByScore(start, end float64, limit int) ([]boundary, error) {
+	desc := start > end
+	before := func(a, b float64) bool {
+		if desc {
+			return a > b
+		}
+		return a < b
+	}
+
+	dbLimit := limit
+	for {
+		members, err := t.tx.ZRangeByScore(
+			t.n.blacklistBucket,
+			t.n.blacklistSortedSetKey,
+			start,
+			end,
+			&nutsdb.GetByScoreRangeOptions{
+				ExcludeStart: false,
+				ExcludeEnd:   false,
+				Limit:        dbLimit,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// all boundaries up to bound are known, staged ones as well as stored ones
+		truncated := dbLimit > 0 && len(members) == dbLimit
+		bound := end
+		if truncated {
+			bound = members[len(members)-1].Score
+		}
+
+		stored := make([]boundary, 0, len(members))
+		for _, m := range members {
+			if _, ok := t.pending[m.Score]; ok {
+				continue
+			}
+			b, err := newBoundaryFromDB(t.tx, t.n.blacklistBucket, m)
+			if err != nil {
+				return nil, err
+			}
+			stored = append(stored, b)
+		}
+
+		staged := t.staged(start, bound, limit)
+
+		result := make([]boundary, 0, len(stored)+len(staged))
+		i, j := 0, 0
+		for i < len(stored) || j < len(staged) {
+			if j == len(staged) || (i < len(stored) && before(stored[i].Score, staged[j].Score)) {
+				result = append(result, stored[i])
+				i++
+			} else {
+				result = append(result, staged[j])
+				j++
+			}
+		}
+
+		if limit > 0 && len(result) >= limit {
+			return result[:limit], nil
+		}
+		if !truncated {
+			return result, nil
+		}
+		// staged deletions shadowed too many stored boundaries
+		dbLimit *= 2
+	}
+}
+
+// staged returns up to limit staged boundaries that are not deleted within start and end
+// in the order from start to end. A limit of 0 returns all of them.
+func (t *Txn) staged(start, end float64, limit int) []boundary {
+	var result []boundary
+	add := func(score float64) bool {
+		p := t.pending[score]
+		if !p.deleted {
+			result = append(result, p.boundary)
+		}
+		return limit == 0 || len(result) < limit
+	}
+
+	if start <= end {
+		for i := sort.SearchFloat64s(t.scores, start); i < len(t.scores) && t.scores[i] <= end; i++ {
+			if !add(t.scores[i]) {
+				break
+			}
+		}
+		return result
+	}
+
+	above := sort.Search(len(t.scores), func(i int) bool { return t.scores[i] > start })
+	for i := above - 1; i >= 0 && t.scores[i] >= end; i-- {
+		if !add(t.scores[i]) {
+			break
+		}
+	}
+	return result
+}
+
+// stage adds p to the staged changes.
+func (t *Txn) stage(p pendingBoundary) {
+	if _, ok := t.pending[p.Score]; !ok {
+		idx := sort.SearchFloat64s(t.scores, p.Score)
+		t.scores = append(t.scores, 0)
+		copy(t.scores[idx+1:], t.scores[idx:])
+		t.scores[idx] = p.Score
+	}
+	t.pending[p.Score] = p
+}
+
+// insert stages b to be inserted or updated.
+func (t *Txn) insert(b boundary) error {
+	if b.IsInf() {
+		return fmt.Errorf("cannot insert infinite boundary: %s", b)
+	}
+	t.stage(pendingBoundary{boundary: b})
+	return nil
+}
+
+// update stages an update of the attributes of b.
+func (t *Txn) update(b boundary) error {
+	if b.IsInf() {
+		return fmt.Errorf("cannot update infinite boundary: %s", b)
+	}
+	t.stage(pendingBoundary{boundary: b})
+	return nil
+}
+
+// delete stages b to be removed.
+func (t *Txn) delete(b boundary) error {
+	if b.IsInf() {
+		return fmt.Errorf("cannot remove infinite boundary: %s", b)
+	}
+	t.stage(pendingBoundary{boundary: b, deleted: true})
+	return nil
+}
+
+// stored returns the persisted attributes of b ignoring all staged changes
+// or nil in case that b is not persisted.
+func (t *Txn) stored(b boundary) (*dbValue, error) {
+	v, err := b.Get(t.tx, t.n.blacklistBucket)
+	if err == nil {
+		return &v, nil
+	}
+	if errors.Is(err, nutsdb.ErrKeyNotFound) || errors.Is(err, nutsdb.ErrNotFoundKey) {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// commit writes all staged changes to the underlying transaction.
+func (t *Txn) commit() error {
+	var changes []historyChange
+	for _, score := range t.scores {
+		change, err := t.commitBoundary(t.pending[score])
+		if err != nil {
+			return err
+		}
+		if !change.noop() {
+			changes = append(changes, change)
+		}
+	}
+	t.pending = make(map[float64]pendingBoundary)
+	t.scores = nil
+
+	seq := t.n.seq.Load()
+	err := t.n.writeAudit(t.tx, t.audit)
+	if err != nil {
+		return err
+	}
+	t.audit = nil
+
+	err = t.n.recordHistory(t.tx, changes)
+	if err != nil {
+		return err
+	}
+	return t.n.saveSeq(t.tx, seq)
+}
+
+// commitBoundary writes a single staged boundary and returns its change.
+func (t *Txn) commitBoundary(p pendingBoundary) (historyChange, error) {
+	old, err := t.stored(p.boundary)
+	if err != nil {
+		return historyChange{}, fmt.Errorf("failed to commit %s: %w", p.boundary, err)
+	}
+	exists := old != nil
+
+	change := historyChange{IP: uint32(p.Score), Before: old}
+	switch {
+	case p.deleted && exists:
+		err = p.RemoveInf(t.tx, t.n.blacklistBucket, t.n.blacklistSortedSetKey)
+	case p.deleted:
+		// was inserted and removed within this transaction
+		return change, nil
+	case exists:
+		err = p.Update(t.tx, t.n.blacklistBucket)
+	default:
+		err = p.InsertInf(t.tx, t.n.blacklistBucket, t.n.blacklistSortedSetKey)
+	}
+	if err != nil {
+		return historyChange{}, fmt.Errorf("failed to commit %s: %w", p.boundary, err)
+	}
+
+	if !p.deleted {
+		v := p.ToDBValue()
+		change.After = &v
+	}
+	return change, nil
+}
+
+// overlapping returns all ranges that overlap with low and high.
+func (n *NutBreaker) overlapping(tx *Txn, low, high boundary) ([]Range, error) {
+	below, inside, above, err := n.vicinity(tx, low, high, 1)
+	if err != nil {
+		return nil, err
+	}
+	return overlappingRanges(below, inside, above, low, high), nil
+}
+
+// overlappingRanges returns all ranges that overlap with low and high given the vicinity of both.
+func overlappingRanges(below, inside, above []boundary, low, high boundary) []Range {
+	bs := make([]boundary, 0, len(below)+len(inside)+len(above))
+	bs = append(bs, below...)
+	bs = append(bs, inside...)
+	bs = append(bs, above...)
+
+	window := Range{Low: low.IP, High: high.IP}
+	ranges := rangesFromBoundaries(bs)
+	result := ranges[:0]
+	for _, r := range ranges {
+		if r.Overlaps(window) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// lookup returns the range that contains ip.
+func (n *NutBreaker) lookup(tx *Txn, ip string) (Range, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Range{}, err
+	}
+
+	if !addr.Is4() {
+		return Range{}, ErrIPv6NotSupported
+	}
+
+	bnd, err := newBoundary(addr, true, true, nil)
+	if err != nil {
+		return Range{}, err
+	}
+
+	below, inside, above, err := n.vicinity(tx, bnd, bnd, 1)
+	if err != nil {
+		return Range{}, err
+	}
+
+	if len(below) == 0 || len(above) == 0 {
+		return Range{}, fmt.Errorf("database inconsistent: %d below, %d above", len(below), len(above))
+	}
+
+	belowNearest := below[0]
+	aboveNearest := above[0]
+
+	if len(inside) == 1 {
+		found := inside[0]
+		switch {
+		case found.IsDoubleBound():
+			return Range{Low: found.IP, High: found.IP, Value: found.Value}, nil
+		case found.IsLowerBound() && aboveNearest.IsUpperBound():
+			return Range{Low: found.IP, High: aboveNearest.IP, Value: found.Value}, nil
+		case found.IsUpperBound() && belowNearest.IsLowerBound():
+			return Range{Low: belowNearest.IP, High: found.IP, Value: found.Value}, nil
+		}
+		return Range{}, fmt.Errorf("database inconsistent: %s is not enclosed by %s and %s", found, belowNearest, aboveNearest)
+	}
+
+	if belowNearest.IsLowerBound() && aboveNearest.IsUpperBound() {
+		if belowNearest.EqualValue(aboveNearest) {
+			return Range{Low: belowNearest.IP, High: aboveNearest.IP, Value: belowNearest.Value}, nil
+		}
+		return Range{}, fmt.Errorf("reasons inconsistent: %v != %v", belowNearest.Value, aboveNearest.Value)
+	}
+
+	return Range{}, ErrIPNotFound
+}
@@ -0,0 +1,174 @@
+package nutbreaker
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnReadYourWrites(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	err := ndb.Update(func(tx *Txn) error {
+		_, err := tx.Insert("123.0.0.0 - 123.0.0.10", []byte("first"))
+		require.NoError(err)
+		_, err = tx.Insert("123.0.0.5", []byte("second"))
+		require.NoError(err)
+
+		v, err := tx.Find("123.0.0.5")
+		require.NoError(err)
+		require.Equal([]byte("second"), v)
+
+		_, err = tx.Remove("123.0.0.0 - 123.0.0.2")
+		require.NoError(err)
+		_, err = tx.Find("123.0.0.1")
+		require.ErrorIs(err, ErrIPNotFound)
+
+		// same key written multiple times within one transaction
+		_, err = tx.Insert("123.0.0.2", []byte("third"))
+		require.NoError(err)
+		_, err = tx.Remove("123.0.0.2")
+		require.NoError(err)
+		_, err = tx.Insert("123.0.0.2", []byte("fourth"))
+		require.NoError(err)
+
+		return ndb.consistent(tx)
+	})
+	require.NoError(err)
+	consistent(t, ndb)
+
+	expected := []Range{
+		{netip.MustParseAddr("123.0.0.2"), netip.MustParseAddr("123.0.0.2"), []byte("fourth")},
+		{netip.MustParseAddr("123.0.0.3"), netip.MustParseAddr("123.0.0.4"), []byte("first")},
+		{netip.MustParseAddr("123.0.0.5"), netip.MustParseAddr("123.0.0.5"), []byte("second")},
+		{netip.MustParseAddr("123.0.0.6"), netip.MustParseAddr("123.0.0.10"), []byte("first")},
+	}
+
+	var actual []Range
+	err = ndb.View(func(tx *Txn) error {
+		return tx.Iterate(func(r Range) bool {
+			actual = append(actual, r)
+			return true
+		})
+	})
+	require.NoError(err)
+	require.Equal(expected, actual)
+}
+
+func TestTxnRollback(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	insert(t, ndb, true, "123.0.0.0 - 123.0.0.10")
+
+	errAbort := errors.New("abort")
+	err := ndb.Update(func(tx *Txn) error {
+		_, err := tx.Remove("123.0.0.0 - 123.0.0.10")
+		require.NoError(err)
+		_, err = tx.Insert("124.0.0.0/24", []byte("other"))
+		require.NoError(err)
+		return errAbort
+	})
+	require.ErrorIs(err, errAbort)
+
+	v, err := ndb.Find("123.0.0.5")
+	require.NoError(err)
+	require.Equal([]byte("same value"), v)
+
+	_, err = ndb.Find("124.0.0.1")
+	require.ErrorIs(err, ErrIPNotFound)
+	consistent(t, ndb)
+}
+
+func TestTxnReadOnly(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	err := ndb.View(func(tx *Txn) error {
+		_, err := tx.Insert("123.0.0.0/24", []byte("value"))
+		return err
+	})
+	require.ErrorIs(err, ErrTxnReadOnly)
+
+	err = ndb.View(func(tx *Txn) error {
+		_, err := tx.Remove("123.0.0.0/24")
+		return err
+	})
+	require.ErrorIs(err, ErrTxnReadOnly)
+}
+
+func TestTxnLookup(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	insert(t, ndb, false,
+		"123.0.0.0 - 123.0.0.10",
+		"123.0.0.11",
+	)
+
+	err := ndb.View(func(tx *Txn) error {
+		for _, ip := range []string{"123.0.0.0", "123.0.0.5", "123.0.0.10"} {
+			r, err := tx.Lookup(ip)
+			require.NoError(err)
+			require.Equal("123.0.0.0 - 123.0.0.10", r.String())
+			require.Equal([]byte("value 0"), r.Value)
+		}
+
+		r, err := tx.Lookup("123.0.0.11")
+		require.NoError(err)
+		require.Equal("123.0.0.11", r.String())
+		require.Equal([]byte("value 1"), r.Value)
+
+		_, err = tx.Lookup("123.0.0.12")
+		require.ErrorIs(err, ErrIPNotFound)
+		return nil
+	})
+	require.NoError(err)
+}
+
+func TestTxnReadCheckWrite(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	whitelisted := []byte("whitelisted")
+	_, err := ndb.Insert("10.0.1.17", whitelisted)
+	require.NoError(err)
+
+	banUnlessWhitelisted := func(ipRange string) error {
+		return ndb.Update(func(tx *Txn) error {
+			found := false
+			err := tx.IterateRange(ipRange, func(r Range) bool {
+				found = string(r.Value) == string(whitelisted)
+				return !found
+			})
+			if err != nil || found {
+				return err
+			}
+			_, err = tx.Insert(ipRange, []byte("banned"))
+			return err
+		})
+	}
+
+	require.NoError(banUnlessWhitelisted("10.0.1.0/24"))
+	require.NoError(banUnlessWhitelisted("10.0.2.0/24"))
+
+	v, err := ndb.Find("10.0.1.17")
+	require.NoError(err)
+	require.Equal(whitelisted, v)
+
+	_, err = ndb.Find("10.0.1.18")
+	require.ErrorIs(err, ErrIPNotFound)
+
+	v, err = ndb.Find("10.0.2.18")
+	require.NoError(err)
+	require.Equal([]byte("banned"), v)
+	consistent(t, ndb)
+}
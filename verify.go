@@ -0,0 +1,321 @@
+package nutbreaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/nutsdb/nutsdb"
+)
+
+// IssueKind classifies an inconsistency that is found by Verify.
+type IssueKind string
+
+const (
+	// IssueOrphanKey is a key of the range index without sorted set member.
+	IssueOrphanKey IssueKind = "orphan key"
+	// IssueMissingRecord is a sorted set member without key.
+	IssueMissingRecord IssueKind = "missing record"
+	// IssueInvalidRecord is a key or member that cannot be decoded or whose score does not match its address.
+	IssueInvalidRecord IssueKind = "invalid record"
+	// IssueBoundSequence is a lower bound without upper bound or vice versa.
+	IssueBoundSequence IssueKind = "invalid bound sequence"
+	// IssueValueMismatch is a range whose lower and upper bound have different values.
+	IssueValueMismatch IssueKind = "value mismatch"
+	// IssueMissingSentinel is a missing -inf or +inf boundary.
+	IssueMissingSentinel IssueKind = "missing sentinel"
+)
+
+// Issue is a single inconsistency of the range index.
+type Issue struct {
+	Kind IssueKind `json:"kind"`
+	// Key is the affected key or sorted set member.
+	Key []byte `json:"key,omitempty"`
+	// IP is the address of the affected boundary, if it is known.
+	IP netip.Addr `json:"ip,omitempty"`
+	// Dropped is true if the affected record cannot be recovered and is removed by Repair.
+	Dropped bool   `json:"dropped"`
+	Msg     string `json:"msg"`
+}
+
+func (i Issue) String() string {
+	if i.IP.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", i.Kind, i.IP, i.Msg)
+	}
+	return fmt.Sprintf("%s: %q: %s", i.Kind, i.Key, i.Msg)
+}
+
+// VerifyReport is the result of Verify and Repair.
+type VerifyReport struct {
+	// Members is the number of sorted set members.
+	Members int `json:"members"`
+	// Records is the number of keys.
+	Records int `json:"records"`
+	// Ranges is the number of ranges that are intact or can be recovered.
+	Ranges int     `json:"ranges"`
+	Issues []Issue `json:"issues,omitempty"`
+}
+
+// OK returns true if the index is consistent.
+func (r VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Dropped returns the issues whose records cannot be recovered.
+func (r VerifyReport) Dropped() []Issue {
+	var dropped []Issue
+	for _, i := range r.Issues {
+		if i.Dropped {
+			dropped = append(dropped, i)
+		}
+	}
+	return dropped
+}
+
+// Verify checks the consistency of the range index without modifying it.
+// An error is only returned if the database cannot be read.
+func (n *NutBreaker) Verify() (report VerifyReport, err error) {
+	err = n.db.View(func(tx *nutsdb.Tx) error {
+		report, _, err = n.verify(tx)
+		return err
+	})
+	if err != nil {
+		return VerifyReport{}, fmt.Errorf("failed to verify database: %w", err)
+	}
+	return report, nil
+}
+
+// Repair rebuilds the range index from all ranges that can be recovered within a single
+// transaction, see Verify. Records that cannot be recovered are removed, a range whose bounds
+// have different values is kept with the value of its lower bound. The returned report
+// describes the issues that were found before the repair. The audit log and the history
+// do not record the repair.
+// Repair is allowed if the database was opened read-only after a failed integrity check,
+// a successful repair makes the database writable again.
+func (n *NutBreaker) Repair() (report VerifyReport, err error) {
+	// bypasses the read-only check of update, dropped buckets are recreated
+	// before the index is rebuilt
+	err = n.db.Update(n.createBuckets)
+	if err != nil {
+		return VerifyReport{}, fmt.Errorf("failed to repair database: %w", err)
+	}
+	err = n.db.Update(func(tx *nutsdb.Tx) error {
+		var ranges []Range
+		report, ranges, err = n.verify(tx)
+		if err != nil || report.OK() {
+			return err
+		}
+		bounds, err := rangeBoundaries(ranges)
+		if err != nil {
+			return err
+		}
+		return n.rebuildIndex(tx, bounds)
+	})
+	if err != nil {
+		return VerifyReport{}, fmt.Errorf("failed to repair database: %w", err)
+	}
+	n.readOnly.Store(false)
+	return report, nil
+}
+
+// verify reads the raw index and returns its issues as well as all recoverable ranges.
+func (n *NutBreaker) verify(tx *nutsdb.Tx) (report VerifyReport, ranges []Range, err error) {
+	var keys, values [][]byte
+	if tx.ExistBucket(nutsdb.DataStructureBTree, n.blacklistBucket) {
+		keys, values, err = tx.GetAll(n.blacklistBucket)
+		if err != nil {
+			return report, nil, fmt.Errorf("failed to read %s bucket: %w", n.blacklistBucket, err)
+		}
+	}
+	records := make(map[string][]byte, len(keys))
+	for i := range keys {
+		records[string(keys[i])] = values[i]
+	}
+
+	var members []*nutsdb.SortedSetMember
+	if tx.ExistBucket(nutsdb.DataStructureSortedSet, n.blacklistBucket) {
+		members, err = n.sortedSetMembers(tx)
+		if err != nil && !errors.Is(err, nutsdb.ErrSortedSetNotFound) && !errors.Is(err, nutsdb.ErrBucket) {
+			return report, nil, err
+		}
+	}
+	report.Members = len(members)
+	report.Records = len(records)
+
+	issue := func(kind IssueKind, key []byte, dropped bool, format string, args ...any) {
+		i := Issue{
+			Kind:    kind,
+			Key:     bytes.Clone(key),
+			Dropped: dropped,
+			Msg:     fmt.Sprintf(format, args...),
+		}
+		// the keys of the sentinels are four bytes long as well
+		if len(key) == 4 && !bytes.Equal(key, negInfKey) && !bytes.Equal(key, posInfKey) {
+			i.IP = netip.AddrFrom4([4]byte(key))
+		}
+		report.Issues = append(report.Issues, i)
+	}
+
+	var (
+		boundaries       []boundary
+		seen             = make(map[string]bool, len(members))
+		negInfs, posInfs int
+	)
+	for _, m := range members {
+		key := m.Value
+		seen[string(key)] = true
+
+		switch {
+		case bytes.Equal(key, negInfKey) && m.Score == negInf:
+			negInfs++
+			continue
+		case bytes.Equal(key, posInfKey) && m.Score == posInf:
+			posInfs++
+			continue
+		case len(key) != 4 || float64(binary.BigEndian.Uint32(key)) != m.Score:
+			issue(IssueInvalidRecord, key, true, "score %v does not match the member", m.Score)
+			continue
+		}
+
+		data, ok := records[string(key)]
+		if !ok {
+			issue(IssueMissingRecord, key, true, "sorted set member without record")
+			continue
+		}
+		var v dbValue
+		err := json.Unmarshal(data, &v)
+		if err != nil || (!v.Low && !v.High) {
+			issue(IssueInvalidRecord, key, true, "record cannot be decoded: %q", data)
+			continue
+		}
+		b, err := newBoundary(netip.AddrFrom4([4]byte(key)), v.Low, v.High, v.Value)
+		if err != nil {
+			issue(IssueInvalidRecord, key, true, "%v", err)
+			continue
+		}
+		boundaries = append(boundaries, b)
+	}
+
+	for _, key := range keys {
+		if !seen[string(key)] {
+			issue(IssueOrphanKey, key, true, "record without sorted set member")
+		}
+	}
+	if negInfs == 0 {
+		issue(IssueMissingSentinel, negInfKey, false, "missing -inf boundary")
+	}
+	if posInfs == 0 {
+		issue(IssueMissingSentinel, posInfKey, false, "missing +inf boundary")
+	}
+
+	var open *boundary
+	for i := range boundaries {
+		b := &boundaries[i]
+		if open != nil && b.LowerBound {
+			issue(IssueBoundSequence, open.Key, true, "lower bound without upper bound")
+			open = nil
+		}
+
+		switch {
+		case b.IsDoubleBound():
+			ranges = append(ranges, Range{Low: b.IP, High: b.IP, Value: b.Value})
+		case b.LowerBound:
+			open = b
+		case open == nil:
+			issue(IssueBoundSequence, b.Key, true, "upper bound without lower bound")
+		default:
+			if !bytes.Equal(open.Value, b.Value) {
+				issue(IssueValueMismatch, b.Key, false, "value %q of the upper bound differs from value %q of the lower bound %s",
+					b.Value, open.Value, open.IP)
+			}
+			ranges = append(ranges, Range{Low: open.IP, High: b.IP, Value: open.Value})
+			open = nil
+		}
+	}
+	if open != nil {
+		issue(IssueBoundSequence, open.Key, true, "lower bound without upper bound")
+	}
+
+	report.Ranges = len(ranges)
+	return report, ranges, nil
+}
+
+// rangeBoundaries returns the boundaries of sorted, non-overlapping ranges.
+func rangeBoundaries(ranges []Range) ([]boundary, error) {
+	bounds := make([]boundary, 0, 2*len(ranges))
+	for _, r := range ranges {
+		if r.Low == r.High {
+			b, err := newBoundary(r.Low, true, true, r.Value)
+			if err != nil {
+				return nil, err
+			}
+			bounds = append(bounds, b)
+			continue
+		}
+		low, err := newBoundary(r.Low, true, false, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		high, err := newBoundary(r.High, false, true, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, low, high)
+	}
+	return bounds, nil
+}
+
+// rebuildIndex replaces the range index with the given consistent sequence of boundaries,
+// the infinity boundaries are added. Every key and member is written at most once.
+// The buckets must have been created by a previous transaction, as buckets cannot be
+// created and written within the same transaction.
+func (n *NutBreaker) rebuildIndex(tx *nutsdb.Tx, inside []boundary) error {
+	bounds := make([]boundary, 0, len(inside)+2)
+	bounds = append(bounds, negInfBoundary)
+	bounds = append(bounds, inside...)
+	bounds = append(bounds, posInfBoundary)
+
+	keep := make(map[string]bool, len(bounds))
+	for _, b := range bounds {
+		keep[string(b.Key)] = true
+	}
+
+	keys, err := tx.GetKeys(n.blacklistBucket)
+	if err != nil {
+		return fmt.Errorf("failed to read %s bucket: %w", n.blacklistBucket, err)
+	}
+	for _, key := range keys {
+		if keep[string(key)] {
+			continue
+		}
+		err = tx.Delete(n.blacklistBucket, key)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s key: %w", n.blacklistBucket, err)
+		}
+	}
+
+	members, err := n.sortedSetMembers(tx)
+	if err != nil && !errors.Is(err, nutsdb.ErrSortedSetNotFound) && !errors.Is(err, nutsdb.ErrBucket) {
+		return err
+	}
+	for _, m := range members {
+		if keep[string(m.Value)] {
+			continue
+		}
+		err = tx.ZRem(n.blacklistBucket, n.blacklistSortedSetKey, m.Value)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s sorted set member: %w", n.blacklistBucket, err)
+		}
+	}
+
+	for _, b := range bounds {
+		err = b.InsertInf(tx, n.blacklistBucket, n.blacklistSortedSetKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
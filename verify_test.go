@@ -0,0 +1,168 @@
+package nutbreaker
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/nutsdb/nutsdb"
+	"github.com/stretchr/testify/require"
+)
+
+func boundaryKey(ip string) []byte {
+	key := netip.MustParseAddr(ip).As4()
+	return key[:]
+}
+
+func TestVerifyRepair(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	for _, r := range []struct{ ipRange, value string }{
+		{"10.0.0.0/24", "vpn"},
+		{"10.0.2.5", "single"},
+		{"10.0.3.0 - 10.0.3.10", "tor"},
+		{"10.0.4.0 - 10.0.4.10", "x"},
+	} {
+		_, err := ndb.Insert(r.ipRange, []byte(r.value))
+		require.NoError(err)
+	}
+
+	report, err := ndb.Verify()
+	require.NoError(err)
+	require.True(report.OK())
+	require.Equal(4, report.Ranges)
+	require.Equal(9, report.Members)
+	require.Equal(9, report.Records)
+
+	bucket, zKey := ndb.blacklistBucket, ndb.blacklistSortedSetKey
+	err = ndb.db.Update(func(tx *nutsdb.Tx) error {
+		upper := boundary{LowerBound: true, Value: []byte("orphan")}
+		err := tx.Put(bucket, boundaryKey("1.1.1.1"), upper.Bytes(), 0)
+		if err != nil {
+			return err
+		}
+		err = tx.ZAdd(bucket, zKey, float64(addrToUint32(netip.MustParseAddr("2.2.2.2"))), boundaryKey("2.2.2.2"))
+		if err != nil {
+			return err
+		}
+		mismatch := boundary{UpperBound: true, Value: []byte("other")}
+		err = tx.Put(bucket, boundaryKey("10.0.3.10"), mismatch.Bytes(), 0)
+		if err != nil {
+			return err
+		}
+		err = tx.Put(bucket, boundaryKey("10.0.2.5"), []byte("{garbage"), 0)
+		if err != nil {
+			return err
+		}
+		err = tx.ZRem(bucket, zKey, boundaryKey("10.0.4.10"))
+		if err != nil {
+			return err
+		}
+		err = tx.Delete(bucket, boundaryKey("10.0.4.10"))
+		if err != nil {
+			return err
+		}
+		err = tx.ZRem(bucket, zKey, posInfKey)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(bucket, posInfKey)
+	})
+	require.NoError(err)
+	require.Error(ndb.isConsistent())
+
+	report, err = ndb.Verify()
+	require.NoError(err)
+	require.False(report.OK())
+	require.Equal(2, report.Ranges)
+
+	kinds := make(map[IssueKind][]string)
+	for _, i := range report.Issues {
+		kinds[i.Kind] = append(kinds[i.Kind], i.String())
+	}
+	require.Equal(map[IssueKind][]string{
+		IssueOrphanKey:       {"orphan key: 1.1.1.1: record without sorted set member"},
+		IssueMissingRecord:   {"missing record: 2.2.2.2: sorted set member without record"},
+		IssueInvalidRecord:   {`invalid record: 10.0.2.5: record cannot be decoded: "{garbage"`},
+		IssueValueMismatch:   {`value mismatch: 10.0.3.10: value "other" of the upper bound differs from value "tor" of the lower bound 10.0.3.0`},
+		IssueBoundSequence:   {"invalid bound sequence: 10.0.4.0: lower bound without upper bound"},
+		IssueMissingSentinel: {`missing sentinel: "+inf": missing +inf boundary`},
+	}, kinds)
+	require.Len(report.Dropped(), 4)
+
+	repaired, err := ndb.Repair()
+	require.NoError(err)
+	require.Equal(report, repaired)
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 vpn", "10.0.3.0 - 10.0.3.10 tor")
+
+	// the repaired index is fully functional
+	_, err = ndb.Insert("10.0.4.0 - 10.0.4.10", []byte("x"))
+	require.NoError(err)
+	requireRanges(t, ndb, "10.0.0.0 - 10.0.0.255 vpn", "10.0.3.0 - 10.0.3.10 tor", "10.0.4.0 - 10.0.4.10 x")
+
+	report, err = ndb.Repair()
+	require.NoError(err)
+	require.True(report.OK())
+}
+
+func TestVerifySentinelIssues(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("10.0.0.0/24", []byte("vpn"))
+	require.NoError(err)
+
+	bucket, zKey := ndb.blacklistBucket, ndb.blacklistSortedSetKey
+	err = ndb.db.Update(func(tx *nutsdb.Tx) error {
+		err := tx.ZAdd(bucket, zKey, 0, negInfKey)
+		if err != nil {
+			return err
+		}
+		return tx.Put(bucket, posInfKey, []byte("{garbage"), 0)
+	})
+	require.NoError(err)
+
+	report, err := ndb.Verify()
+	require.NoError(err)
+	require.False(report.OK())
+
+	var sentinels int
+	for _, issue := range report.Issues {
+		if string(issue.Key) == string(negInfKey) || string(issue.Key) == string(posInfKey) {
+			sentinels++
+			require.False(issue.IP.IsValid(), "%s: %s", issue.Kind, issue.Msg)
+		}
+	}
+	require.NotZero(sentinels)
+}
+
+func TestVerifyRepairDroppedBucket(t *testing.T) {
+	ndb, cleanup := initDB(t)
+	defer cleanup()
+	require := require.New(t)
+
+	_, err := ndb.Insert("10.0.0.0/24", []byte("vpn"))
+	require.NoError(err)
+
+	err = ndb.db.Update(func(tx *nutsdb.Tx) error {
+		return tx.DeleteBucket(nutsdb.DataStructureBTree, ndb.blacklistBucket)
+	})
+	require.NoError(err)
+
+	report, err := ndb.Verify()
+	require.NoError(err)
+	require.False(report.OK())
+	require.Zero(report.Records)
+
+	// the range cannot be recovered without its records, the buckets and sentinels are recreated
+	_, err = ndb.Repair()
+	require.NoError(err)
+	requireRanges(t, ndb)
+	consistent(t, ndb)
+
+	_, err = ndb.Insert("10.0.1.0/24", []byte("tor"))
+	require.NoError(err)
+	requireRanges(t, ndb, "10.0.1.0 - 10.0.1.255 tor")
+}